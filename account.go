@@ -11,37 +11,85 @@ import (
 )
 
 type Account struct {
-	ID             int             `json:"id"`
-	Currency       Currency        `json:"currency"`
-	Name           string          `json:"name"`
-	InitialBalance decimal.Decimal `json:"initial_balance"`
-	Balance        decimal.Decimal `json:"balance"`
-	CreatedAt      string          `json:"created_at"`
-	UpdatedAt      string          `json:"updated_at"`
+	ID               int             `json:"id"`
+	UserID           int             `json:"-"`
+	Currency         Currency        `json:"currency"`
+	Name             string          `json:"name"`
+	InitialBalance   decimal.Decimal `json:"initial_balance"`
+	Balance          decimal.Decimal `json:"balance"`
+	TotalIncome      decimal.Decimal `json:"total_income"`
+	TotalExpense     decimal.Decimal `json:"total_expense"`
+	TransactionCount int             `json:"transaction_count"`
+	CreatedAt        string          `json:"created_at"`
+	UpdatedAt        string          `json:"updated_at"`
 }
 
-func (account *Account) getBalance(db *sql.DB, rateName string) error {
-	var income decimal.Decimal
-	var expense decimal.Decimal
+// transactionKindSQL tells the direction of a transaction:
+// a TRANSFER transaction is a credit when the account is the destination of the transfer
+const transactionKindSQL = `CASE
+	WHEN t.type = 'TRANSFER' AND tr.to_account_id = t.account_id THEN 'TRANSFER_IN'
+	WHEN t.type = 'TRANSFER' THEN 'TRANSFER_OUT'
+	ELSE t.type
+END`
 
-	err := db.QueryRow(
-		"SELECT value FROM transactions WHERE account_id = $1 AND type = 'INCOME'", account.ID,
-	).Scan(&income)
+// getBalance calculates the balance and totals of the account, converted to rateName if given
+// when historical is true, each day of transactions is converted with the Rate effective at that date
+func (account *Account) getBalance(db *sql.DB, rateName string, historical bool) error {
+	var transferIn decimal.Decimal
+	var transferOut decimal.Decimal
 
-	if err == sql.ErrNoRows {
-		account.Balance = account.InitialBalance
-	} else {
-		account.Balance = decimal.Sum(account.InitialBalance, income)
+	account.TotalIncome = decimal.New(0, 0)
+	account.TotalExpense = decimal.New(0, 0)
+	account.TransactionCount = 0
+
+	rows, err := db.Query(
+		`SELECT `+transactionKindSQL+` AS kind, SUM(t.value), COUNT(t.id)
+		FROM transactions t LEFT JOIN transfers tr ON (t.transfer_id = tr.id)
+		WHERE t.account_id = $1
+		GROUP BY kind`, account.ID,
+	)
+
+	if err != nil {
+		return err
 	}
+	defer rows.Close()
 
-	err = db.QueryRow(
-		"SELECT value FROM transactions WHERE account_id = $1 AND type = 'EXPENSE'", account.ID,
-	).Scan(&expense)
+	for rows.Next() {
+		var kind string
+		var total decimal.Decimal
+		var count int
 
-	if err == sql.ErrNoRows {
-		account.Balance = account.Balance
-	} else {
-		account.Balance = account.Balance.Sub(expense)
+		errScan := rows.Scan(&kind, &total, &count)
+		if errScan != nil {
+			return errScan
+		}
+
+		switch kind {
+		case "INCOME":
+			account.TotalIncome = total
+		case "EXPENSE":
+			account.TotalExpense = total
+		case "TRANSFER_IN":
+			transferIn = total
+		case "TRANSFER_OUT":
+			transferOut = total
+		}
+
+		account.TransactionCount += count
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	account.Balance = account.InitialBalance.
+		Add(account.TotalIncome).
+		Sub(account.TotalExpense).
+		Add(transferIn).
+		Sub(transferOut)
+
+	if rateName != "" && account.Currency.Name != rateName && historical {
+		return account.calculateHistoricalBalance(db, rateName)
 	}
 
 	if rateName != "" && account.Currency.Name != rateName {
@@ -61,21 +109,113 @@ func (account *Account) getBalance(db *sql.DB, rateName string) error {
 
 func (account *Account) calculateInitialBalance(db *sql.DB, rateName string) (err error) {
 	rate, err := account.Currency.GetRate(db, rateName)
-	account.InitialBalance = account.InitialBalance.Mul(rate.Value).Truncate(2)
+	account.InitialBalance = roundMoney(account.InitialBalance.Mul(rate.Value))
 	return
 }
 
 func (account *Account) calculateBalance(db *sql.DB, rateName string) (err error) {
 	rate, err := account.Currency.GetRate(db, rateName)
-	account.Balance = account.Balance.Mul(rate.Value).Truncate(2)
+	account.Balance = roundMoney(account.Balance.Mul(rate.Value))
+	account.TotalIncome = roundMoney(account.TotalIncome.Mul(rate.Value))
+	account.TotalExpense = roundMoney(account.TotalExpense.Mul(rate.Value))
 	return
 }
 
-func ListAccounts(db *sql.DB, rateName string) ([]Account, error) {
+// calculateHistoricalBalance converts the initial balance with the Rate of the day the account was created
+// and the transactions with the Rate of their dates, the sums keep full precision and are only rounded at the end
+func (account *Account) calculateHistoricalBalance(db *sql.DB, rateName string) (err error) {
+	createdAt, err := time.Parse(time.RFC3339, account.CreatedAt)
+	if err != nil {
+		createdAt = time.Now()
+	}
+
+	rate, err := GetRateAt(db, account.Currency.Name, rateName, createdAt)
+	if err != nil {
+		return
+	}
+
+	initialBalance := account.InitialBalance.Mul(rate.Value)
+	account.InitialBalance = roundMoney(initialBalance)
+	account.Balance = initialBalance
+	account.TotalIncome = decimal.New(0, 0)
+	account.TotalExpense = decimal.New(0, 0)
+
 	rows, err := db.Query(
-		`SELECT a.id, c.name, a.name, a.initial_balance, a.created_at, a.updated_at
+		`SELECT `+transactionKindSQL+` AS kind, to_char(t.date, 'YYYY-MM-DD'), SUM(t.value)
+		FROM transactions t LEFT JOIN transfers tr ON (t.transfer_id = tr.id)
+		WHERE t.account_id = $1
+		GROUP BY kind, t.date`, account.ID,
+	)
+
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	rates := map[string]decimal.Decimal{}
+
+	for rows.Next() {
+		var kind string
+		var date string
+		var total decimal.Decimal
+
+		err = rows.Scan(&kind, &date, &total)
+		if err != nil {
+			return
+		}
+
+		if _, ok := rates[date]; !ok {
+			day, _ := time.Parse(dateLayout, date)
+			rate, err = GetRateAt(db, account.Currency.Name, rateName, day)
+			if err != nil {
+				return
+			}
+			rates[date] = rate.Value
+		}
+
+		converted := total.Mul(rates[date])
+
+		switch kind {
+		case "INCOME":
+			account.TotalIncome = account.TotalIncome.Add(converted)
+			account.Balance = account.Balance.Add(converted)
+		case "EXPENSE":
+			account.TotalExpense = account.TotalExpense.Add(converted)
+			account.Balance = account.Balance.Sub(converted)
+		case "TRANSFER_IN":
+			account.Balance = account.Balance.Add(converted)
+		case "TRANSFER_OUT":
+			account.Balance = account.Balance.Sub(converted)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	account.Balance = roundMoney(account.Balance)
+	account.TotalIncome = roundMoney(account.TotalIncome)
+	account.TotalExpense = roundMoney(account.TotalExpense)
+
+	return
+}
+
+func ListAccounts(db *sql.DB, userID int, rateName string) ([]Account, error) {
+	return listAccounts(db, userID, rateName, false)
+}
+
+// ListAccountsHistorical is like ListAccounts, but converts transactions with the Rate effective at their dates
+func ListAccountsHistorical(db *sql.DB, userID int, rateName string) ([]Account, error) {
+	return listAccounts(db, userID, rateName, true)
+}
+
+func listAccounts(db *sql.DB, userID int, rateName string, historical bool) ([]Account, error) {
+	rows, err := db.Query(
+		`SELECT a.id, a.user_id, c.name, a.name, a.initial_balance, a.created_at, a.updated_at
 	     FROM accounts a
-		 INNER JOIN currencies c ON (a.currency_name = c.name)`,
+		 INNER JOIN currencies c ON (a.currency_name = c.name)
+		 WHERE a.user_id = $1
+		 ORDER BY a.id`, userID,
 	)
 
 	if err != nil {
@@ -88,6 +228,7 @@ func ListAccounts(db *sql.DB, rateName string) ([]Account, error) {
 		var account Account
 		errScan := rows.Scan(
 			&account.ID,
+			&account.UserID,
 			&account.Currency.Name,
 			&account.Name,
 			&account.InitialBalance,
@@ -105,7 +246,7 @@ func ListAccounts(db *sql.DB, rateName string) ([]Account, error) {
 			return nil, errScan
 		}
 
-		errBalance := account.getBalance(db, rateName)
+		errBalance := account.getBalance(db, rateName, historical)
 
 		if errBalance != nil {
 			return nil, errBalance
@@ -117,15 +258,25 @@ func ListAccounts(db *sql.DB, rateName string) ([]Account, error) {
 	return accounts, nil
 }
 
-func GetAccount(db *sql.DB, id int, rateName string) (account Account, err error) {
+func GetAccount(db *sql.DB, userID int, id int, rateName string) (Account, error) {
+	return getAccount(db, userID, id, rateName, false)
+}
+
+// GetAccountHistorical is like GetAccount, but converts transactions with the Rate effective at their dates
+func GetAccountHistorical(db *sql.DB, userID int, id int, rateName string) (Account, error) {
+	return getAccount(db, userID, id, rateName, true)
+}
+
+func getAccount(db *sql.DB, userID int, id int, rateName string, historical bool) (account Account, err error) {
 	row := db.QueryRow(
-		`SELECT a.id, c.name, a.name, initial_balance, a.created_at, a.updated_at
+		`SELECT a.id, a.user_id, c.name, a.name, initial_balance, a.created_at, a.updated_at
 		FROM accounts a INNER JOIN currencies c ON (a.currency_name = c.name)
-		WHERE a.id = $1`, id,
+		WHERE a.id = $1 AND a.user_id = $2`, id, userID,
 	)
 
 	err = row.Scan(
 		&account.ID,
+		&account.UserID,
 		&account.Currency.Name,
 		&account.Name,
 		&account.InitialBalance,
@@ -142,7 +293,7 @@ func GetAccount(db *sql.DB, id int, rateName string) (account Account, err error
 		return
 	}
 
-	err = account.getBalance(db, rateName)
+	err = account.getBalance(db, rateName, historical)
 
 	if err != nil {
 		return
@@ -160,9 +311,10 @@ func (account *Account) Create(db *sql.DB) (err error) {
 	}
 
 	err = db.QueryRow(
-		`INSERT INTO accounts(currency_name, name, initial_balance, created_at, updated_at)
-		 VALUES ($1, $2, $3, $4, $5)
+		`INSERT INTO accounts(user_id, currency_name, name, initial_balance, created_at, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $6)
 		 RETURNING id, created_at, updated_at`,
+		account.UserID,
 		account.Currency.Name,
 		account.Name,
 		account.InitialBalance,
@@ -174,7 +326,7 @@ func (account *Account) Create(db *sql.DB) (err error) {
 		return
 	}
 
-	err = account.getBalance(db, account.Currency.Name)
+	err = account.getBalance(db, account.Currency.Name, false)
 	if err != nil {
 		return
 	}
@@ -188,11 +340,12 @@ func (account *Account) Update(db *sql.DB) (err error) {
 	err = db.QueryRow(
 		`UPDATE accounts
 		SET name = $1, updated_at = $2
-		WHERE id = $3
+		WHERE id = $3 AND user_id = $4
 		RETURNING updated_at`,
 		account.Name,
 		updatedAt,
 		account.ID,
+		account.UserID,
 	).Scan(&account.UpdatedAt)
 
 	if err != nil {
@@ -204,8 +357,9 @@ func (account *Account) Update(db *sql.DB) (err error) {
 
 func (account *Account) Delete(db *sql.DB) (err error) {
 	_, err = db.Exec(
-		"DELETE FROM accounts WHERE id = $1;",
+		"DELETE FROM accounts WHERE id = $1 AND user_id = $2;",
 		account.ID,
+		account.UserID,
 	)
 
 	if err != nil {
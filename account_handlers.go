@@ -11,8 +11,16 @@ import (
 )
 
 func (s *Server) ListAccounts(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
 	rateName := strings.ToUpper(r.URL.Query().Get("rate"))
-	accounts, err := ListAccounts(s.db, rateName)
+
+	var accounts []Account
+	var err error
+	if r.URL.Query().Get("historical") == "true" {
+		accounts, err = ListAccountsHistorical(s.db, user.ID, rateName)
+	} else {
+		accounts, err = ListAccounts(s.db, user.ID, rateName)
+	}
 
 	if err != nil {
 		respondWithError(w, err.Error(), http.StatusInternalServerError)
@@ -26,8 +34,16 @@ func (s *Server) ListAccounts(w http.ResponseWriter, r *http.Request) {
 func (s *Server) GetAccount(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	accountID, _ := strconv.Atoi(vars["id"])
+	user := currentUser(r)
 	rateName := strings.ToUpper(r.URL.Query().Get("rate"))
-	account, err := GetAccount(s.db, accountID, rateName)
+
+	var account Account
+	var err error
+	if r.URL.Query().Get("historical") == "true" {
+		account, err = GetAccountHistorical(s.db, user.ID, accountID, rateName)
+	} else {
+		account, err = GetAccount(s.db, user.ID, accountID, rateName)
+	}
 
 	if err == sql.ErrNoRows {
 		respondWithError(w, "not found", http.StatusNotFound)
@@ -53,6 +69,7 @@ func (s *Server) CreateAccount(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	account.UserID = currentUser(r).ID
 	err = account.Create(s.db)
 	if err != nil {
 		respondWithError(w, err.Error(), http.StatusInternalServerError)
@@ -66,7 +83,12 @@ func (s *Server) CreateAccount(w http.ResponseWriter, r *http.Request) {
 func (s *Server) UpdateAccount(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	accountID, _ := strconv.Atoi(vars["id"])
-	account, err := GetAccount(s.db, accountID, "")
+	account, err := GetAccount(s.db, currentUser(r).ID, accountID, "")
+
+	if err == sql.ErrNoRows {
+		respondWithError(w, "not found", http.StatusNotFound)
+		return
+	}
 
 	err = validateRequest(account)
 	if err != nil {
@@ -94,7 +116,12 @@ func (s *Server) UpdateAccount(w http.ResponseWriter, r *http.Request) {
 func (s *Server) DeleteAccount(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	accountID, _ := strconv.Atoi(vars["id"])
-	account, err := GetAccount(s.db, accountID, "")
+	account, err := GetAccount(s.db, currentUser(r).ID, accountID, "")
+
+	if err == sql.ErrNoRows {
+		respondWithError(w, "not found", http.StatusNotFound)
+		return
+	}
 
 	if err != nil {
 		respondWithError(w, err.Error(), http.StatusInternalServerError)
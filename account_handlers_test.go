@@ -27,6 +27,7 @@ func TestListAccounts(t *testing.T) {
 	}
 	currency.Create(s.db)
 	account := Account{
+		UserID:         testUser.ID,
 		Currency:       currency,
 		Name:           "My Wallet",
 		InitialBalance: Decimal("100.00"),
@@ -52,6 +53,7 @@ func TestGetAccount(t *testing.T) {
 	}
 	currency.Create(s.db)
 	account := Account{
+		UserID:         testUser.ID,
 		Currency:       currency,
 		Name:           "My Wallet",
 		InitialBalance: Decimal("100.00"),
@@ -105,6 +107,7 @@ func TestUpdateAccount(t *testing.T) {
 	}
 	currencyBrl.Create(s.db)
 	account := Account{
+		UserID:         testUser.ID,
 		Currency:       currency,
 		Name:           "My Wallet",
 		InitialBalance: Decimal("100.00"),
@@ -132,6 +135,7 @@ func TestDeleteAccount(t *testing.T) {
 	}
 	currency.Create(s.db)
 	account := Account{
+		UserID:         testUser.ID,
 		Currency:       currency,
 		Name:           "My Wallet",
 		InitialBalance: Decimal("100.00"),
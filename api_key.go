@@ -0,0 +1,180 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+// apiKeyPrefix tells API keys apart from JWT session tokens in the Authorization header
+const apiKeyPrefix = "fin_"
+
+var errInvalidAPIKey = errors.New("invalid api key")
+
+// APIKey is a long lived credential of a User, only its hash is stored,
+// so Key is only filled right after it is created
+type APIKey struct {
+	ID         int     `json:"id"`
+	UserID     int     `json:"-"`
+	Name       string  `json:"name"`
+	Key        string  `json:"key,omitempty"`
+	Prefix     string  `json:"prefix"`
+	ReadOnly   bool    `json:"read_only"`
+	LastUsedAt *string `json:"last_used_at"`
+	RevokedAt  *string `json:"revoked_at"`
+	CreatedAt  string  `json:"created_at"`
+}
+
+func ListAPIKeys(db *sql.DB, userID int) ([]APIKey, error) {
+	rows, err := db.Query(
+		`SELECT id, user_id, name, prefix, read_only, last_used_at, revoked_at, created_at
+		FROM api_keys WHERE user_id = $1 ORDER BY id`, userID,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []APIKey{}
+
+	for rows.Next() {
+		var key APIKey
+		errScan := rows.Scan(
+			&key.ID,
+			&key.UserID,
+			&key.Name,
+			&key.Prefix,
+			&key.ReadOnly,
+			&key.LastUsedAt,
+			&key.RevokedAt,
+			&key.CreatedAt,
+		)
+
+		if errScan != nil {
+			return nil, errScan
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+func GetAPIKey(db *sql.DB, userID int, id int) (key APIKey, err error) {
+	err = db.QueryRow(
+		`SELECT id, user_id, name, prefix, read_only, last_used_at, revoked_at, created_at
+		FROM api_keys WHERE id = $1 AND user_id = $2`, id, userID,
+	).Scan(
+		&key.ID,
+		&key.UserID,
+		&key.Name,
+		&key.Prefix,
+		&key.ReadOnly,
+		&key.LastUsedAt,
+		&key.RevokedAt,
+		&key.CreatedAt,
+	)
+
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// Create generates a random key, it is returned in Key and can't be retrieved later
+func (key *APIKey) Create(db *sql.DB) (err error) {
+	secret := make([]byte, 32)
+	if _, err = rand.Read(secret); err != nil {
+		return
+	}
+
+	createdAt := time.Now()
+	key.Key = apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	key.Prefix = key.Key[:len(apiKeyPrefix)+6]
+
+	err = db.QueryRow(
+		`INSERT INTO api_keys(user_id, name, prefix, key_hash, read_only, created_at)
+		VALUES($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`,
+		key.UserID,
+		key.Name,
+		key.Prefix,
+		hashAPIKey(key.Key),
+		key.ReadOnly,
+		createdAt,
+	).Scan(&key.ID, &key.CreatedAt)
+
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// Revoke disables the key, it stays listed so its usage can still be audited
+func (key *APIKey) Revoke(db *sql.DB) (err error) {
+	var revokedAt string
+
+	err = db.QueryRow(
+		`UPDATE api_keys SET revoked_at = COALESCE(revoked_at, $1)
+		WHERE id = $2 AND user_id = $3
+		RETURNING revoked_at`,
+		time.Now(),
+		key.ID,
+		key.UserID,
+	).Scan(&revokedAt)
+
+	if err != nil {
+		return
+	}
+
+	key.RevokedAt = &revokedAt
+
+	return
+}
+
+func (key APIKey) Validate() (err error) {
+	if strings.TrimSpace(key.Name) == "" {
+		err = errors.New("field 'name' must not be empty")
+	}
+
+	return
+}
+
+// authenticateAPIKey returns the active APIKey matching the raw key and marks it as used
+func authenticateAPIKey(db *sql.DB, raw string) (key APIKey, err error) {
+	err = db.QueryRow(
+		`UPDATE api_keys SET last_used_at = $1
+		WHERE key_hash = $2 AND revoked_at IS NULL
+		RETURNING id, user_id, name, prefix, read_only, last_used_at, revoked_at, created_at`,
+		time.Now(),
+		hashAPIKey(raw),
+	).Scan(
+		&key.ID,
+		&key.UserID,
+		&key.Name,
+		&key.Prefix,
+		&key.ReadOnly,
+		&key.LastUsedAt,
+		&key.RevokedAt,
+		&key.CreatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return key, errInvalidAPIKey
+	}
+
+	return
+}
+
+// hashAPIKey hashes the key with SHA-256, keys are random, so a slow hash isn't needed like for passwords
+func hashAPIKey(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+func (s *Server) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := ListAPIKeys(s.db, currentUser(r).ID)
+
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, keys, http.StatusOK)
+	return
+}
+
+func (s *Server) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	// a leaked key must not be able to create more keys
+	if _, ok := currentAPIKey(r); ok {
+		respondWithError(w, "api keys can't be created with an api key, login first", http.StatusForbidden)
+		return
+	}
+
+	var key APIKey
+	json.NewDecoder(r.Body).Decode(&key)
+
+	err := validateRequest(key)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	key.UserID = currentUser(r).ID
+	err = key.Create(s.db)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, key, http.StatusCreated)
+	return
+}
+
+func (s *Server) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	keyID, _ := strconv.Atoi(vars["id"])
+	key, err := GetAPIKey(s.db, currentUser(r).ID, keyID)
+
+	if err == sql.ErrNoRows {
+		respondWithError(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = key.Revoke(s.db)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, nil, http.StatusNoContent)
+	return
+}
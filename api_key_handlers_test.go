@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/jonatasbaldin/fin/test"
+)
+
+func TestCreateAPIKey(t *testing.T) {
+	ClearDB(s.db)
+	defer func(authorization string) { Authorization = authorization }(Authorization)
+
+	body := []byte(`{"name": "My Script"}`)
+	response := Request(s.router, "POST", "/api-keys", bytes.NewBuffer(body))
+	assert.Equal(t, http.StatusCreated, response.Code)
+
+	var key APIKey
+	json.Unmarshal(response.Body.Bytes(), &key)
+
+	assert.True(t, strings.HasPrefix(key.Key, "fin_"))
+	assert.True(t, strings.HasPrefix(key.Key, key.Prefix))
+
+	response = Request(s.router, "GET", "/api-keys", nil)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.False(t, strings.Contains(response.Body.String(), key.Key))
+
+	Authorization = "Bearer " + key.Key
+	response = Request(s.router, "GET", "/users/me", nil)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	// keys can't create other keys
+	response = Request(s.router, "POST", "/api-keys", bytes.NewBuffer(body))
+	assert.Equal(t, http.StatusForbidden, response.Code)
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	ClearDB(s.db)
+	defer func(authorization string) { Authorization = authorization }(Authorization)
+
+	key := APIKey{UserID: testUser.ID, Name: "My Script"}
+	key.Create(s.db)
+
+	response := Request(s.router, "DELETE", fmt.Sprintf("/api-keys/%d", key.ID), nil)
+	assert.Equal(t, http.StatusNoContent, response.Code)
+
+	Authorization = "Bearer " + key.Key
+	response = Request(s.router, "GET", "/accounts", nil)
+	assert.Equal(t, http.StatusUnauthorized, response.Code)
+
+	var err CustomError
+	json.Unmarshal(response.Body.Bytes(), &err)
+
+	assert.Equal(t, err.Error, "invalid api key")
+}
+
+func TestReadOnlyAPIKey(t *testing.T) {
+	ClearDB(s.db)
+	defer func(authorization string) { Authorization = authorization }(Authorization)
+
+	key := APIKey{UserID: testUser.ID, Name: "Dashboard", ReadOnly: true}
+	key.Create(s.db)
+	Authorization = "Bearer " + key.Key
+
+	response := Request(s.router, "GET", "/accounts", nil)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	response = Request(s.router, "POST", "/categories", bytes.NewBuffer([]byte(`{"name": "Food"}`)))
+	assert.Equal(t, http.StatusForbidden, response.Code)
+
+	var err CustomError
+	json.Unmarshal(response.Body.Bytes(), &err)
+
+	assert.Equal(t, err.Error, "api key is read only")
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type contextKey string
+
+const (
+	userContextKey   contextKey = "user"
+	apiKeyContextKey contextKey = "api_key"
+)
+
+// defaultTokenTTL is how long session tokens are valid when TOKEN_TTL is not set
+const defaultTokenTTL = 24 * time.Hour
+
+// publicRoutes are the named routes that can be used without credentials
+var publicRoutes = map[string]bool{
+	"register": true,
+	"login":    true,
+}
+
+// initializeAuth reads JWT_SECRET, TOKEN_TTL and ADMIN_EMAILS, without a secret a random one is used,
+// so tokens stop working when the server restarts
+func (s *Server) initializeAuth() {
+	s.tokenSecret = []byte(os.Getenv("JWT_SECRET"))
+	if len(s.tokenSecret) == 0 {
+		log.Print("JWT_SECRET is not set, using a random secret")
+		s.tokenSecret = make([]byte, 32)
+		if _, err := rand.Read(s.tokenSecret); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	s.tokenTTL = defaultTokenTTL
+	if value := os.Getenv("TOKEN_TTL"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl <= 0 {
+			log.Fatal("invalid TOKEN_TTL: must be a positive duration, like 12h")
+		}
+		s.tokenTTL = ttl
+	}
+
+	// admins can backup and restore the whole instance
+	s.adminEmails = map[string]bool{}
+	for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+			s.adminEmails[email] = true
+		}
+	}
+}
+
+// authenticate is a mux middleware that requires a bearer token, either a JWT from '/login' or an API key,
+// and stores the authenticated User in the request context
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route := mux.CurrentRoute(r); route != nil && publicRoutes[route.GetName()] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		authorization := r.Header.Get("Authorization")
+		if !strings.HasPrefix(authorization, "Bearer ") {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="fin"`)
+			respondWithError(w, "authentication required", http.StatusUnauthorized)
+			return
+		}
+		token := strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer "))
+
+		var user User
+		var err error
+		ctx := r.Context()
+
+		if strings.HasPrefix(token, apiKeyPrefix) {
+			var key APIKey
+			key, err = authenticateAPIKey(s.db, token)
+			if err == nil {
+				// read only keys can't change anything
+				if key.ReadOnly && r.Method != http.MethodGet {
+					respondWithError(w, "api key is read only", http.StatusForbidden)
+					return
+				}
+
+				ctx = context.WithValue(ctx, apiKeyContextKey, key)
+				user, err = GetUser(s.db, key.UserID)
+			}
+		} else {
+			var claims tokenClaims
+			claims, err = parseToken(s.tokenSecret, token, time.Now())
+			if err == nil {
+				user, err = GetUser(s.db, claims.Subject)
+				if err == sql.ErrNoRows {
+					err = errInvalidToken
+				}
+			}
+		}
+
+		if err == errInvalidAPIKey || err == errInvalidToken || err == errExpiredToken {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="fin", error="invalid_token"`)
+			respondWithError(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		if err != nil {
+			respondWithError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, userContextKey, user)))
+	})
+}
+
+// currentUser returns the User authenticated by the middleware
+func currentUser(r *http.Request) User {
+	user, _ := r.Context().Value(userContextKey).(User)
+	return user
+}
+
+// isAdmin tells if the user is listed in ADMIN_EMAILS
+func (s *Server) isAdmin(user User) bool {
+	return user.ID != 0 && s.adminEmails[strings.ToLower(user.Email)]
+}
+
+// currentAPIKey returns the APIKey used to authenticate, ok is false for session tokens
+func currentAPIKey(r *http.Request) (key APIKey, ok bool) {
+	key, ok = r.Context().Value(apiKeyContextKey).(APIKey)
+	return
+}
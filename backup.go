@@ -0,0 +1,472 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// backupVersion changes whenever the archive can't be restored by an older Fin
+const backupVersion = 1
+
+const backupFormat = "fin-backup"
+
+// backupHeader is the first line of an archive
+type backupHeader struct {
+	Format    string `json:"format"`
+	Version   int    `json:"version"`
+	CreatedAt string `json:"created_at"`
+}
+
+// backupLine is every other line of an archive, a row of a table
+type backupLine struct {
+	Table string          `json:"table"`
+	Row   json.RawMessage `json:"row"`
+}
+
+// backupTable describes how a table is saved and restored, its serial id is not restored,
+// the new ids replace the old ones in the columns referencing it
+type backupTable struct {
+	name       string
+	hasID      bool
+	columns    []string
+	references map[string]string
+	orderBy    string
+	// restoreWhere skips rows already in the database, only for tables nothing references
+	restoreWhere string
+	// matchBy is a unique column, rows already in the database with the same value are reused
+	matchBy string
+	// deferred are references to rows of the same table, which may come later in the archive,
+	// they are restored once every row is in
+	deferred map[string]string
+}
+
+// backupDeferred is a reference restored after every row, see backupTable.deferred
+type backupDeferred struct {
+	table      string
+	column     string
+	referenced string
+	id         int64
+	oldID      int64
+}
+
+// backupTables are in the order they are restored, every table comes after the ones it references
+var backupTables = []backupTable{
+	{
+		name:         "currencies",
+		columns:      []string{"name", "symbol", "created_at", "updated_at"},
+		orderBy:      "name",
+		restoreWhere: "NOT EXISTS (SELECT 1 FROM currencies c WHERE c.name = r.name)",
+	},
+	{
+		name:         "rates",
+		hasID:        true,
+		columns:      []string{"currency_name", "name", "symbol", "value", "created_at", "updated_at"},
+		orderBy:      "id",
+		restoreWhere: "NOT EXISTS (SELECT 1 FROM rates e WHERE e.currency_name = r.currency_name AND e.name = r.name AND e.created_at = r.created_at)",
+	},
+	{
+		name:    "users",
+		hasID:   true,
+		columns: []string{"email", "name", "password_hash", "created_at", "updated_at"},
+		orderBy: "id",
+		matchBy: "email",
+	},
+	{
+		name:       "api_keys",
+		hasID:      true,
+		columns:    []string{"user_id", "name", "prefix", "key_hash", "read_only", "last_used_at", "revoked_at", "created_at"},
+		references: map[string]string{"user_id": "users"},
+		orderBy:    "id",
+	},
+	{
+		name:       "categories",
+		hasID:      true,
+		columns:    []string{"user_id", "parent_id", "name", "created_at", "updated_at"},
+		references: map[string]string{"user_id": "users"},
+		orderBy:    "id",
+		deferred:   map[string]string{"parent_id": "categories"},
+	},
+	{
+		name:       "accounts",
+		hasID:      true,
+		columns:    []string{"user_id", "currency_name", "name", "initial_balance", "created_at", "updated_at"},
+		references: map[string]string{"user_id": "users"},
+		orderBy:    "id",
+	},
+	{
+		name:       "transfers",
+		hasID:      true,
+		columns:    []string{"from_account_id", "to_account_id", "description", "value", "rate", "date", "created_at", "updated_at"},
+		references: map[string]string{"from_account_id": "accounts", "to_account_id": "accounts"},
+		orderBy:    "id",
+	},
+	{
+		name:       "transactions",
+		hasID:      true,
+		columns:    []string{"account_id", "transfer_id", "description", "value", "type", "date", "external_id", "created_at", "updated_at"},
+		references: map[string]string{"account_id": "accounts", "transfer_id": "transfers"},
+		orderBy:    "id",
+	},
+	{
+		name:       "transactions_categories",
+		columns:    []string{"transaction_id", "category_id", "amount"},
+		references: map[string]string{"transaction_id": "transactions", "category_id": "categories"},
+		orderBy:    "transaction_id, category_id",
+	},
+	{
+		name:       "budgets",
+		hasID:      true,
+		columns:    []string{"user_id", "category_id", "period", "amount", "currency_name", "rollover", "start_date", "created_at", "updated_at"},
+		references: map[string]string{"user_id": "users", "category_id": "categories"},
+		orderBy:    "id",
+	},
+	{
+		name:       "recurring_transactions",
+		hasID:      true,
+		columns:    []string{"account_id", "description", "value", "type", "frequency", "interval", "start_date", "end_date", "count", "created_at", "updated_at"},
+		references: map[string]string{"account_id": "accounts"},
+		orderBy:    "id",
+	},
+	{
+		name:       "recurring_transactions_categories",
+		columns:    []string{"recurring_transaction_id", "category_id"},
+		references: map[string]string{"recurring_transaction_id": "recurring_transactions", "category_id": "categories"},
+		orderBy:    "recurring_transaction_id, category_id",
+	},
+	{
+		name:       "recurring_transactions_occurrences",
+		columns:    []string{"recurring_transaction_id", "date", "transaction_id"},
+		references: map[string]string{"recurring_transaction_id": "recurring_transactions", "transaction_id": "transactions"},
+		orderBy:    "recurring_transaction_id, date",
+	},
+	{
+		name:       "rules",
+		hasID:      true,
+		columns:    []string{"user_id", "name", "priority", "description", "match", "min_value", "max_value", "account_id", "type", "created_at", "updated_at"},
+		references: map[string]string{"user_id": "users", "account_id": "accounts"},
+		orderBy:    "id",
+	},
+	{
+		name:       "rules_categories",
+		columns:    []string{"rule_id", "category_id"},
+		references: map[string]string{"rule_id": "rules", "category_id": "categories"},
+		orderBy:    "rule_id, category_id",
+	},
+}
+
+// restoreRequiresEmpty are the tables that must be empty to restore.
+// Currencies and rates may already have been scraped and users may have registered,
+// like the admin restoring through the API, their data is added to them.
+var restoreRequiresEmpty = []string{"accounts", "categories", "transactions"}
+
+// Backup writes every table of the instance to w as a gzipped JSON Lines archive,
+// from a single snapshot of the database
+func Backup(db *sql.DB, w io.Writer) (err error) {
+	tx, err := db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	archive := gzip.NewWriter(w)
+	encoder := json.NewEncoder(archive)
+
+	err = encoder.Encode(backupHeader{
+		Format:    backupFormat,
+		Version:   backupVersion,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return
+	}
+
+	for _, table := range backupTables {
+		err = table.backup(tx, encoder)
+		if err != nil {
+			return fmt.Errorf("backup of %s: %s", table.name, err)
+		}
+	}
+
+	return archive.Close()
+}
+
+// quotedColumns returns the columns ready to be used in a query, some of them, like interval, are keywords
+func (table backupTable) quotedColumns(withID bool) string {
+	columns := []string{}
+	if withID && table.hasID {
+		columns = append(columns, "id")
+	}
+
+	for _, column := range table.columns {
+		columns = append(columns, pq.QuoteIdentifier(column))
+	}
+
+	return strings.Join(columns, ", ")
+}
+
+func (table backupTable) backup(tx *sql.Tx, encoder *json.Encoder) error {
+	rows, err := tx.Query(fmt.Sprintf(
+		"SELECT row_to_json(r) FROM (SELECT %s FROM %s ORDER BY %s) r",
+		table.quotedColumns(true),
+		table.name,
+		table.orderBy,
+	))
+
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row []byte
+		errScan := rows.Scan(&row)
+		if errScan != nil {
+			return errScan
+		}
+
+		errEncode := encoder.Encode(backupLine{Table: table.name, Row: row})
+		if errEncode != nil {
+			return errEncode
+		}
+	}
+
+	return rows.Err()
+}
+
+// Restore reads an archive from Backup into a database without accounts, categories or transactions,
+// in a single transaction. Rows get new ids, returns how many rows of each table were restored.
+func Restore(db *sql.DB, r io.Reader) (restored map[string]int, err error) {
+	archive, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backup: %s", err)
+	}
+
+	decoder := json.NewDecoder(archive)
+
+	var header backupHeader
+	err = decoder.Decode(&header)
+	if err != nil || header.Format != backupFormat {
+		return nil, errors.New("invalid backup: missing header")
+	}
+
+	if header.Version != backupVersion {
+		return nil, fmt.Errorf("backup version %d is not supported, expected %d", header.Version, backupVersion)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	for _, name := range restoreRequiresEmpty {
+		var exists bool
+		err = tx.QueryRow(fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s)", name)).Scan(&exists)
+		if err != nil {
+			return
+		}
+
+		if exists {
+			return nil, fmt.Errorf("database is not empty, %s already exist", name)
+		}
+	}
+
+	tables := map[string]backupTable{}
+	for _, table := range backupTables {
+		tables[table.name] = table
+	}
+
+	ids := map[string]map[int64]int64{}
+	deferred := []backupDeferred{}
+	restored = map[string]int{}
+
+	for line := 2; ; line++ {
+		var row backupLine
+		err = decoder.Decode(&row)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid backup: line %d: %s", line, err)
+		}
+
+		table, ok := tables[row.Table]
+		if !ok {
+			return nil, fmt.Errorf("invalid backup: line %d: unknown table '%s'", line, row.Table)
+		}
+
+		inserted, errRestore := table.restore(tx, row.Row, ids, &deferred)
+		if errRestore != nil {
+			return nil, fmt.Errorf("line %d: %s", line, errRestore)
+		}
+
+		if inserted {
+			restored[table.name]++
+		}
+	}
+
+	for _, reference := range deferred {
+		newID, ok := ids[reference.referenced][reference.oldID]
+		if !ok {
+			return nil, fmt.Errorf("%s.%s references %s %d, which is not in the backup", reference.table, reference.column, reference.referenced, reference.oldID)
+		}
+
+		_, err = tx.Exec(
+			fmt.Sprintf("UPDATE %s SET %s = $1 WHERE id = $2", reference.table, pq.QuoteIdentifier(reference.column)),
+			newID,
+			reference.id,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// archives from before the amounts of the categories have the values divided evenly
+	_, err = tx.Exec(splitEvenlySQL)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return restored, nil
+}
+
+// restore inserts a row, replacing the references by the new ids and saving its own new id,
+// deferred references are inserted as null and added to deferred
+func (table backupTable) restore(tx *sql.Tx, data json.RawMessage, ids map[string]map[int64]int64, deferred *[]backupDeferred) (inserted bool, err error) {
+	var row map[string]json.RawMessage
+	err = json.Unmarshal(data, &row)
+	if err != nil {
+		return
+	}
+
+	pending := []backupDeferred{}
+	for column, referenced := range table.deferred {
+		value, ok := row[column]
+		if !ok || string(value) == "null" {
+			continue
+		}
+
+		oldID, errID := strconv.ParseInt(string(value), 10, 64)
+		if errID != nil {
+			return false, fmt.Errorf("%s.%s must be an id", table.name, column)
+		}
+
+		pending = append(pending, backupDeferred{table: table.name, column: column, referenced: referenced, oldID: oldID})
+		row[column] = json.RawMessage("null")
+	}
+
+	for column, referenced := range table.references {
+		value, ok := row[column]
+		if !ok || string(value) == "null" {
+			continue
+		}
+
+		oldID, errID := strconv.ParseInt(string(value), 10, 64)
+		if errID != nil {
+			return false, fmt.Errorf("%s.%s must be an id", table.name, column)
+		}
+
+		newID, ok := ids[referenced][oldID]
+		if !ok {
+			return false, fmt.Errorf("%s.%s references %s %d, which is not in the backup", table.name, column, referenced, oldID)
+		}
+
+		row[column] = json.RawMessage(strconv.FormatInt(newID, 10))
+	}
+
+	var oldID int64
+	if table.hasID {
+		oldID, err = strconv.ParseInt(string(row["id"]), 10, 64)
+		if err != nil {
+			return false, fmt.Errorf("%s.id must be an id", table.name)
+		}
+	}
+
+	data, err = json.Marshal(row)
+	if err != nil {
+		return
+	}
+
+	if table.matchBy != "" {
+		var existingID int64
+		err = tx.QueryRow(
+			fmt.Sprintf("SELECT e.id FROM %s e, json_populate_record(NULL::%s, $1) r WHERE e.%s = r.%s", table.name, table.name, table.matchBy, table.matchBy),
+			string(data),
+		).Scan(&existingID)
+
+		if err == nil {
+			if ids[table.name] == nil {
+				ids[table.name] = map[int64]int64{}
+			}
+			ids[table.name][oldID] = existingID
+
+			return false, nil
+		}
+
+		if err != sql.ErrNoRows {
+			return
+		}
+	}
+
+	columns := table.quotedColumns(false)
+	query := fmt.Sprintf(
+		"INSERT INTO %s (%s) SELECT %s FROM json_populate_record(NULL::%s, $1) r",
+		table.name,
+		columns,
+		columns,
+		table.name,
+	)
+	if table.restoreWhere != "" {
+		query += " WHERE " + table.restoreWhere
+	}
+	if table.hasID {
+		query += " RETURNING id"
+	}
+
+	if !table.hasID {
+		result, errExec := tx.Exec(query, string(data))
+		if errExec != nil {
+			return false, errExec
+		}
+
+		affected, errAffected := result.RowsAffected()
+		return affected > 0, errAffected
+	}
+
+	var newID int64
+	err = tx.QueryRow(query, string(data)).Scan(&newID)
+	if err == sql.ErrNoRows {
+		// skipped by restoreWhere
+		return false, nil
+	}
+	if err != nil {
+		return
+	}
+
+	if ids[table.name] == nil {
+		ids[table.name] = map[int64]int64{}
+	}
+	ids[table.name][oldID] = newID
+
+	for _, reference := range pending {
+		reference.id = newID
+		*deferred = append(*deferred, reference)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Backup streams an archive of the whole instance, only for admins
+func (s *Server) Backup(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(currentUser(r)) {
+		respondWithError(w, "only admins can backup", http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="fin-%s.jsonl.gz"`, time.Now().Format("20060102150405")))
+
+	backupWriter := &exportResponseWriter{ResponseWriter: w}
+	err := Backup(s.db, backupWriter)
+	if err != nil {
+		if !backupWriter.written {
+			respondWithError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		log.Println(fmt.Sprintf("backup failed: %s", err))
+	}
+	return
+}
+
+// Restore reads an archive from the request body into an empty instance, only for admins
+func (s *Server) Restore(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(currentUser(r)) {
+		respondWithError(w, "only admins can restore", http.StatusForbidden)
+		return
+	}
+
+	restored, err := Restore(s.db, r.Body)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	respondWithJSON(w, restored, http.StatusOK)
+	return
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/jonatasbaldin/fin/test"
+)
+
+func TestBackupRequiresAdmin(t *testing.T) {
+	response := Request(s.router, "GET", "/admin/backup", nil)
+	assert.Equal(t, http.StatusForbidden, response.Code)
+
+	response = Request(s.router, "POST", "/admin/restore", nil)
+	assert.Equal(t, http.StatusForbidden, response.Code)
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	ClearDB(s.db)
+
+	s.adminEmails = map[string]bool{testUser.Email: true}
+	defer func() { s.adminEmails = map[string]bool{} }()
+
+	currency := Currency{
+		Name: "EUR",
+	}
+	currency.Create(s.db)
+	account := Account{
+		UserID:         testUser.ID,
+		Currency:       currency,
+		Name:           "Bank",
+		InitialBalance: Decimal("100.00"),
+	}
+	account.Create(s.db)
+	category := Category{
+		UserID: testUser.ID,
+		Name:   "Food",
+	}
+	category.Create(s.db)
+	transaction := Transaction{
+		Account:     account,
+		Description: "Coffee",
+		Value:       Decimal("3.50"),
+		Type:        "EXPENSE",
+		Date:        "2019-01-05",
+		Categories:  []Category{category},
+	}
+	transaction.Create(s.db)
+	budget := Budget{
+		UserID:   testUser.ID,
+		Category: category,
+		Period:   "MONTHLY",
+		Amount:   Decimal("200.00"),
+		Currency: currency,
+	}
+	budget.Create(s.db)
+
+	response := Request(s.router, "GET", "/admin/backup", nil)
+	assert.Equal(t, http.StatusOK, response.Code)
+	archive := response.Body.Bytes()
+
+	response = Request(s.router, "POST", "/admin/restore", bytes.NewReader(archive))
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+
+	var err CustomError
+	json.Unmarshal(response.Body.Bytes(), &err)
+	assert.Equal(t, err.Error, "database is not empty, accounts already exist")
+
+	ClearDB(s.db)
+
+	response = Request(s.router, "POST", "/admin/restore", bytes.NewReader(archive))
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	var restored map[string]int
+	json.Unmarshal(response.Body.Bytes(), &restored)
+
+	// the user restoring already exists, its data is added to it
+	assert.Equal(t, restored["users"], 0)
+	assert.Equal(t, restored["accounts"], 1)
+	assert.Equal(t, restored["transactions"], 1)
+	assert.Equal(t, restored["transactions_categories"], 1)
+	assert.Equal(t, restored["budgets"], 1)
+
+	accounts, _ := ListAccounts(s.db, testUser.ID, "")
+	assert.Equal(t, len(accounts), 1)
+	assert.Equal(t, accounts[0].Name, "Bank")
+	assert.Equal(t, accounts[0].Balance.String(), "96.5")
+
+	transactions, _ := ListTransactions(s.db, accounts[0].ID, TransactionFilter{})
+	assert.Equal(t, len(transactions), 1)
+	assert.Equal(t, transactions[0].Date, "2019-01-05")
+	assert.Equal(t, transactions[0].Categories[0].Name, "Food")
+
+	budgets, _ := ListBudgets(s.db, testUser.ID)
+	assert.Equal(t, len(budgets), 1)
+	assert.Equal(t, budgets[0].Category.ID, transactions[0].Categories[0].ID)
+}
+
+func TestRestoreInvalidArchive(t *testing.T) {
+	s.adminEmails = map[string]bool{testUser.Email: true}
+	defer func() { s.adminEmails = map[string]bool{} }()
+
+	response := Request(s.router, "POST", "/admin/restore", bytes.NewBufferString("date,description,amount\n"))
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+
+	var err CustomError
+	json.Unmarshal(response.Body.Bytes(), &err)
+	assert.Equal(t, err.Error, "invalid backup: gzip: invalid header")
+}
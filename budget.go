@@ -0,0 +1,371 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/shopspring/decimal"
+)
+
+// Budget limits the EXPENSE transactions of a Category in each period,
+// with Rollover the amount not spent in a period is added to the next one
+type Budget struct {
+	ID        int             `json:"id"`
+	UserID    int             `json:"-"`
+	Category  Category        `json:"category"`
+	Period    string          `json:"period"`
+	Amount    decimal.Decimal `json:"amount"`
+	Currency  Currency        `json:"currency"`
+	Rollover  bool            `json:"rollover"`
+	StartDate string          `json:"start_date"`
+	CreatedAt string          `json:"created_at"`
+	UpdatedAt string          `json:"updated_at"`
+}
+
+// BudgetStatus is how much of a Budget was spent in the period containing a date
+type BudgetStatus struct {
+	Budget      Budget          `json:"budget"`
+	PeriodStart string          `json:"period_start"`
+	PeriodEnd   string          `json:"period_end"`
+	Amount      decimal.Decimal `json:"amount"`
+	RolledOver  decimal.Decimal `json:"rolled_over"`
+	Available   decimal.Decimal `json:"available"`
+	Spent       decimal.Decimal `json:"spent"`
+	Remaining   decimal.Decimal `json:"remaining"`
+	OverBudget  bool            `json:"over_budget"`
+}
+
+const budgetColumns = `b.id, b.user_id, b.category_id, b.period, b.amount, b.currency_name, b.rollover, to_char(b.start_date, 'YYYY-MM-DD'), b.created_at, b.updated_at`
+
+func ListBudgets(db *sql.DB, userID int) ([]Budget, error) {
+	rows, err := db.Query(
+		`SELECT `+budgetColumns+` FROM budgets b WHERE b.user_id = $1 ORDER BY b.id`, userID,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	budgets := []Budget{}
+
+	for rows.Next() {
+		var budget Budget
+		errScan := budget.scan(rows)
+		if errScan != nil {
+			return nil, errScan
+		}
+
+		budgets = append(budgets, budget)
+	}
+
+	for index := range budgets {
+		errCategory := budgets[index].loadRelations(db)
+		if errCategory != nil {
+			return nil, errCategory
+		}
+	}
+
+	return budgets, nil
+}
+
+func GetBudget(db *sql.DB, userID int, id int) (budget Budget, err error) {
+	row := db.QueryRow(
+		`SELECT `+budgetColumns+` FROM budgets b WHERE b.id = $1 AND b.user_id = $2`, id, userID,
+	)
+
+	err = budget.scan(row)
+	if err != nil {
+		return
+	}
+
+	err = budget.loadRelations(db)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func (budget *Budget) scan(row rowScanner) error {
+	return row.Scan(
+		&budget.ID,
+		&budget.UserID,
+		&budget.Category.ID,
+		&budget.Period,
+		&budget.Amount,
+		&budget.Currency.Name,
+		&budget.Rollover,
+		&budget.StartDate,
+		&budget.CreatedAt,
+		&budget.UpdatedAt,
+	)
+}
+
+// loadRelations fills the Category and the Currency, checking both exist and the Category belongs to the User
+func (budget *Budget) loadRelations(db *sql.DB) (err error) {
+	budget.Category, err = GetCategory(db, budget.UserID, budget.Category.ID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("category %d not found", budget.Category.ID)
+	}
+	if err != nil {
+		return
+	}
+
+	currencyName := budget.Currency.Name
+	budget.Currency, err = GetCurrency(db, currencyName)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("currency '%s' not found", currencyName)
+	}
+	if err != nil {
+		return
+	}
+
+	// the rates are not needed to read a budget
+	budget.Currency.CleanRates()
+
+	return
+}
+
+func (budget *Budget) Create(db *sql.DB) (err error) {
+	err = budget.loadRelations(db)
+	if err != nil {
+		return
+	}
+
+	createdAt := time.Now()
+
+	if budget.StartDate == "" {
+		budget.StartDate = createdAt.Format(dateLayout)
+	}
+
+	err = db.QueryRow(
+		`INSERT INTO budgets(user_id, category_id, period, amount, currency_name, rollover, start_date, created_at, updated_at)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, created_at, updated_at`,
+		budget.UserID,
+		budget.Category.ID,
+		budget.Period,
+		budget.Amount,
+		budget.Currency.Name,
+		budget.Rollover,
+		budget.StartDate,
+		createdAt,
+		createdAt,
+	).Scan(&budget.ID, &budget.CreatedAt, &budget.UpdatedAt)
+
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (budget *Budget) Update(db *sql.DB) (err error) {
+	err = budget.loadRelations(db)
+	if err != nil {
+		return
+	}
+
+	updatedAt := time.Now()
+
+	err = db.QueryRow(
+		`UPDATE budgets
+		SET category_id = $1, period = $2, amount = $3, currency_name = $4, rollover = $5, start_date = $6, updated_at = $7
+		WHERE id = $8 AND user_id = $9
+		RETURNING updated_at`,
+		budget.Category.ID,
+		budget.Period,
+		budget.Amount,
+		budget.Currency.Name,
+		budget.Rollover,
+		budget.StartDate,
+		updatedAt,
+		budget.ID,
+		budget.UserID,
+	).Scan(&budget.UpdatedAt)
+
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (budget *Budget) Delete(db *sql.DB) (err error) {
+	_, err = db.Exec(
+		"DELETE FROM budgets WHERE id = $1 AND user_id = $2",
+		budget.ID,
+		budget.UserID,
+	)
+
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// Status calculates the spending of the period containing date,
+// with Rollover, every period since StartDate adds what was left unspent to the next one
+func (budget Budget) Status(db *sql.DB, date time.Time) (status BudgetStatus, err error) {
+	start, end := budgetPeriod(budget.Period, date)
+
+	firstStart := start
+	if budget.Rollover {
+		startDate, errDate := time.Parse(dateLayout, budget.StartDate)
+		if errDate != nil {
+			return status, errDate
+		}
+
+		firstStart, _ = budgetPeriod(budget.Period, startDate)
+	}
+
+	spentByPeriod, err := budget.spentByPeriod(db, firstStart, end)
+	if err != nil {
+		return
+	}
+
+	rolledOver := decimal.New(0, 0)
+	if budget.Rollover {
+		for periodStart := firstStart; periodStart.Before(start); {
+			_, periodEnd := budgetPeriod(budget.Period, periodStart)
+			key := periodStart.Format(dateLayout)
+
+			rolledOver = rolledOver.Add(budget.Amount).Sub(spentByPeriod[key])
+			// only unused amounts roll over, overspending doesn't reduce the next periods
+			if rolledOver.LessThan(decimal.New(0, 0)) {
+				rolledOver = decimal.New(0, 0)
+			}
+
+			periodStart = periodEnd.AddDate(0, 0, 1)
+		}
+	}
+
+	status.Budget = budget
+	status.PeriodStart = start.Format(dateLayout)
+	status.PeriodEnd = end.Format(dateLayout)
+	status.Amount = budget.Amount
+	status.RolledOver = roundMoney(rolledOver)
+	status.Available = roundMoney(budget.Amount.Add(rolledOver))
+	status.Spent = roundMoney(spentByPeriod[status.PeriodStart])
+	status.Remaining = status.Available.Sub(status.Spent)
+	status.OverBudget = status.Remaining.LessThan(decimal.New(0, 0))
+
+	return
+}
+
+// spentByPeriod sums the amounts in the Category of the EXPENSE transactions between from and to,
+// converted to the Budget currency at their dates and grouped by the start of their period
+func (budget Budget) spentByPeriod(db *sql.DB, from time.Time, to time.Time) (map[string]decimal.Decimal, error) {
+	rows, err := db.Query(
+		`SELECT a.currency_name, to_char(t.date, 'YYYY-MM-DD'), SUM(tc.amount)
+		FROM transactions t
+		INNER JOIN accounts a ON (t.account_id = a.id)
+		INNER JOIN transactions_categories tc ON (tc.transaction_id = t.id)
+		WHERE a.user_id = $1 AND tc.category_id = $2 AND t.type = 'EXPENSE' AND t.date >= $3 AND t.date <= $4
+		GROUP BY a.currency_name, t.date`,
+		budget.UserID,
+		budget.Category.ID,
+		from.Format(dateLayout),
+		to.Format(dateLayout),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	type dailyTotal struct {
+		currencyName string
+		date         string
+		total        decimal.Decimal
+	}
+
+	totals := []dailyTotal{}
+
+	for rows.Next() {
+		var daily dailyTotal
+		errScan := rows.Scan(&daily.currencyName, &daily.date, &daily.total)
+		if errScan != nil {
+			return nil, errScan
+		}
+
+		totals = append(totals, daily)
+	}
+
+	converter := newRateConverter(db, budget.Currency.Name)
+	spent := map[string]decimal.Decimal{}
+
+	for _, daily := range totals {
+		converted, errConvert := converter.convert(daily.total, daily.currencyName, daily.date)
+		if errConvert != nil {
+			return nil, errConvert
+		}
+
+		day, _ := time.Parse(dateLayout, daily.date)
+		start, _ := budgetPeriod(budget.Period, day)
+		key := start.Format(dateLayout)
+		spent[key] = spent[key].Add(converted)
+	}
+
+	return spent, nil
+}
+
+// budgetPeriod returns the first and last days of the period containing date,
+// weeks start on Monday
+func budgetPeriod(period string, date time.Time) (start time.Time, end time.Time) {
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+
+	switch period {
+	case "WEEKLY":
+		start = day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+		end = start.AddDate(0, 0, 6)
+	case "YEARLY":
+		start = time.Date(day.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+		end = start.AddDate(1, 0, -1)
+	default:
+		start = time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+		end = start.AddDate(0, 1, -1)
+	}
+
+	return
+}
+
+func (budget Budget) Validate() (err error) {
+	if budget.Category.ID == 0 {
+		err = errors.New("field 'category.id' must not be empty")
+	}
+
+	periodCheck := regexp.MustCompile(`^(WEEKLY|MONTHLY|YEARLY)$`)
+	if !periodCheck.MatchString(budget.Period) {
+		err = errors.New("field 'period' must be 'WEEKLY', 'MONTHLY' or 'YEARLY'")
+	}
+
+	if budget.Amount.LessThanOrEqual(decimal.NewFromFloat(0)) != false {
+		err = errors.New("field 'amount' must be more than 0")
+	}
+
+	valueCheck := regexp.MustCompile(`^\d*(\.\d{1,2}|\d)$`)
+	if !valueCheck.MatchString(budget.Amount.String()) {
+		err = errors.New("field 'amount' must be like 1.99")
+	}
+
+	if budget.Currency.Name == "" {
+		err = errors.New("field 'currency.name' must not be empty")
+	}
+
+	if budget.StartDate != "" {
+		if _, errDate := time.Parse(dateLayout, budget.StartDate); errDate != nil {
+			err = errors.New("field 'start_date' must be like 2019-01-31")
+		}
+	}
+
+	return
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func (s *Server) ListBudgets(w http.ResponseWriter, r *http.Request) {
+	budgets, err := ListBudgets(s.db, currentUser(r).ID)
+
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, budgets, http.StatusOK)
+	return
+}
+
+func (s *Server) CreateBudget(w http.ResponseWriter, r *http.Request) {
+	var budget Budget
+	json.NewDecoder(r.Body).Decode(&budget)
+	budget.Period = strings.ToUpper(budget.Period)
+
+	err := validateRequest(budget)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	budget.UserID = currentUser(r).ID
+	err = budget.Create(s.db)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	respondWithJSON(w, budget, http.StatusCreated)
+	return
+}
+
+func (s *Server) GetBudget(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	budgetID, _ := strconv.Atoi(vars["id"])
+	budget, err := GetBudget(s.db, currentUser(r).ID, budgetID)
+
+	if err == sql.ErrNoRows {
+		respondWithError(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, budget, http.StatusOK)
+	return
+}
+
+func (s *Server) UpdateBudget(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	budgetID, _ := strconv.Atoi(vars["id"])
+	budget, err := GetBudget(s.db, currentUser(r).ID, budgetID)
+
+	if err == sql.ErrNoRows {
+		respondWithError(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewDecoder(r.Body).Decode(&budget)
+	budget.Period = strings.ToUpper(budget.Period)
+
+	err = validateRequest(budget)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = budget.Update(s.db)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	respondWithJSON(w, budget, http.StatusOK)
+	return
+}
+
+func (s *Server) DeleteBudget(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	budgetID, _ := strconv.Atoi(vars["id"])
+	budget, err := GetBudget(s.db, currentUser(r).ID, budgetID)
+
+	if err == sql.ErrNoRows {
+		respondWithError(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = budget.Delete(s.db)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, nil, http.StatusNoContent)
+	return
+}
+
+// GetBudgetStatus returns the spending of the period containing '?date=', today by default
+func (s *Server) GetBudgetStatus(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	budgetID, _ := strconv.Atoi(vars["id"])
+
+	date := time.Now()
+	if value := r.URL.Query().Get("date"); value != "" {
+		var err error
+		date, err = time.Parse(dateLayout, value)
+		if err != nil {
+			respondWithError(w, fmt.Sprintf("parameter 'date' must be like %s", dateLayout), http.StatusBadRequest)
+			return
+		}
+	}
+
+	budget, err := GetBudget(s.db, currentUser(r).ID, budgetID)
+
+	if err == sql.ErrNoRows {
+		respondWithError(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	status, err := budget.Status(s.db, date)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	respondWithJSON(w, status, http.StatusOK)
+	return
+}
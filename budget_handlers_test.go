@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/jonatasbaldin/fin/test"
+)
+
+func TestCreateBudget(t *testing.T) {
+	ClearDB(s.db)
+
+	currency := Currency{
+		Name: "USD",
+	}
+	currency.Create(s.db)
+	category := Category{
+		UserID: testUser.ID,
+		Name:   "Food",
+	}
+	category.Create(s.db)
+
+	body := []byte(fmt.Sprintf(`{"category": {"id": %d}, "period": "monthly", "amount": 300, "currency": {"name": "USD"}}`, category.ID))
+	response := Request(s.router, "POST", "/budgets", bytes.NewBuffer(body))
+	assert.Equal(t, http.StatusCreated, response.Code)
+
+	var respBudget Budget
+	json.Unmarshal(response.Body.Bytes(), &respBudget)
+
+	assert.Equal(t, respBudget.Period, "MONTHLY")
+	assert.Equal(t, respBudget.Category.Name, "Food")
+	assert.Equal(t, respBudget.Amount.String(), "300")
+	assert.Equal(t, respBudget.StartDate, time.Now().Format(dateLayout))
+
+	response = Request(s.router, "GET", "/budgets", nil)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	var respBudgets []Budget
+	json.Unmarshal(response.Body.Bytes(), &respBudgets)
+
+	assert.Equal(t, len(respBudgets), 1)
+}
+
+func TestValidateBudgetPeriod(t *testing.T) {
+	ClearDB(s.db)
+
+	body := []byte(`{"category": {"id": 1}, "period": "daily", "amount": 300, "currency": {"name": "USD"}}`)
+	response := Request(s.router, "POST", "/budgets", bytes.NewBuffer(body))
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+
+	var err CustomError
+	json.Unmarshal(response.Body.Bytes(), &err)
+
+	assert.Equal(t, err.Error, "field 'period' must be 'WEEKLY', 'MONTHLY' or 'YEARLY'")
+}
+
+func TestBudgetStatus(t *testing.T) {
+	ClearDB(s.db)
+
+	currencyBrl := Currency{
+		Name: "BRL",
+	}
+	currencyBrl.Create(s.db)
+	currency := Currency{
+		Name: "USD",
+	}
+	currency.Create(s.db)
+	s.db.Exec(
+		`INSERT INTO rates(currency_name, name, symbol, value, created_at, updated_at)
+		VALUES ('BRL', 'USD', '$', 0.25, '2019-01-01', '2019-01-01')`,
+	)
+	account := Account{
+		UserID:         testUser.ID,
+		Currency:       currency,
+		Name:           "Wallet",
+		InitialBalance: Decimal("1000.00"),
+	}
+	account.Create(s.db)
+	carteira := Account{
+		UserID:         testUser.ID,
+		Currency:       currencyBrl,
+		Name:           "Carteira",
+		InitialBalance: Decimal("1000.00"),
+	}
+	carteira.Create(s.db)
+	category := Category{
+		UserID: testUser.ID,
+		Name:   "Food",
+	}
+	category.Create(s.db)
+	budget := Budget{
+		UserID:    testUser.ID,
+		Category:  category,
+		Period:    "MONTHLY",
+		Amount:    Decimal("100.00"),
+		Currency:  currency,
+		StartDate: "2019-01-01",
+	}
+	budget.Create(s.db)
+
+	transactions := []Transaction{
+		{Account: account, Value: Decimal("80.00"), Date: "2019-02-03"},
+		{Account: carteira, Value: Decimal("100.00"), Date: "2019-02-10"},
+		{Account: account, Value: Decimal("500.00"), Date: "2019-03-01"},
+	}
+	for _, transaction := range transactions {
+		transaction.Description = "Groceries"
+		transaction.Type = "EXPENSE"
+		transaction.Categories = []Category{category}
+		transaction.Create(s.db)
+	}
+
+	response := Request(s.router, "GET", fmt.Sprintf("/budgets/%d/status?date=2019-02-15", budget.ID), nil)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	var status BudgetStatus
+	json.Unmarshal(response.Body.Bytes(), &status)
+
+	assert.Equal(t, status.PeriodStart, "2019-02-01")
+	assert.Equal(t, status.PeriodEnd, "2019-02-28")
+	assert.Equal(t, status.Spent.String(), "105")
+	assert.Equal(t, status.Remaining.String(), "-5")
+	assert.True(t, status.OverBudget)
+}
+
+func TestBudgetStatusRollover(t *testing.T) {
+	ClearDB(s.db)
+
+	currency := Currency{
+		Name: "USD",
+	}
+	currency.Create(s.db)
+	account := Account{
+		UserID:         testUser.ID,
+		Currency:       currency,
+		Name:           "Wallet",
+		InitialBalance: Decimal("1000.00"),
+	}
+	account.Create(s.db)
+	category := Category{
+		UserID: testUser.ID,
+		Name:   "Food",
+	}
+	category.Create(s.db)
+	budget := Budget{
+		UserID:    testUser.ID,
+		Category:  category,
+		Period:    "MONTHLY",
+		Amount:    Decimal("100.00"),
+		Currency:  currency,
+		Rollover:  true,
+		StartDate: "2019-01-10",
+	}
+	budget.Create(s.db)
+
+	transactions := []Transaction{
+		{Account: account, Value: Decimal("60.00"), Date: "2019-01-15"},
+		{Account: account, Value: Decimal("150.00"), Date: "2019-02-15"},
+		{Account: account, Value: Decimal("30.00"), Date: "2019-03-15"},
+	}
+	for _, transaction := range transactions {
+		transaction.Description = "Groceries"
+		transaction.Type = "EXPENSE"
+		transaction.Categories = []Category{category}
+		transaction.Create(s.db)
+	}
+
+	// January leaves 40, February spends all of it and more, so nothing is left for March
+	status, err := budget.Status(s.db, time.Date(2019, 3, 20, 0, 0, 0, 0, time.UTC))
+	assert.Nil(t, err)
+	assert.Equal(t, status.RolledOver.String(), "0")
+	assert.Equal(t, status.Remaining.String(), "70")
+
+	status, err = budget.Status(s.db, time.Date(2019, 2, 20, 0, 0, 0, 0, time.UTC))
+	assert.Nil(t, err)
+	assert.Equal(t, status.RolledOver.String(), "40")
+	assert.Equal(t, status.Available.String(), "140")
+	assert.Equal(t, status.Remaining.String(), "-10")
+}
+
+func TestBudgetPeriod(t *testing.T) {
+	date := time.Date(2019, 2, 14, 0, 0, 0, 0, time.UTC)
+
+	start, end := budgetPeriod("WEEKLY", date)
+	assert.Equal(t, start.Format(dateLayout), "2019-02-11")
+	assert.Equal(t, end.Format(dateLayout), "2019-02-17")
+
+	start, end = budgetPeriod("MONTHLY", date)
+	assert.Equal(t, start.Format(dateLayout), "2019-02-01")
+	assert.Equal(t, end.Format(dateLayout), "2019-02-28")
+
+	start, end = budgetPeriod("YEARLY", date)
+	assert.Equal(t, start.Format(dateLayout), "2019-01-01")
+	assert.Equal(t, end.Format(dateLayout), "2019-12-31")
+}
@@ -7,17 +7,26 @@ import (
 	"time"
 
 	_ "github.com/lib/pq"
+	"github.com/shopspring/decimal"
 )
 
+// Category can be inside another one, its parent, like Restaurants inside Food.
+// In the categories of a Transaction, Amount is the part of its value in the category.
 type Category struct {
-	ID        int    `json:"id"`
-	Name      string `json:"name"`
-	CreatedAt string `json:"created_at"`
-	UpdatedAt string `json:"updated_at"`
+	ID        int              `json:"id"`
+	UserID    int              `json:"-"`
+	ParentID  *int             `json:"parent_id"`
+	Name      string           `json:"name"`
+	Children  []Category       `json:"children,omitempty"`
+	Amount    *decimal.Decimal `json:"amount,omitempty"`
+	CreatedAt string           `json:"created_at"`
+	UpdatedAt string           `json:"updated_at"`
 }
 
-func ListCategories(db *sql.DB) ([]Category, error) {
-	rows, err := db.Query("SELECT id, name, created_at, updated_at FROM categories")
+func ListCategories(db *sql.DB, userID int) ([]Category, error) {
+	rows, err := db.Query(
+		"SELECT id, user_id, parent_id, name, created_at, updated_at FROM categories WHERE user_id = $1 ORDER BY id", userID,
+	)
 
 	if err != nil {
 		return nil, err
@@ -29,6 +38,8 @@ func ListCategories(db *sql.DB) ([]Category, error) {
 		var category Category
 		err = rows.Scan(
 			&category.ID,
+			&category.UserID,
+			&category.ParentID,
 			&category.Name,
 			&category.CreatedAt,
 			&category.UpdatedAt,
@@ -48,7 +59,9 @@ func (category *Category) Create(db *sql.DB) (err error) {
 	createdAt := time.Now()
 
 	err = db.QueryRow(
-		"INSERT INTO categories(name, created_at, updated_at) VALUES($1, $2, $3) RETURNING id, created_at, updated_at",
+		"INSERT INTO categories(user_id, parent_id, name, created_at, updated_at) VALUES($1, $2, $3, $4, $5) RETURNING id, created_at, updated_at",
+		category.UserID,
+		category.ParentID,
 		category.Name,
 		createdAt,
 		createdAt,
@@ -61,11 +74,13 @@ func (category *Category) Create(db *sql.DB) (err error) {
 	return
 }
 
-func GetCategory(db *sql.DB, id int) (category Category, err error) {
+func GetCategory(db *sql.DB, userID int, id int) (category Category, err error) {
 	err = db.QueryRow(
-		"SELECT id, name, created_at, updated_at FROM categories WHERE id = $1", id,
+		"SELECT id, user_id, parent_id, name, created_at, updated_at FROM categories WHERE id = $1 AND user_id = $2", id, userID,
 	).Scan(
 		&category.ID,
+		&category.UserID,
+		&category.ParentID,
 		&category.Name,
 		&category.CreatedAt,
 		&category.UpdatedAt,
@@ -82,11 +97,13 @@ func (category *Category) Update(db *sql.DB) (err error) {
 	updatedAt := time.Now()
 
 	err = db.QueryRow(
-		"UPDATE categories SET name = $1, updated_at = $2 WHERE id = $3 RETURNING name, updated_at",
+		"UPDATE categories SET name = $1, parent_id = $2, updated_at = $3 WHERE id = $4 AND user_id = $5 RETURNING name, parent_id, updated_at",
 		category.Name,
+		category.ParentID,
 		updatedAt,
 		category.ID,
-	).Scan(&category.Name, &category.UpdatedAt)
+		category.UserID,
+	).Scan(&category.Name, &category.ParentID, &category.UpdatedAt)
 
 	if err != nil {
 		return
@@ -95,7 +112,9 @@ func (category *Category) Update(db *sql.DB) (err error) {
 	return
 }
 
-func (category *Category) Delete(db *sql.DB) (err error) {
+// Delete removes a category without transactions. Its children are moved to its parent
+// when liftChildren is true, otherwise a category with children can't be deleted.
+func (category *Category) Delete(db *sql.DB, liftChildren bool) (err error) {
 	var count int
 	err = db.QueryRow(
 		"SELECT count(category_id) FROM transactions_categories WHERE category_id = $1",
@@ -106,22 +125,176 @@ func (category *Category) Delete(db *sql.DB) (err error) {
 		return
 	}
 
-	if count == 0 {
-		_, err = db.Exec(
-			"DELETE FROM categories WHERE id = $1",
-			category.ID,
+	var recurringCount int
+	err = db.QueryRow(
+		"SELECT count(category_id) FROM recurring_transactions_categories WHERE category_id = $1",
+		category.ID,
+	).Scan(&recurringCount)
+
+	if err != nil {
+		return
+	}
+
+	if recurringCount > 0 {
+		return fmt.Errorf("category '%d' is being used in one or more recurring transaction, please delete them first", category.ID)
+	}
+
+	var ruleCount int
+	err = db.QueryRow(
+		"SELECT count(category_id) FROM rules_categories WHERE category_id = $1",
+		category.ID,
+	).Scan(&ruleCount)
+
+	if err != nil {
+		return
+	}
+
+	if ruleCount > 0 {
+		return fmt.Errorf("category '%d' is being used in one or more rule, please delete them first", category.ID)
+	}
+
+	if count > 0 {
+		return fmt.Errorf("category '%d' is being used in one or more transaction, please delete them first", category.ID)
+	}
+
+	var childrenCount int
+	err = db.QueryRow(
+		"SELECT count(id) FROM categories WHERE parent_id = $1",
+		category.ID,
+	).Scan(&childrenCount)
+
+	if err != nil {
+		return
+	}
+
+	if childrenCount > 0 && !liftChildren {
+		return fmt.Errorf("category '%d' has children, please move or delete them first", category.ID)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		"UPDATE categories SET parent_id = $1, updated_at = $2 WHERE parent_id = $3",
+		category.ParentID,
+		time.Now(),
+		category.ID,
+	)
+
+	if err != nil {
+		return
+	}
+
+	_, err = tx.Exec(
+		"DELETE FROM categories WHERE id = $1 AND user_id = $2",
+		category.ID,
+		category.UserID,
+	)
+
+	if err != nil {
+		return
+	}
+
+	return tx.Commit()
+}
+
+// ValidateParent checks the parent belongs to the same User and, when moving a category,
+// that it isn't the category itself or one of its children, which would make a cycle
+func (category Category) ValidateParent(db *sql.DB) (err error) {
+	if category.ParentID == nil {
+		return nil
+	}
+
+	_, err = GetCategory(db, category.UserID, *category.ParentID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("parent category %d not found", *category.ParentID)
+	}
+
+	if err != nil {
+		return
+	}
+
+	if category.ID == 0 {
+		return nil
+	}
+
+	// walks up from the new parent, UNION stops at rows already seen
+	var cycle bool
+	err = db.QueryRow(
+		`WITH RECURSIVE ancestors(id, parent_id) AS (
+			SELECT id, parent_id FROM categories WHERE id = $1
+			UNION
+			SELECT c.id, c.parent_id FROM categories c INNER JOIN ancestors a ON (c.id = a.parent_id)
 		)
+		SELECT EXISTS (SELECT 1 FROM ancestors WHERE id = $2)`,
+		*category.ParentID,
+		category.ID,
+	).Scan(&cycle)
 
-		if err != nil {
-			return
-		}
-	} else {
-		err = fmt.Errorf("category '%d' is being used in one or more transaction, please delete them first", category.ID)
+	if err != nil {
 		return
+	}
 
+	if cycle {
+		return errors.New("field 'parent_id' must not be the category or one of its children")
 	}
 
-	return
+	return nil
+}
+
+// CategoryTree nests the categories inside their parents, categories whose parent
+// isn't in the list are roots
+func CategoryTree(categories []Category) []Category {
+	ids := map[int]bool{}
+	for _, category := range categories {
+		ids[category.ID] = true
+	}
+
+	children := map[int][]Category{}
+	roots := []Category{}
+
+	for _, category := range categories {
+		if category.ParentID != nil && ids[*category.ParentID] {
+			children[*category.ParentID] = append(children[*category.ParentID], category)
+		} else {
+			roots = append(roots, category)
+		}
+	}
+
+	var nest func(categories []Category) []Category
+	nest = func(categories []Category) []Category {
+		for i := range categories {
+			categories[i].Children = nest(children[categories[i].ID])
+		}
+
+		return categories
+	}
+
+	return nest(roots)
+}
+
+// categoryAncestors maps each category id to itself and the ids of its parents, up to the root
+func categoryAncestors(categories []Category) map[int][]int {
+	parents := map[int]int{}
+	for _, category := range categories {
+		if category.ParentID != nil {
+			parents[category.ID] = *category.ParentID
+		}
+	}
+
+	ancestors := map[int][]int{}
+	for _, category := range categories {
+		seen := map[int]bool{}
+		for id, ok := category.ID, true; ok && !seen[id]; id, ok = parents[id] {
+			seen[id] = true
+			ancestors[category.ID] = append(ancestors[category.ID], id)
+		}
+	}
+
+	return ancestors
 }
 
 func (category Category) Validate() (err error) {
@@ -9,14 +9,19 @@ import (
 	"github.com/gorilla/mux"
 )
 
+// ListCategories returns the categories, nested inside their parents with ?tree=true
 func (s *Server) ListCategories(w http.ResponseWriter, r *http.Request) {
-	categories, err := ListCategories(s.db)
+	categories, err := ListCategories(s.db, currentUser(r).ID)
 
 	if err != nil {
 		respondWithError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	if r.URL.Query().Get("tree") == "true" {
+		categories = CategoryTree(categories)
+	}
+
 	respondWithJSON(w, categories, http.StatusOK)
 	return
 }
@@ -31,6 +36,13 @@ func (s *Server) CreateCategory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	category.UserID = currentUser(r).ID
+	err = category.ValidateParent(s.db)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	err = category.Create(s.db)
 	if err != nil {
 		respondWithError(w, err.Error(), http.StatusInternalServerError)
@@ -44,7 +56,7 @@ func (s *Server) CreateCategory(w http.ResponseWriter, r *http.Request) {
 func (s *Server) GetCategory(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	categoryID, _ := strconv.Atoi(vars["id"])
-	category, err := GetCategory(s.db, categoryID)
+	category, err := GetCategory(s.db, currentUser(r).ID, categoryID)
 
 	if err == sql.ErrNoRows {
 		respondWithError(w, "not found", http.StatusNotFound)
@@ -63,7 +75,12 @@ func (s *Server) GetCategory(w http.ResponseWriter, r *http.Request) {
 func (s *Server) UpdateCategory(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	categoryID, _ := strconv.Atoi(vars["id"])
-	category, err := GetCategory(s.db, categoryID)
+	category, err := GetCategory(s.db, currentUser(r).ID, categoryID)
+
+	if err == sql.ErrNoRows {
+		respondWithError(w, "not found", http.StatusNotFound)
+		return
+	}
 
 	err = validateRequest(category)
 	if err != nil {
@@ -76,7 +93,14 @@ func (s *Server) UpdateCategory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// moving a category moves its children along
 	json.NewDecoder(r.Body).Decode(&category)
+	err = category.ValidateParent(s.db)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	err = category.Update(s.db)
 
 	if err != nil {
@@ -91,14 +115,20 @@ func (s *Server) UpdateCategory(w http.ResponseWriter, r *http.Request) {
 func (s *Server) DeleteCategory(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	categoryID, _ := strconv.Atoi(vars["id"])
-	category, err := GetCategory(s.db, categoryID)
+	category, err := GetCategory(s.db, currentUser(r).ID, categoryID)
+
+	if err == sql.ErrNoRows {
+		respondWithError(w, "not found", http.StatusNotFound)
+		return
+	}
 
 	if err != nil {
 		respondWithError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	err = category.Delete(s.db)
+	// ?lift_children=true moves the children to the parent of the deleted category
+	err = category.Delete(s.db, r.URL.Query().Get("lift_children") == "true")
 
 	if err != nil {
 		respondWithError(w, err.Error(), http.StatusInternalServerError)
@@ -37,7 +37,8 @@ func TestGetCategory(t *testing.T) {
 	ClearDB(s.db)
 
 	category := Category{
-		Name: "My Category",
+		UserID: testUser.ID,
+		Name:   "My Category",
 	}
 	category.Create(s.db)
 
@@ -55,7 +56,8 @@ func TestUpdateCategory(t *testing.T) {
 	ClearDB(s.db)
 
 	category := Category{
-		Name: "My Category",
+		UserID: testUser.ID,
+		Name:   "My Category",
 	}
 	category.Create(s.db)
 
@@ -78,13 +80,15 @@ func TestDeleteCategoryUsedByTransaction(t *testing.T) {
 	}
 	currency.Create(s.db)
 	account := Account{
+		UserID:         testUser.ID,
 		Currency:       currency,
 		Name:           "My Wallet",
 		InitialBalance: Decimal("100.00"),
 	}
 	account.Create(s.db)
 	category := Category{
-		Name: "Category",
+		UserID: testUser.ID,
+		Name:   "Category",
 	}
 	category.Create(s.db)
 	transaction := Transaction{
@@ -113,7 +117,8 @@ func TestDeleteCategory(t *testing.T) {
 	ClearDB(s.db)
 
 	category := Category{
-		Name: "My Category",
+		UserID: testUser.ID,
+		Name:   "My Category",
 	}
 	category.Create(s.db)
 
@@ -133,3 +138,107 @@ func TestValidateCategoryName(t *testing.T) {
 
 	assert.Equal(t, err.Error, "field `name` must not be empty")
 }
+
+func TestCategoryTree(t *testing.T) {
+	food, restaurants, pizza := 1, 2, 3
+	categories := []Category{
+		{ID: pizza, ParentID: &restaurants, Name: "Pizza"},
+		{ID: food, Name: "Food"},
+		{ID: restaurants, ParentID: &food, Name: "Restaurants"},
+		{ID: 4, Name: "Travel"},
+	}
+
+	tree := CategoryTree(categories)
+	assert.Equal(t, len(tree), 2)
+	assert.Equal(t, tree[0].Name, "Food")
+	assert.Equal(t, tree[0].Children[0].Name, "Restaurants")
+	assert.Equal(t, tree[0].Children[0].Children[0].Name, "Pizza")
+	assert.Equal(t, tree[1].Name, "Travel")
+	assert.Nil(t, tree[1].Children)
+
+	ancestors := categoryAncestors(categories)
+	assert.Equal(t, ancestors[pizza], []int{pizza, restaurants, food})
+	assert.Equal(t, ancestors[4], []int{4})
+}
+
+func TestMoveCategory(t *testing.T) {
+	ClearDB(s.db)
+
+	food := Category{
+		UserID: testUser.ID,
+		Name:   "Food",
+	}
+	food.Create(s.db)
+
+	body := []byte(fmt.Sprintf(`{"name": "Restaurants", "parent_id": %d}`, food.ID))
+	response := Request(s.router, "POST", "/categories", bytes.NewBuffer(body))
+	assert.Equal(t, http.StatusCreated, response.Code)
+
+	var restaurants Category
+	json.Unmarshal(response.Body.Bytes(), &restaurants)
+	assert.Equal(t, *restaurants.ParentID, food.ID)
+
+	response = Request(s.router, "GET", "/categories?tree=true", nil)
+	var tree []Category
+	json.Unmarshal(response.Body.Bytes(), &tree)
+	assert.Equal(t, len(tree), 1)
+	assert.Equal(t, tree[0].Children[0].ID, restaurants.ID)
+
+	// a category can't be inside itself or its children
+	for _, parentID := range []int{food.ID, restaurants.ID} {
+		body = []byte(fmt.Sprintf(`{"parent_id": %d}`, parentID))
+		response = Request(s.router, "PATCH", fmt.Sprintf("/categories/%d", food.ID), bytes.NewBuffer(body))
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+
+		var err CustomError
+		json.Unmarshal(response.Body.Bytes(), &err)
+		assert.Equal(t, err.Error, "field 'parent_id' must not be the category or one of its children")
+	}
+
+	body = []byte(`{"parent_id": 0}`)
+	response = Request(s.router, "PATCH", fmt.Sprintf("/categories/%d", food.ID), bytes.NewBuffer(body))
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+
+	// back to the top
+	body = []byte(`{"parent_id": null}`)
+	response = Request(s.router, "PATCH", fmt.Sprintf("/categories/%d", restaurants.ID), bytes.NewBuffer(body))
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	json.Unmarshal(response.Body.Bytes(), &restaurants)
+	assert.Nil(t, restaurants.ParentID)
+}
+
+func TestDeleteCategoryWithChildren(t *testing.T) {
+	ClearDB(s.db)
+
+	food := Category{
+		UserID: testUser.ID,
+		Name:   "Food",
+	}
+	food.Create(s.db)
+	restaurants := Category{
+		UserID:   testUser.ID,
+		ParentID: &food.ID,
+		Name:     "Restaurants",
+	}
+	restaurants.Create(s.db)
+	pizza := Category{
+		UserID:   testUser.ID,
+		ParentID: &restaurants.ID,
+		Name:     "Pizza",
+	}
+	pizza.Create(s.db)
+
+	response := Request(s.router, "DELETE", fmt.Sprintf("/categories/%d", restaurants.ID), nil)
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+
+	var err CustomError
+	json.Unmarshal(response.Body.Bytes(), &err)
+	assert.Equal(t, err.Error, fmt.Sprintf("category '%d' has children, please move or delete them first", restaurants.ID))
+
+	response = Request(s.router, "DELETE", fmt.Sprintf("/categories/%d?lift_children=true", restaurants.ID), nil)
+	assert.Equal(t, http.StatusNoContent, response.Code)
+
+	pizza, _ = GetCategory(s.db, testUser.ID, pizza.ID)
+	assert.Equal(t, *pizza.ParentID, food.ID)
+}
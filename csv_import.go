@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// CSVImportOptions describes the layout of a bank statement in CSV.
+// Columns are header names or positions starting at 1, the amount comes either
+// from a single signed column or from separate debit and credit columns.
+type CSVImportOptions struct {
+	Delimiter          string
+	Header             bool
+	DateColumn         string
+	DescriptionColumn  string
+	AmountColumn       string
+	DebitColumn        string
+	CreditColumn       string
+	DateFormat         string
+	DecimalSeparator   string
+	ThousandsSeparator string
+	Sign               string
+}
+
+// csvSignConventions tells which sign of the amount column is an EXPENSE,
+// bank accounts usually show expenses as negative and credit cards as positive
+var csvSignConventions = map[string]bool{
+	"negative_expense": true,
+	"positive_expense": true,
+}
+
+func newCSVImportOptions() CSVImportOptions {
+	return CSVImportOptions{
+		Delimiter:         ",",
+		Header:            true,
+		DateColumn:        "date",
+		DescriptionColumn: "description",
+		DateFormat:        "YYYY-MM-DD",
+		DecimalSeparator:  ".",
+		Sign:              "negative_expense",
+	}
+}
+
+func (options CSVImportOptions) Validate() (err error) {
+	if len([]rune(options.Delimiter)) != 1 {
+		err = errors.New("parameter 'delimiter' must be a single character")
+	}
+
+	if options.DateColumn == "" {
+		err = errors.New("parameter 'date' must not be empty")
+	}
+
+	if options.AmountColumn == "" && options.DebitColumn == "" && options.CreditColumn == "" {
+		err = errors.New("parameter 'amount' or parameters 'debit' and 'credit' must not be empty")
+	}
+
+	if options.AmountColumn != "" && (options.DebitColumn != "" || options.CreditColumn != "") {
+		err = errors.New("parameter 'amount' can't be used with 'debit' and 'credit'")
+	}
+
+	formatCheck := regexp.MustCompile(`^[YMD\-/. ]+$`)
+	if !formatCheck.MatchString(options.DateFormat) || !strings.Contains(options.DateFormat, "YY") || !strings.Contains(options.DateFormat, "MM") || !strings.Contains(options.DateFormat, "DD") {
+		err = errors.New("parameter 'date_format' must be like DD/MM/YYYY")
+	}
+
+	if options.DecimalSeparator != "." && options.DecimalSeparator != "," {
+		err = errors.New("parameter 'decimal' must be '.' or ','")
+	}
+
+	if options.ThousandsSeparator == options.DecimalSeparator {
+		err = errors.New("parameter 'thousands' must be different from 'decimal'")
+	}
+
+	if !csvSignConventions[options.Sign] {
+		err = errors.New("parameter 'sign' must be 'negative_expense' or 'positive_expense'")
+	}
+
+	return
+}
+
+// dateLayout converts the DateFormat, like DD/MM/YYYY, to a time layout
+func (options CSVImportOptions) dateLayout() string {
+	return strings.NewReplacer("YYYY", "2006", "YY", "06", "MM", "01", "DD", "02").Replace(options.DateFormat)
+}
+
+// parseCSV reads the statement into ImportRows, lines that can't be understood
+// are returned with an error instead of stopping the import
+func parseCSV(reader io.Reader, options CSVImportOptions) ([]ImportRow, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.Comma = []rune(options.Delimiter)[0]
+	csvReader.FieldsPerRecord = -1
+	csvReader.LazyQuotes = true
+	csvReader.TrimLeadingSpace = true
+
+	records, err := csvReader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid csv: %s", err)
+	}
+
+	var header []string
+	line := 0
+	if options.Header && len(records) > 0 {
+		header = records[0]
+		records = records[1:]
+		line++
+	}
+
+	columns := map[string]int{}
+	for name, reference := range map[string]string{
+		"date":        options.DateColumn,
+		"description": options.DescriptionColumn,
+		"amount":      options.AmountColumn,
+		"debit":       options.DebitColumn,
+		"credit":      options.CreditColumn,
+	} {
+		if reference == "" {
+			continue
+		}
+
+		index, errColumn := csvColumnIndex(header, reference)
+		if errColumn != nil {
+			return nil, fmt.Errorf("parameter '%s': %s", name, errColumn)
+		}
+
+		columns[name] = index
+	}
+
+	rows := []ImportRow{}
+
+	for _, record := range records {
+		line++
+		row := ImportRow{Line: line}
+
+		errRow := options.parseRecord(record, columns, &row)
+		if errRow != nil {
+			row.Status = importStatusError
+			row.Error = errRow.Error()
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// csvColumnIndex finds a column by its position, starting at 1, or by its name in the header
+func csvColumnIndex(header []string, reference string) (int, error) {
+	if position, err := strconv.Atoi(reference); err == nil {
+		if position < 1 {
+			return 0, errors.New("column positions start at 1")
+		}
+
+		return position - 1, nil
+	}
+
+	for index, name := range header {
+		// spreadsheets often save a byte order mark before the first column
+		name = strings.TrimPrefix(name, "\ufeff")
+		if strings.EqualFold(strings.TrimSpace(name), strings.TrimSpace(reference)) {
+			return index, nil
+		}
+	}
+
+	return 0, fmt.Errorf("column '%s' not found in the header", reference)
+}
+
+func (options CSVImportOptions) parseRecord(record []string, columns map[string]int, row *ImportRow) error {
+	field := func(name string) (string, error) {
+		index := columns[name]
+		if index >= len(record) {
+			return "", fmt.Errorf("column %d of '%s' is missing", index+1, name)
+		}
+
+		return strings.TrimSpace(record[index]), nil
+	}
+
+	dateValue, err := field("date")
+	if err != nil {
+		return err
+	}
+
+	date, err := time.Parse(options.dateLayout(), dateValue)
+	if err != nil {
+		return fmt.Errorf("date '%s' must be like %s", dateValue, options.DateFormat)
+	}
+	row.Date = date.Format(dateLayout)
+
+	if _, ok := columns["description"]; ok {
+		row.Description, err = field("description")
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, ok := columns["amount"]; ok {
+		amountValue, errField := field("amount")
+		if errField != nil {
+			return errField
+		}
+
+		amount, errAmount := options.parseAmount(amountValue)
+		if errAmount != nil {
+			return errAmount
+		}
+
+		expense := amount.LessThan(decimal.New(0, 0))
+		if options.Sign == "positive_expense" {
+			expense = !expense
+		}
+
+		row.Type = "INCOME"
+		if expense {
+			row.Type = "EXPENSE"
+		}
+		row.Value = amount.Abs()
+	} else {
+		for _, name := range []string{"debit", "credit"} {
+			if _, ok := columns[name]; !ok {
+				continue
+			}
+
+			amountValue, errField := field(name)
+			if errField != nil {
+				return errField
+			}
+			if amountValue == "" {
+				continue
+			}
+
+			amount, errAmount := options.parseAmount(amountValue)
+			if errAmount != nil {
+				return errAmount
+			}
+			if amount.IsZero() {
+				continue
+			}
+
+			if row.Type != "" {
+				return errors.New("debit and credit must not be both filled")
+			}
+
+			row.Type = "INCOME"
+			if name == "debit" {
+				row.Type = "EXPENSE"
+			}
+			row.Value = amount.Abs()
+		}
+	}
+
+	if row.Value.IsZero() {
+		return errors.New("amount must not be 0")
+	}
+
+	return nil
+}
+
+// parseAmount understands the separators of the statement, a leading or trailing minus
+// and accounting negatives like (12.34)
+func (options CSVImportOptions) parseAmount(value string) (amount decimal.Decimal, err error) {
+	original := value
+	negative := false
+
+	value = strings.Replace(value, " ", "", -1)
+	if strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")") {
+		negative = true
+		value = strings.TrimSuffix(strings.TrimPrefix(value, "("), ")")
+	}
+	if strings.HasSuffix(value, "-") {
+		negative = true
+		value = strings.TrimSuffix(value, "-")
+	}
+	value = strings.TrimPrefix(value, "+")
+
+	if options.ThousandsSeparator != "" {
+		value = strings.Replace(value, options.ThousandsSeparator, "", -1)
+	}
+	value = strings.Replace(value, options.DecimalSeparator, ".", 1)
+
+	amountCheck := regexp.MustCompile(`^-?\d+(\.\d+)?$`)
+	if !amountCheck.MatchString(value) {
+		return amount, fmt.Errorf("amount '%s' is not a number", original)
+	}
+
+	amount, err = decimal.NewFromString(value)
+	if err != nil {
+		return amount, fmt.Errorf("amount '%s' is not a number", original)
+	}
+
+	if negative {
+		amount = amount.Neg()
+	}
+
+	return amount, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCSV(t *testing.T) {
+	options := newCSVImportOptions()
+	options.AmountColumn = "Amount"
+
+	statement := "Date,Description,Amount\n2019-01-05,Coffee,-3.50\n2019-01-06,Salary,1000\n2019-01-07,Refund,0\n"
+	rows, err := parseCSV(strings.NewReader(statement), options)
+	assert.Nil(t, err)
+	assert.Equal(t, len(rows), 3)
+
+	assert.Equal(t, rows[0].Line, 2)
+	assert.Equal(t, rows[0].Date, "2019-01-05")
+	assert.Equal(t, rows[0].Description, "Coffee")
+	assert.Equal(t, rows[0].Value.String(), "3.5")
+	assert.Equal(t, rows[0].Type, "EXPENSE")
+	assert.Equal(t, rows[1].Type, "INCOME")
+	assert.Equal(t, rows[2].Status, "error")
+	assert.Equal(t, rows[2].Error, "amount must not be 0")
+}
+
+func TestParseCSVWithLayout(t *testing.T) {
+	options := newCSVImportOptions()
+	options.Header = false
+	options.Delimiter = ";"
+	options.DateColumn = "1"
+	options.DescriptionColumn = "2"
+	options.DebitColumn = "3"
+	options.CreditColumn = "4"
+	options.DateFormat = "DD/MM/YYYY"
+	options.DecimalSeparator = ","
+	options.ThousandsSeparator = "."
+
+	statement := "31/01/2019;Rent;1.200,00;\n01/02/2019;Salary;;2.500,50\n2019-02-02;Lunch;10,00;\n"
+	rows, err := parseCSV(strings.NewReader(statement), options)
+	assert.Nil(t, err)
+	assert.Equal(t, len(rows), 3)
+
+	assert.Equal(t, rows[0].Line, 1)
+	assert.Equal(t, rows[0].Date, "2019-01-31")
+	assert.Equal(t, rows[0].Value.String(), "1200")
+	assert.Equal(t, rows[0].Type, "EXPENSE")
+	assert.Equal(t, rows[1].Value.String(), "2500.5")
+	assert.Equal(t, rows[1].Type, "INCOME")
+	assert.Equal(t, rows[2].Error, "date '2019-02-02' must be like DD/MM/YYYY")
+}
+
+func TestParseCSVUnknownColumn(t *testing.T) {
+	options := newCSVImportOptions()
+	options.AmountColumn = "Value"
+
+	_, err := parseCSV(strings.NewReader("date,description,amount\n"), options)
+	assert.Equal(t, err.Error(), "parameter 'amount': column 'Value' not found in the header")
+}
+
+func TestParseAmount(t *testing.T) {
+	options := newCSVImportOptions()
+	options.ThousandsSeparator = ","
+
+	values := map[string]string{
+		"1,234.56": "1234.56",
+		"-12.30":   "-12.3",
+		"+7":       "7",
+		"(15.00)":  "-15",
+		"15.00-":   "-15",
+	}
+
+	for value, expected := range values {
+		amount, err := options.parseAmount(value)
+		assert.Nil(t, err, value)
+		assert.Equal(t, amount.String(), expected, value)
+	}
+
+	_, err := options.parseAmount("USD 12")
+	assert.Equal(t, err.Error(), "amount 'USD 12' is not a number")
+}
+
+func TestCSVImportOptionsPositiveExpense(t *testing.T) {
+	options := newCSVImportOptions()
+	options.AmountColumn = "amount"
+	options.Sign = "positive_expense"
+	assert.Nil(t, options.Validate())
+
+	rows, _ := parseCSV(strings.NewReader("date,description,amount\n2019-01-05,Coffee,3.50\n"), options)
+	assert.Equal(t, rows[0].Type, "EXPENSE")
+	assert.Equal(t, rows[0].Value.String(), "3.5")
+
+	options.Sign = "inverted"
+	assert.Equal(t, options.Validate().Error(), "parameter 'sign' must be 'negative_expense' or 'positive_expense'")
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"regexp"
 	"time"
 
@@ -59,6 +60,7 @@ type Rate struct {
 	Name      string          `json:"name"`
 	Symbol    string          `json:"symbol"`
 	Value     decimal.Decimal `json:"value"`
+	Date      string          `json:"date,omitempty"`
 	CreatedAt string          `json:"-"`
 	UpdatedAt string          `json:"-"`
 }
@@ -99,8 +101,11 @@ func (currency *Currency) Create(db *sql.DB) (err error) {
 }
 
 func (currency *Currency) CreateRates(db *sql.DB, tx *sql.Tx) (err error) {
-	createdAt := time.Now()
+	return currency.createRatesAt(tx, time.Now())
+}
 
+// createRatesAt adds the rates with the given timestamp, so rates scraped together share the same time
+func (currency *Currency) createRatesAt(tx *sql.Tx, createdAt time.Time) (err error) {
 	// always add new rates, because for we always get the latest one with GetLatestRates
 	for _, rate := range currency.Rates {
 		rateErr := rate.Validate()
@@ -201,6 +206,155 @@ func (currency *Currency) GetLatestRates(db *sql.DB) (err error) {
 	return
 }
 
+// GetRatesAt gets, for each currency, the latest Rate known at the end of the given date
+func (currency *Currency) GetRatesAt(db *sql.DB, date time.Time) (err error) {
+	currency.CleanRates()
+
+	rows, err := db.Query(
+		`SELECT DISTINCT ON (name) id, name, symbol, value, to_char(created_at, 'YYYY-MM-DD'), created_at, updated_at
+		FROM rates
+		WHERE currency_name = $1 AND created_at < $2
+		ORDER BY name, created_at DESC`,
+		currency.Name,
+		date.AddDate(0, 0, 1).Format(dateLayout),
+	)
+
+	if err != nil {
+		return
+	}
+
+	for rows.Next() {
+		var rate Rate
+
+		err = rows.Scan(
+			&rate.ID,
+			&rate.Name,
+			&rate.Symbol,
+			&rate.Value,
+			&rate.Date,
+			&rate.CreatedAt,
+			&rate.UpdatedAt,
+		)
+		if err != nil {
+			return
+		}
+
+		currency.Rates = append(currency.Rates, rate)
+	}
+
+	return
+}
+
+// GetRateAt returns the Rate from currencyName to rateName effective at the given date
+// when there is no Rate before the date, the oldest one is used
+func GetRateAt(db *sql.DB, currencyName string, rateName string, date time.Time) (rate Rate, err error) {
+	if currencyName == rateName {
+		return Rate{Name: rateName, Value: decimal.New(1, 0), Date: date.Format(dateLayout)}, nil
+	}
+
+	err = db.QueryRow(
+		`SELECT id, name, symbol, value, to_char(created_at, 'YYYY-MM-DD'), created_at, updated_at
+		FROM rates
+		WHERE currency_name = $1 AND name = $2
+		ORDER BY created_at < $3 DESC, abs(extract(epoch FROM created_at - $3::timestamp))
+		LIMIT 1`,
+		currencyName,
+		rateName,
+		date.AddDate(0, 0, 1).Format(dateLayout),
+	).Scan(
+		&rate.ID,
+		&rate.Name,
+		&rate.Symbol,
+		&rate.Value,
+		&rate.Date,
+		&rate.CreatedAt,
+		&rate.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		err = fmt.Errorf("rate from '%s' to '%s' not found", currencyName, rateName)
+	}
+
+	return
+}
+
+// rateConverter converts values to a single currency with the Rate effective at their dates,
+// the rates are cached, so converting many values of the same days only queries them once
+type rateConverter struct {
+	db       *sql.DB
+	rateName string
+	rates    map[string]decimal.Decimal
+}
+
+func newRateConverter(db *sql.DB, rateName string) *rateConverter {
+	return &rateConverter{db: db, rateName: rateName, rates: map[string]decimal.Decimal{}}
+}
+
+// convert returns value, in currencyName, converted at date (like 2019-01-31), without rounding
+func (converter *rateConverter) convert(value decimal.Decimal, currencyName string, date string) (decimal.Decimal, error) {
+	if currencyName == converter.rateName {
+		return value, nil
+	}
+
+	key := currencyName + " " + date
+	if _, ok := converter.rates[key]; !ok {
+		day, err := time.Parse(dateLayout, date)
+		if err != nil {
+			return value, err
+		}
+
+		rate, err := GetRateAt(converter.db, currencyName, converter.rateName, day)
+		if err != nil {
+			return value, err
+		}
+
+		converter.rates[key] = rate.Value
+	}
+
+	return value.Mul(converter.rates[key]), nil
+}
+
+// ListRateHistory returns the daily time series of a currency pair, using the last Rate of each day
+func ListRateHistory(db *sql.DB, currencyName string, rateName string, from time.Time, to time.Time) ([]Rate, error) {
+	rows, err := db.Query(
+		`SELECT DISTINCT ON (created_at::date) id, name, symbol, value, to_char(created_at, 'YYYY-MM-DD'), created_at, updated_at
+		FROM rates
+		WHERE currency_name = $1 AND name = $2 AND created_at >= $3 AND created_at < $4
+		ORDER BY created_at::date, created_at DESC`,
+		currencyName,
+		rateName,
+		from.Format(dateLayout),
+		to.AddDate(0, 0, 1).Format(dateLayout),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rates := []Rate{}
+
+	for rows.Next() {
+		var rate Rate
+
+		errScan := rows.Scan(
+			&rate.ID,
+			&rate.Name,
+			&rate.Symbol,
+			&rate.Value,
+			&rate.Date,
+			&rate.CreatedAt,
+			&rate.UpdatedAt,
+		)
+		if errScan != nil {
+			return nil, errScan
+		}
+
+		rates = append(rates, rate)
+	}
+
+	return rates, nil
+}
+
 func (currency *Currency) GetRate(db *sql.DB, rateName string) (rate Rate, err error) {
 	for _, r := range currency.Rates {
 		if r.Name == rateName {
@@ -241,9 +395,9 @@ func (currency *Currency) CleanRates() {
 }
 
 func (rate Rate) Validate() (err error) {
-	valueCheck := regexp.MustCompile(`^\d*(\.\d{1,2}|\d)$`)
+	valueCheck := regexp.MustCompile(`^\d*(\.\d{1,10}|\d)$`)
 	if !valueCheck.MatchString(rate.Value.String()) {
-		err = errors.New("field 'value' must be like 1.99")
+		err = errors.New("field 'value' must be like 1.99, with at most 10 decimal places")
 	}
 
 	return
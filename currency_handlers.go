@@ -1,8 +1,11 @@
 package main
 
 import (
+	"database/sql"
+	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -33,3 +36,76 @@ func (s *Server) GetCurrency(w http.ResponseWriter, r *http.Request) {
 	respondWithJSON(w, currency, http.StatusOK)
 	return
 }
+
+// ListRates returns the latest rates of a currency, or the ones effective at '?date='
+func (s *Server) ListRates(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	currencyName := strings.ToUpper(vars["name"])
+
+	currency, err := GetCurrency(s.db, currencyName)
+
+	if err == sql.ErrNoRows {
+		respondWithError(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if date := r.URL.Query().Get("date"); date != "" {
+		at, errDate := time.Parse(dateLayout, date)
+		if errDate != nil {
+			respondWithError(w, fmt.Sprintf("parameter 'date' must be like %s", dateLayout), http.StatusBadRequest)
+			return
+		}
+
+		err = currency.GetRatesAt(s.db, at)
+		if err != nil {
+			respondWithError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	respondWithJSON(w, currency.Rates, http.StatusOK)
+	return
+}
+
+// ListRateHistory returns the daily rates of a currency pair between '?from=' and '?to=',
+// by default the last 30 days
+func (s *Server) ListRateHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	currencyName := strings.ToUpper(vars["name"])
+	rateName := strings.ToUpper(vars["rate"])
+
+	to := time.Now()
+	from := to.AddDate(0, 0, -30)
+	var err error
+
+	if param := r.URL.Query().Get("from"); param != "" {
+		from, err = time.Parse(dateLayout, param)
+		if err != nil {
+			respondWithError(w, fmt.Sprintf("parameter 'from' must be like %s", dateLayout), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if param := r.URL.Query().Get("to"); param != "" {
+		to, err = time.Parse(dateLayout, param)
+		if err != nil {
+			respondWithError(w, fmt.Sprintf("parameter 'to' must be like %s", dateLayout), http.StatusBadRequest)
+			return
+		}
+	}
+
+	rates, err := ListRateHistory(s.db, currencyName, rateName, from, to)
+
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, rates, http.StatusOK)
+	return
+}
@@ -3,9 +3,11 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
@@ -15,13 +17,35 @@ import (
 
 var s Server
 
+// testUser owns everything the tests create, Request authenticates as it
+var testUser User
+
+const testUserPassword = "fin-test-password"
+
+func bearerAuthorization(userID int) string {
+	token, _, _ := signToken(s.tokenSecret, userID, time.Now(), s.tokenTTL)
+	return "Bearer " + token
+}
+
 func TestMain(main *testing.M) {
 	dbStr := os.Getenv("DB_TEST")
 	s.initializeDB(dbStr)
 	s.initializeRoutes()
 	EnsureTablesExists(s.db)
+	ClearDB(s.db)
+	ClearUsers(s.db)
+
+	s.tokenSecret = []byte("fin-test-secret")
+	s.tokenTTL = time.Hour
+	testUser = User{Email: "test@fin.com", Password: testUserPassword}
+	if err := testUser.Create(s.db); err != nil {
+		log.Fatal(err)
+	}
+	Authorization = bearerAuthorization(testUser.ID)
+
 	code := main.Run()
 	ClearDB(s.db)
+	ClearUsers(s.db)
 	os.Exit(code)
 }
 
@@ -87,3 +111,70 @@ func TestGetCurrency(t *testing.T) {
 	assert.Equal(t, respCurrency.Rates[0].Symbol, rate.Symbol)
 	assert.Equal(t, respCurrency.Rates[0].Value, rate.Value)
 }
+
+func TestListRatesAtDate(t *testing.T) {
+	ClearDB(s.db)
+	currency := Currency{
+		Name:   "USD",
+		Symbol: "$",
+		Rates:  []Rate{{Name: "BRL", Symbol: "R$", Value: Decimal("3.80")}},
+	}
+	currency.Create(s.db)
+	s.db.Exec(
+		`INSERT INTO rates(currency_name, name, symbol, value, created_at, updated_at)
+		VALUES ('USD', 'BRL', 'R$', 3.10, '2019-01-10', '2019-01-10'), ('USD', 'BRL', 'R$', 3.20, '2019-01-20', '2019-01-20')`,
+	)
+
+	response := Request(s.router, "GET", "/currencies/USD/rates?date=2019-01-15", nil)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	var respRates []Rate
+	json.Unmarshal(response.Body.Bytes(), &respRates)
+
+	assert.Equal(t, len(respRates), 1)
+	assert.Equal(t, respRates[0].Value.String(), "3.1")
+	assert.Equal(t, respRates[0].Date, "2019-01-10")
+}
+
+func TestListRateHistory(t *testing.T) {
+	ClearDB(s.db)
+	currency := Currency{
+		Name:   "USD",
+		Symbol: "$",
+	}
+	currency.Create(s.db)
+	s.db.Exec(
+		`INSERT INTO rates(currency_name, name, symbol, value, created_at, updated_at)
+		VALUES ('USD', 'BRL', 'R$', 3.10, '2019-01-10 08:00', '2019-01-10 08:00'),
+		('USD', 'BRL', 'R$', 3.15, '2019-01-10 18:00', '2019-01-10 18:00'),
+		('USD', 'BRL', 'R$', 3.20, '2019-01-20', '2019-01-20')`,
+	)
+
+	response := Request(s.router, "GET", "/currencies/USD/rates/BRL?from=2019-01-01&to=2019-01-31", nil)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	var respRates []Rate
+	json.Unmarshal(response.Body.Bytes(), &respRates)
+
+	assert.Equal(t, len(respRates), 2)
+	assert.Equal(t, respRates[0].Value.String(), "3.15")
+	assert.Equal(t, respRates[1].Value.String(), "3.2")
+}
+
+func TestRatePrecision(t *testing.T) {
+	ClearDB(s.db)
+	currency := Currency{
+		Name:   "JPY",
+		Symbol: "¥",
+		Rates:  []Rate{{Name: "USD", Symbol: "$", Value: Decimal("0.0067123456")}},
+	}
+	currency.Create(s.db)
+
+	response := Request(s.router, "GET", "/currencies/JPY", nil)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	var respCurrency Currency
+	json.Unmarshal(response.Body.Bytes(), &respCurrency)
+
+	assert.Equal(t, respCurrency.Rates[0].Value.String(), "0.0067123456")
+}
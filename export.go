@@ -0,0 +1,468 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/shopspring/decimal"
+)
+
+// ExportFilter limits the exported transactions, zero values are ignored
+type ExportFilter struct {
+	AccountID int
+	From      time.Time
+	To        time.Time
+}
+
+// exportFormats are the formats of each exported resource and their content types
+var exportFormats = map[string]map[string]string{
+	"accounts":     {"csv": "text/csv", "jsonl": "application/x-ndjson"},
+	"categories":   {"csv": "text/csv", "jsonl": "application/x-ndjson"},
+	"transactions": {"csv": "text/csv", "jsonl": "application/x-ndjson", "ofx": "application/x-ofx"},
+}
+
+type exportAccount struct {
+	ID               int             `json:"id"`
+	Name             string          `json:"name"`
+	Currency         string          `json:"currency"`
+	InitialBalance   decimal.Decimal `json:"initial_balance"`
+	Balance          decimal.Decimal `json:"balance"`
+	TransactionCount int             `json:"transaction_count"`
+	CreatedAt        string          `json:"created_at"`
+}
+
+var exportAccountHeader = []string{"id", "name", "currency", "initial_balance", "balance", "transaction_count", "created_at"}
+
+func (account exportAccount) csvRecord() []string {
+	return []string{
+		strconv.Itoa(account.ID),
+		account.Name,
+		account.Currency,
+		account.InitialBalance.StringFixed(2),
+		account.Balance.StringFixed(2),
+		strconv.Itoa(account.TransactionCount),
+		account.CreatedAt,
+	}
+}
+
+// exportCategory has the Amount only in the categories of an exportTransaction
+type exportCategory struct {
+	ID        int              `json:"id"`
+	ParentID  int              `json:"parent_id,omitempty"`
+	Name      string           `json:"name"`
+	Amount    *decimal.Decimal `json:"amount,omitempty"`
+	CreatedAt string           `json:"created_at,omitempty"`
+}
+
+var exportCategoryHeader = []string{"id", "parent_id", "name", "created_at"}
+
+func (category exportCategory) csvRecord() []string {
+	parentID := ""
+	if category.ParentID != 0 {
+		parentID = strconv.Itoa(category.ParentID)
+	}
+
+	return []string{strconv.Itoa(category.ID), parentID, category.Name, category.CreatedAt}
+}
+
+// exportTransaction has the Value as stored and the Amount signed by the direction of the transaction,
+// so the CSV can be imported again
+type exportTransaction struct {
+	ID          int              `json:"id"`
+	AccountID   int              `json:"account_id"`
+	Account     string           `json:"account"`
+	Currency    string           `json:"currency"`
+	Date        string           `json:"date"`
+	Description string           `json:"description"`
+	Type        string           `json:"type"`
+	Value       decimal.Decimal  `json:"value"`
+	Amount      decimal.Decimal  `json:"amount"`
+	Categories  []exportCategory `json:"categories"`
+	TransferID  int              `json:"transfer_id,omitempty"`
+	ExternalID  string           `json:"external_id,omitempty"`
+}
+
+var exportTransactionHeader = []string{"id", "account_id", "account", "currency", "date", "description", "type", "value", "amount", "categories", "transfer_id", "external_id"}
+
+func (transaction exportTransaction) csvRecord() []string {
+	categories := []string{}
+	for _, category := range transaction.Categories {
+		categories = append(categories, category.Name)
+	}
+
+	transferID := ""
+	if transaction.TransferID != 0 {
+		transferID = strconv.Itoa(transaction.TransferID)
+	}
+
+	return []string{
+		strconv.Itoa(transaction.ID),
+		strconv.Itoa(transaction.AccountID),
+		transaction.Account,
+		transaction.Currency,
+		transaction.Date,
+		transaction.Description,
+		transaction.Type,
+		transaction.Value.StringFixed(2),
+		transaction.Amount.StringFixed(2),
+		strings.Join(categories, ";"),
+		transferID,
+		transaction.ExternalID,
+	}
+}
+
+type exportRecord interface {
+	csvRecord() []string
+}
+
+// exportEncoder writes records as CSV, with a header, or as JSON Lines
+type exportEncoder struct {
+	csv  *csv.Writer
+	json *json.Encoder
+}
+
+func newExportEncoder(w io.Writer, format string, header []string) (*exportEncoder, error) {
+	if format == "jsonl" {
+		return &exportEncoder{json: json.NewEncoder(w)}, nil
+	}
+
+	encoder := &exportEncoder{csv: csv.NewWriter(w)}
+	return encoder, encoder.csv.Write(header)
+}
+
+func (encoder *exportEncoder) encode(record exportRecord) error {
+	if encoder.json != nil {
+		return encoder.json.Encode(record)
+	}
+
+	return encoder.csv.Write(record.csvRecord())
+}
+
+func (encoder *exportEncoder) flush() error {
+	if encoder.csv != nil {
+		encoder.csv.Flush()
+		return encoder.csv.Error()
+	}
+
+	return nil
+}
+
+// Export writes the accounts, categories or transactions of a User in format.
+// Rows are written as they are read from the database, nothing is loaded in memory.
+func Export(db *sql.DB, w io.Writer, userID int, resource string, format string, filter ExportFilter) error {
+	if _, ok := exportFormats[resource][format]; !ok {
+		return fmt.Errorf("format '%s' is not available for %s", format, resource)
+	}
+
+	switch resource {
+	case "accounts":
+		return exportAccounts(db, w, userID, format)
+	case "categories":
+		return exportCategories(db, w, userID, format)
+	}
+
+	return exportTransactions(db, w, userID, format, filter)
+}
+
+func exportAccounts(db *sql.DB, w io.Writer, userID int, format string) error {
+	rows, err := db.Query(
+		`SELECT a.id, a.name, a.currency_name, a.initial_balance,
+		a.initial_balance + COALESCE(SUM(CASE WHEN `+transactionKindSQL+` IN ('INCOME', 'TRANSFER_IN') THEN t.value ELSE -t.value END), 0),
+		COUNT(t.id), a.created_at
+		FROM accounts a
+		LEFT JOIN transactions t ON (t.account_id = a.id)
+		LEFT JOIN transfers tr ON (t.transfer_id = tr.id)
+		WHERE a.user_id = $1
+		GROUP BY a.id
+		ORDER BY a.id`, userID,
+	)
+
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	encoder, err := newExportEncoder(w, format, exportAccountHeader)
+	if err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		var account exportAccount
+		errScan := rows.Scan(
+			&account.ID,
+			&account.Name,
+			&account.Currency,
+			&account.InitialBalance,
+			&account.Balance,
+			&account.TransactionCount,
+			&account.CreatedAt,
+		)
+		if errScan != nil {
+			return errScan
+		}
+
+		errEncode := encoder.encode(account)
+		if errEncode != nil {
+			return errEncode
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	return encoder.flush()
+}
+
+func exportCategories(db *sql.DB, w io.Writer, userID int, format string) error {
+	rows, err := db.Query(
+		"SELECT id, COALESCE(parent_id, 0), name, created_at FROM categories WHERE user_id = $1 ORDER BY id", userID,
+	)
+
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	encoder, err := newExportEncoder(w, format, exportCategoryHeader)
+	if err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		var category exportCategory
+		errScan := rows.Scan(&category.ID, &category.ParentID, &category.Name, &category.CreatedAt)
+		if errScan != nil {
+			return errScan
+		}
+
+		errEncode := encoder.encode(category)
+		if errEncode != nil {
+			return errEncode
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	return encoder.flush()
+}
+
+func exportTransactions(db *sql.DB, w io.Writer, userID int, format string, filter ExportFilter) error {
+	where := []string{"a.user_id = $1"}
+	args := []interface{}{userID}
+
+	if filter.AccountID != 0 {
+		args = append(args, filter.AccountID)
+		where = append(where, fmt.Sprintf("a.id = $%d", len(args)))
+	}
+
+	if !filter.From.IsZero() {
+		args = append(args, filter.From.Format(dateLayout))
+		where = append(where, fmt.Sprintf("t.date >= $%d", len(args)))
+	}
+
+	if !filter.To.IsZero() {
+		args = append(args, filter.To.Format(dateLayout))
+		where = append(where, fmt.Sprintf("t.date <= $%d", len(args)))
+	}
+
+	// the categories come aggregated as JSON, so every transaction is a single row
+	rows, err := db.Query(
+		`SELECT t.id, a.id, a.name, a.currency_name, to_char(t.date, 'YYYY-MM-DD'), t.description, t.type, `+transactionKindSQL+`, t.value,
+		COALESCE(t.transfer_id, 0), COALESCE(t.external_id, ''),
+		COALESCE(json_agg(json_build_object('id', c.id, 'name', c.name, 'amount', tc.amount) ORDER BY c.id) FILTER (WHERE c.id IS NOT NULL), '[]')
+		FROM transactions t
+		INNER JOIN accounts a ON (t.account_id = a.id)
+		LEFT JOIN transfers tr ON (t.transfer_id = tr.id)
+		LEFT JOIN transactions_categories tc ON (tc.transaction_id = t.id)
+		LEFT JOIN categories c ON (tc.category_id = c.id)
+		WHERE `+strings.Join(where, " AND ")+`
+		GROUP BY t.id, a.id, tr.id
+		ORDER BY a.id, t.date, t.id`,
+		args...,
+	)
+
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var encoder *exportEncoder
+	var ofx *ofxEncoder
+
+	if format == "ofx" {
+		ofx = newOFXEncoder(db, w, userID, filter)
+		err = ofx.begin()
+	} else {
+		encoder, err = newExportEncoder(w, format, exportTransactionHeader)
+	}
+	if err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		var transaction exportTransaction
+		var kind string
+		var categories []byte
+
+		errScan := rows.Scan(
+			&transaction.ID,
+			&transaction.AccountID,
+			&transaction.Account,
+			&transaction.Currency,
+			&transaction.Date,
+			&transaction.Description,
+			&transaction.Type,
+			&kind,
+			&transaction.Value,
+			&transaction.TransferID,
+			&transaction.ExternalID,
+			&categories,
+		)
+		if errScan != nil {
+			return errScan
+		}
+
+		errScan = json.Unmarshal(categories, &transaction.Categories)
+		if errScan != nil {
+			return errScan
+		}
+
+		transaction.Amount = transaction.Value
+		if kind == "EXPENSE" || kind == "TRANSFER_OUT" {
+			transaction.Amount = transaction.Value.Neg()
+		}
+
+		var errEncode error
+		if ofx != nil {
+			errEncode = ofx.encode(transaction)
+		} else {
+			errEncode = encoder.encode(transaction)
+		}
+		if errEncode != nil {
+			return errEncode
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	if ofx != nil {
+		return ofx.finish()
+	}
+
+	return encoder.flush()
+}
+
+// ofxEncoder writes transactions as OFX 2.x, one statement for each account,
+// transactions must come ordered by account
+type ofxEncoder struct {
+	db        *sql.DB
+	w         io.Writer
+	userID    int
+	now       string
+	end       string
+	accountID int
+}
+
+func newOFXEncoder(db *sql.DB, w io.Writer, userID int, filter ExportFilter) *ofxEncoder {
+	now := time.Now().UTC().Format("20060102150405")
+	encoder := &ofxEncoder{db: db, w: w, userID: userID, now: now, end: now}
+	if !filter.To.IsZero() {
+		encoder.end = filter.To.Format("20060102")
+	}
+
+	return encoder
+}
+
+func (encoder *ofxEncoder) begin() error {
+	_, err := fmt.Fprintf(encoder.w, `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<?OFX OFXHEADER="200" VERSION="211" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+<OFX>
+<SIGNONMSGSRSV1><SONRS><STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS><DTSERVER>%s</DTSERVER><LANGUAGE>ENG</LANGUAGE></SONRS></SIGNONMSGSRSV1>
+<BANKMSGSRSV1>
+`, encoder.now)
+
+	return err
+}
+
+func (encoder *ofxEncoder) encode(transaction exportTransaction) error {
+	if transaction.AccountID != encoder.accountID {
+		if err := encoder.endStatement(); err != nil {
+			return err
+		}
+
+		encoder.accountID = transaction.AccountID
+		_, err := fmt.Fprintf(encoder.w, `<STMTTRNRS><TRNUID>%d</TRNUID><STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>
+<STMTRS><CURDEF>%s</CURDEF>
+<BANKACCTFROM><BANKID>FIN</BANKID><ACCTID>%d</ACCTID><ACCTTYPE>CHECKING</ACCTTYPE></BANKACCTFROM>
+<BANKTRANLIST><DTSTART>%s</DTSTART><DTEND>%s</DTEND>
+`, transaction.AccountID, html.EscapeString(transaction.Currency), transaction.AccountID, strings.Replace(transaction.Date, "-", "", -1), encoder.end)
+		if err != nil {
+			return err
+		}
+	}
+
+	transactionType := "CREDIT"
+	if transaction.Type == "TRANSFER" {
+		transactionType = "XFER"
+	} else if transaction.Type == "EXPENSE" {
+		transactionType = "DEBIT"
+	}
+
+	// transactions not imported from OFX get an id of their own
+	fitID := transaction.ExternalID
+	if fitID == "" {
+		fitID = fmt.Sprintf("fin-%d", transaction.ID)
+	}
+
+	_, err := fmt.Fprintf(encoder.w, "<STMTTRN><TRNTYPE>%s</TRNTYPE><DTPOSTED>%s</DTPOSTED><TRNAMT>%s</TRNAMT><FITID>%s</FITID><NAME>%s</NAME></STMTTRN>\n",
+		transactionType,
+		strings.Replace(transaction.Date, "-", "", -1),
+		transaction.Amount.StringFixed(2),
+		html.EscapeString(fitID),
+		html.EscapeString(transaction.Description),
+	)
+
+	return err
+}
+
+// endStatement closes the statement of the current account with its balance
+func (encoder *ofxEncoder) endStatement() error {
+	if encoder.accountID == 0 {
+		return nil
+	}
+
+	account, err := GetAccount(encoder.db, encoder.userID, encoder.accountID, "")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(encoder.w, `</BANKTRANLIST>
+<LEDGERBAL><BALAMT>%s</BALAMT><DTASOF>%s</DTASOF></LEDGERBAL>
+</STMTRS></STMTTRNRS>
+`, account.Balance.StringFixed(2), encoder.now)
+
+	return err
+}
+
+func (encoder *ofxEncoder) finish() error {
+	if err := encoder.endStatement(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprint(encoder.w, "</BANKMSGSRSV1>\n</OFX>\n")
+	return err
+}
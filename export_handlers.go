@@ -0,0 +1,112 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// exportResponseWriter tells if the export already started writing,
+// after that errors can't be sent as a response anymore
+type exportResponseWriter struct {
+	http.ResponseWriter
+	written bool
+}
+
+func (w *exportResponseWriter) Write(data []byte) (int, error) {
+	w.written = true
+	return w.ResponseWriter.Write(data)
+}
+
+// Export streams all the accounts, categories or transactions of the user,
+// the transactions can be filtered with ?account=, ?from= and ?to=
+func (s *Server) Export(w http.ResponseWriter, r *http.Request) {
+	resource := mux.Vars(r)["resource"]
+	user := currentUser(r)
+
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		format = "csv"
+	}
+
+	contentType, ok := exportFormats[resource][format]
+	if !ok {
+		formats := []string{}
+		for _, name := range []string{"csv", "jsonl", "ofx"} {
+			if _, available := exportFormats[resource][name]; available {
+				formats = append(formats, fmt.Sprintf("'%s'", name))
+			}
+		}
+		respondWithError(w, fmt.Sprintf("parameter 'format' must be %s", strings.Join(formats, " or ")), http.StatusBadRequest)
+		return
+	}
+
+	filter, err := parseExportFilter(r)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if filter.AccountID != 0 {
+		_, err = GetAccount(s.db, user.ID, filter.AccountID, "")
+		if err == sql.ErrNoRows {
+			respondWithError(w, "not found", http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			respondWithError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, resource, format))
+
+	exportWriter := &exportResponseWriter{ResponseWriter: w}
+	err = Export(s.db, exportWriter, user.ID, resource, format, filter)
+	if err != nil {
+		if !exportWriter.written {
+			respondWithError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		log.Println(fmt.Sprintf("export of %s failed: %s", resource, err))
+	}
+	return
+}
+
+// parseExportFilter reads ?account=, ?from= and ?to= from the query string
+func parseExportFilter(r *http.Request) (filter ExportFilter, err error) {
+	query := r.URL.Query()
+
+	if account := query.Get("account"); account != "" {
+		filter.AccountID, err = strconv.Atoi(account)
+		if err != nil {
+			return filter, errors.New("parameter 'account' must be an id")
+		}
+	}
+
+	if from := query.Get("from"); from != "" {
+		filter.From, err = time.Parse(dateLayout, from)
+		if err != nil {
+			return filter, fmt.Errorf("parameter 'from' must be like %s", dateLayout)
+		}
+	}
+
+	if to := query.Get("to"); to != "" {
+		filter.To, err = time.Parse(dateLayout, to)
+		if err != nil {
+			return filter, fmt.Errorf("parameter 'to' must be like %s", dateLayout)
+		}
+	}
+
+	return filter, nil
+}
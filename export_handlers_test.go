@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/jonatasbaldin/fin/test"
+)
+
+func createExportTransactions() (Account, Category) {
+	currency := Currency{
+		Name: "EUR",
+	}
+	currency.Create(s.db)
+	account := Account{
+		UserID:         testUser.ID,
+		Currency:       currency,
+		Name:           "Bank",
+		InitialBalance: Decimal("100.00"),
+	}
+	account.Create(s.db)
+	category := Category{
+		UserID: testUser.ID,
+		Name:   "Food",
+	}
+	category.Create(s.db)
+
+	transactions := []Transaction{
+		{Account: account, Description: "Coffee", Value: Decimal("3.50"), Type: "EXPENSE", Date: "2019-01-05", Categories: []Category{category}},
+		{Account: account, Description: "Salary", Value: Decimal("1000.00"), Type: "INCOME", Date: "2019-01-06", Categories: []Category{category}},
+		{Account: account, Description: "Lunch", Value: Decimal("12.00"), Type: "EXPENSE", Date: "2019-02-01", Categories: []Category{category}},
+	}
+	for _, transaction := range transactions {
+		transaction.Create(s.db)
+	}
+
+	return account, category
+}
+
+func TestExportTransactionsCSV(t *testing.T) {
+	ClearDB(s.db)
+
+	account, _ := createExportTransactions()
+
+	response := Request(s.router, "GET", fmt.Sprintf("/exports/transactions?account=%d&to=2019-01-31", account.ID), nil)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, response.Header().Get("Content-Type"), "text/csv")
+
+	records, err := csv.NewReader(response.Body).ReadAll()
+	assert.Nil(t, err)
+	assert.Equal(t, len(records), 3)
+
+	assert.Equal(t, records[0][4:10], []string{"date", "description", "type", "value", "amount", "categories"})
+	assert.Equal(t, records[1][4:10], []string{"2019-01-05", "Coffee", "EXPENSE", "3.50", "-3.50", "Food"})
+	assert.Equal(t, records[2][4:10], []string{"2019-01-06", "Salary", "INCOME", "1000.00", "1000.00", "Food"})
+}
+
+func TestExportTransactionsJSONL(t *testing.T) {
+	ClearDB(s.db)
+
+	_, category := createExportTransactions()
+
+	response := Request(s.router, "GET", "/exports/transactions?format=jsonl&from=2019-01-06", nil)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	transactions := []exportTransaction{}
+	scanner := bufio.NewScanner(response.Body)
+	for scanner.Scan() {
+		var transaction exportTransaction
+		err := json.Unmarshal(scanner.Bytes(), &transaction)
+		assert.Nil(t, err)
+
+		transactions = append(transactions, transaction)
+	}
+
+	assert.Equal(t, len(transactions), 2)
+	assert.Equal(t, transactions[1].Description, "Lunch")
+	assert.Equal(t, transactions[1].Amount.String(), "-12")
+	assert.Equal(t, transactions[1].Categories[0].ID, category.ID)
+}
+
+func TestExportTransactionsOFX(t *testing.T) {
+	ClearDB(s.db)
+
+	createExportTransactions()
+
+	response := Request(s.router, "GET", "/exports/transactions?format=ofx", nil)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	// the export can be imported again
+	statement, err := parseOFX(response.Body)
+	assert.Nil(t, err)
+
+	assert.Equal(t, statement.Currency, "EUR")
+	assert.Equal(t, len(statement.Rows), 3)
+	assert.Equal(t, statement.Rows[0].Type, "EXPENSE")
+	assert.Equal(t, statement.Rows[0].Date, "2019-01-05")
+	assert.True(t, strings.HasPrefix(statement.Rows[0].ExternalID, "fin-"))
+}
+
+func TestExportAccounts(t *testing.T) {
+	ClearDB(s.db)
+
+	createExportTransactions()
+
+	response := Request(s.router, "GET", "/exports/accounts?format=jsonl", nil)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	var account exportAccount
+	json.Unmarshal(response.Body.Bytes(), &account)
+
+	assert.Equal(t, account.Name, "Bank")
+	assert.Equal(t, account.Balance.String(), "1084.5")
+	assert.Equal(t, account.TransactionCount, 3)
+}
+
+func TestExportValidation(t *testing.T) {
+	ClearDB(s.db)
+
+	account, _ := createExportTransactions()
+
+	response := Request(s.router, "GET", "/exports/categories?format=ofx", nil)
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+
+	var err CustomError
+	json.Unmarshal(response.Body.Bytes(), &err)
+	assert.Equal(t, err.Error, "parameter 'format' must be 'csv' or 'jsonl'")
+
+	response = Request(s.router, "GET", fmt.Sprintf("/exports/transactions?account=%d", account.ID+1), nil)
+	assert.Equal(t, http.StatusNotFound, response.Code)
+}
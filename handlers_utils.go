@@ -5,6 +5,9 @@ import (
 	"net/http"
 )
 
+// dateLayout is the format used by dates in query parameters
+const dateLayout = "2006-01-02"
+
 type RequestValidation interface {
 	Validate() error
 }
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/shopspring/decimal"
+)
+
+// ImportRow is one line of an imported statement and what happened to it
+type ImportRow struct {
+	Line          int             `json:"line"`
+	Date          string          `json:"date,omitempty"`
+	Description   string          `json:"description,omitempty"`
+	Value         decimal.Decimal `json:"value"`
+	Type          string          `json:"type,omitempty"`
+	ExternalID    string          `json:"external_id,omitempty"`
+	Categories    []Category      `json:"categories,omitempty"`
+	RuleID        int             `json:"rule_id,omitempty"`
+	Status        string          `json:"status"`
+	Error         string          `json:"error,omitempty"`
+	TransactionID int             `json:"transaction_id,omitempty"`
+}
+
+// ImportResult is the report of an import, with dry run nothing is written
+type ImportResult struct {
+	DryRun     bool        `json:"dry_run"`
+	Total      int         `json:"total"`
+	Created    int         `json:"created"`
+	Duplicates int         `json:"duplicates"`
+	Errors     int         `json:"errors"`
+	Rows       []ImportRow `json:"rows"`
+}
+
+const (
+	importStatusNew       = "new"
+	importStatusCreated   = "created"
+	importStatusDuplicate = "duplicate"
+	importStatusError     = "error"
+)
+
+// importFormats are the statement formats accepted by parseStatement, QFX is OFX with a few extra tags
+var importFormats = map[string]bool{
+	"csv": true,
+	"ofx": true,
+	"qfx": true,
+}
+
+// parseStatement reads a statement in format into rows for the Account,
+// csvOptions are only used by CSV
+func parseStatement(format string, reader io.Reader, account Account, csvOptions CSVImportOptions) ([]ImportRow, error) {
+	switch format {
+	case "csv":
+		return parseCSV(reader, csvOptions)
+	case "ofx", "qfx":
+		statement, err := parseOFX(reader)
+		if err != nil {
+			return nil, err
+		}
+
+		if statement.Currency != "" && statement.Currency != account.Currency.Name {
+			return nil, fmt.Errorf("statement currency '%s' doesn't match the account currency '%s'", statement.Currency, account.Currency.Name)
+		}
+
+		return statement.Rows, nil
+	}
+
+	return nil, fmt.Errorf("format '%s' is not supported", format)
+}
+
+// importTransactions validates the rows, marks the ones already in the Account as duplicates
+// and, unless dryRun, creates the rest in a single database transaction.
+// Rows get the given categories, without them the ones of the first matching rule of the User, like applyRules.
+// Nothing is created when any row has an error.
+func importTransactions(db *sql.DB, account Account, categories []Category, rows []ImportRow, dryRun bool) (result ImportResult, err error) {
+	result.DryRun = dryRun
+	result.Rows = rows
+
+	rules, err := ListRules(db, account.UserID)
+	if err != nil {
+		return
+	}
+
+	transactions := make([]*Transaction, len(rows))
+
+	for index := range rows {
+		row := &rows[index]
+		if row.Status == importStatusError {
+			continue
+		}
+
+		transaction := Transaction{
+			Account:     account,
+			Description: row.Description,
+			Value:       row.Value,
+			Type:        row.Type,
+			Date:        row.Date,
+			ExternalID:  row.ExternalID,
+			Categories:  append([]Category{}, categories...),
+		}
+
+		if len(transaction.Categories) == 0 {
+			if rule := matchRule(rules, transaction); rule != nil {
+				transaction.Categories = append([]Category{}, rule.Categories...)
+				row.RuleID = rule.ID
+			}
+		}
+		row.Categories = transaction.Categories
+
+		errValidate := transaction.Validate()
+		if errValidate != nil {
+			row.Status = importStatusError
+			row.Error = errValidate.Error()
+			continue
+		}
+
+		row.Status = importStatusNew
+		transactions[index] = &transaction
+	}
+
+	err = markDuplicates(db, account.ID, rows)
+	if err != nil {
+		return
+	}
+
+	for _, row := range rows {
+		switch row.Status {
+		case importStatusError:
+			result.Errors++
+		case importStatusDuplicate:
+			result.Duplicates++
+		}
+	}
+	result.Total = len(rows)
+
+	if dryRun || result.Errors > 0 {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+
+	for index := range rows {
+		if rows[index].Status != importStatusNew {
+			continue
+		}
+
+		err = transactions[index].insert(db, tx)
+		if err != nil {
+			tx.Rollback()
+			return result, fmt.Errorf("line %d: %s", rows[index].Line, err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return
+	}
+
+	for index := range rows {
+		if rows[index].Status != importStatusNew {
+			continue
+		}
+
+		rows[index].Status = importStatusCreated
+		rows[index].TransactionID = transactions[index].ID
+		result.Created++
+	}
+
+	return
+}
+
+// markDuplicates compares the rows with the transactions of the Account.
+// Rows with an ExternalID, like the FITID of OFX, are duplicates when a transaction has the same one,
+// otherwise they are compared by date, value, type and description with the transactions without it.
+// Identical transactions on the same day happen, so a row is only a duplicate
+// while the file has no more copies of it than the Account already has.
+func markDuplicates(db *sql.DB, accountID int, rows []ImportRow) error {
+	var from, to string
+	externalIDs := []string{}
+	for _, row := range rows {
+		if row.Status != importStatusNew {
+			continue
+		}
+		if from == "" || row.Date < from {
+			from = row.Date
+		}
+		if to == "" || row.Date > to {
+			to = row.Date
+		}
+		if row.ExternalID != "" {
+			externalIDs = append(externalIDs, row.ExternalID)
+		}
+	}
+
+	if from == "" {
+		return nil
+	}
+
+	existingExternalIDs := map[string]bool{}
+
+	if len(externalIDs) > 0 {
+		dbRows, err := db.Query(
+			"SELECT external_id FROM transactions WHERE account_id = $1 AND external_id = ANY($2)",
+			accountID,
+			pq.Array(externalIDs),
+		)
+
+		if err != nil {
+			return err
+		}
+
+		for dbRows.Next() {
+			var externalID string
+			errScan := dbRows.Scan(&externalID)
+			if errScan != nil {
+				dbRows.Close()
+				return errScan
+			}
+
+			existingExternalIDs[externalID] = true
+		}
+		dbRows.Close()
+	}
+
+	dbRows, err := db.Query(
+		`SELECT to_char(date, 'YYYY-MM-DD'), value, type, lower(trim(description)), COUNT(*), COUNT(*) FILTER (WHERE external_id IS NULL)
+		FROM transactions
+		WHERE account_id = $1 AND date >= $2 AND date <= $3
+		GROUP BY date, value, type, lower(trim(description))`,
+		accountID,
+		from,
+		to,
+	)
+
+	if err != nil {
+		return err
+	}
+	defer dbRows.Close()
+
+	existing := map[string]int{}
+	existingWithoutExternalID := map[string]int{}
+
+	for dbRows.Next() {
+		var date, transactionType, description string
+		var value decimal.Decimal
+		var count, countWithoutExternalID int
+
+		errScan := dbRows.Scan(&date, &value, &transactionType, &description, &count, &countWithoutExternalID)
+		if errScan != nil {
+			return errScan
+		}
+
+		key := duplicateKey(date, value, transactionType, description)
+		existing[key] = count
+		existingWithoutExternalID[key] = countWithoutExternalID
+	}
+
+	for index := range rows {
+		row := &rows[index]
+		if row.Status != importStatusNew {
+			continue
+		}
+
+		if row.ExternalID != "" {
+			// the same id twice in a file is also a duplicate
+			if existingExternalIDs[row.ExternalID] {
+				row.Status = importStatusDuplicate
+				continue
+			}
+			existingExternalIDs[row.ExternalID] = true
+		}
+
+		counts := existing
+		if row.ExternalID != "" {
+			counts = existingWithoutExternalID
+		}
+
+		key := duplicateKey(row.Date, row.Value, row.Type, row.Description)
+		if counts[key] > 0 {
+			counts[key]--
+			row.Status = importStatusDuplicate
+		}
+	}
+
+	return dbRows.Err()
+}
+
+func duplicateKey(date string, value decimal.Decimal, transactionType string, description string) string {
+	return fmt.Sprintf("%s|%s|%s|%s", date, value.String(), transactionType, strings.ToLower(strings.TrimSpace(description)))
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// maxImportSize limits the size of an uploaded statement, 10MB
+const maxImportSize = 10 << 20
+
+// ImportTransactions reads a statement from the request body into the account,
+// ?dry_run=true only reports what would be created
+func (s *Server) ImportTransactions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	accountID, _ := strconv.Atoi(vars["account_id"])
+	user := currentUser(r)
+	query := r.URL.Query()
+
+	account, err := GetAccount(s.db, user.ID, accountID, "")
+	if err == sql.ErrNoRows {
+		respondWithError(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	categories, err := parseImportCategories(s.db, user.ID, r)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dryRun := false
+	if value := query.Get("dry_run"); value != "" {
+		dryRun, err = strconv.ParseBool(value)
+		if err != nil {
+			respondWithError(w, "parameter 'dry_run' must be 'true' or 'false'", http.StatusBadRequest)
+			return
+		}
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxImportSize)
+
+	format := strings.ToLower(query.Get("format"))
+	if format == "" {
+		format = "csv"
+	}
+
+	if !importFormats[format] {
+		respondWithError(w, "parameter 'format' must be 'csv', 'ofx' or 'qfx'", http.StatusBadRequest)
+		return
+	}
+
+	var csvOptions CSVImportOptions
+	if format == "csv" {
+		csvOptions, err = parseCSVImportOptions(r)
+		if err != nil {
+			respondWithError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	rows, err := parseStatement(format, body, account, csvOptions)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := importTransactions(s.db, account, categories, rows, dryRun)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch {
+	case result.Errors > 0:
+		respondWithJSON(w, result, http.StatusUnprocessableEntity)
+	case dryRun:
+		respondWithJSON(w, result, http.StatusOK)
+	default:
+		respondWithJSON(w, result, http.StatusCreated)
+	}
+	return
+}
+
+// parseImportCategories reads the categories given to the imported transactions, rules only apply without them,
+// as ?category=1&category=2 or ?category=1,2
+func parseImportCategories(db *sql.DB, userID int, r *http.Request) ([]Category, error) {
+	categories := []Category{}
+
+	for _, param := range r.URL.Query()["category"] {
+		for _, value := range strings.Split(param, ",") {
+			categoryID, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return nil, errors.New("parameter 'category' must be a list of ids")
+			}
+
+			category, err := GetCategory(db, userID, categoryID)
+			if err == sql.ErrNoRows {
+				return nil, fmt.Errorf("category %d not found", categoryID)
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			categories = append(categories, category)
+		}
+	}
+
+	return categories, nil
+}
+
+// parseCSVImportOptions reads the layout of the CSV from the query string,
+// without columns it expects a header with date, description and amount
+func parseCSVImportOptions(r *http.Request) (options CSVImportOptions, err error) {
+	query := r.URL.Query()
+	options = newCSVImportOptions()
+
+	if value := query.Get("header"); value != "" {
+		options.Header, err = strconv.ParseBool(value)
+		if err != nil {
+			return options, errors.New("parameter 'header' must be 'true' or 'false'")
+		}
+	}
+
+	if value, ok := query["delimiter"]; ok {
+		options.Delimiter = value[0]
+		// tabs are easier to pass by name
+		if strings.ToLower(options.Delimiter) == "tab" {
+			options.Delimiter = "\t"
+		}
+	}
+
+	stringOptions := map[string]*string{
+		"date":        &options.DateColumn,
+		"description": &options.DescriptionColumn,
+		"amount":      &options.AmountColumn,
+		"debit":       &options.DebitColumn,
+		"credit":      &options.CreditColumn,
+		"date_format": &options.DateFormat,
+		"decimal":     &options.DecimalSeparator,
+		"thousands":   &options.ThousandsSeparator,
+	}
+	for name, option := range stringOptions {
+		if value, ok := query[name]; ok {
+			*option = value[0]
+		}
+	}
+
+	if value := query.Get("sign"); value != "" {
+		options.Sign = strings.ToLower(value)
+	}
+
+	if options.AmountColumn == "" && options.DebitColumn == "" && options.CreditColumn == "" {
+		options.AmountColumn = "amount"
+	}
+
+	err = validateRequest(options)
+
+	return
+}
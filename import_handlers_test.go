@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/jonatasbaldin/fin/test"
+)
+
+func createImportAccount() (Account, Category) {
+	currency := Currency{
+		Name: "EUR",
+	}
+	currency.Create(s.db)
+	account := Account{
+		UserID:         testUser.ID,
+		Currency:       currency,
+		Name:           "Bank",
+		InitialBalance: Decimal("0.00"),
+	}
+	account.Create(s.db)
+	category := Category{
+		UserID: testUser.ID,
+		Name:   "Imported",
+	}
+	category.Create(s.db)
+
+	return account, category
+}
+
+func TestImportTransactionsCSV(t *testing.T) {
+	ClearDB(s.db)
+
+	account, category := createImportAccount()
+	existing := Transaction{
+		Account:     account,
+		Description: "Coffee",
+		Value:       Decimal("3.50"),
+		Type:        "EXPENSE",
+		Date:        "2019-01-05",
+		Categories:  []Category{category},
+	}
+	existing.Create(s.db)
+
+	statement := []byte("Date;Memo;Amount\n05/01/2019;Coffee;-3,50\n05/01/2019;Coffee;-3,50\n06/01/2019;Salary;1.000,00\n")
+	url := fmt.Sprintf("/accounts/%d/imports?category=%d&delimiter=;&description=Memo&date_format=DD/MM/YYYY&decimal=,&thousands=.", account.ID, category.ID)
+
+	response := Request(s.router, "POST", url+"&dry_run=true", bytes.NewBuffer(statement))
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	var result ImportResult
+	json.Unmarshal(response.Body.Bytes(), &result)
+
+	assert.True(t, result.DryRun)
+	assert.Equal(t, result.Total, 3)
+	assert.Equal(t, result.Duplicates, 1)
+	assert.Equal(t, result.Created, 0)
+	assert.Equal(t, result.Rows[0].Status, "duplicate")
+	assert.Equal(t, result.Rows[1].Status, "new")
+
+	count, _ := CountTransactions(s.db, account.ID, TransactionFilter{})
+	assert.Equal(t, count, 1)
+
+	response = Request(s.router, "POST", url, bytes.NewBuffer(statement))
+	assert.Equal(t, http.StatusCreated, response.Code)
+
+	result = ImportResult{}
+	json.Unmarshal(response.Body.Bytes(), &result)
+
+	assert.Equal(t, result.Created, 2)
+	assert.NotEqual(t, result.Rows[2].TransactionID, 0)
+
+	transaction, _ := GetTransaction(s.db, testUser.ID, result.Rows[2].TransactionID)
+	assert.Equal(t, transaction.Value.String(), "1000")
+	assert.Equal(t, transaction.Type, "INCOME")
+	assert.Equal(t, transaction.Date, "2019-01-06")
+	assert.Equal(t, transaction.Categories[0].ID, category.ID)
+
+	// importing the same statement again creates nothing
+	response = Request(s.router, "POST", url, bytes.NewBuffer(statement))
+	assert.Equal(t, http.StatusCreated, response.Code)
+
+	result = ImportResult{}
+	json.Unmarshal(response.Body.Bytes(), &result)
+
+	assert.Equal(t, result.Created, 0)
+	assert.Equal(t, result.Duplicates, 3)
+}
+
+func TestImportTransactionsCSVWithErrors(t *testing.T) {
+	ClearDB(s.db)
+
+	account, category := createImportAccount()
+
+	statement := []byte("date,description,amount\n2019-01-05,Coffee,-3.50\n2019-01-32,Lunch,-10\n2019-01-06,Tip,-0.005\n")
+	response := Request(s.router, "POST", fmt.Sprintf("/accounts/%d/imports?category=%d", account.ID, category.ID), bytes.NewBuffer(statement))
+	assert.Equal(t, http.StatusUnprocessableEntity, response.Code)
+
+	var result ImportResult
+	json.Unmarshal(response.Body.Bytes(), &result)
+
+	assert.Equal(t, result.Errors, 2)
+	assert.Equal(t, result.Created, 0)
+	assert.Equal(t, result.Rows[0].Status, "new")
+	assert.Equal(t, result.Rows[1].Line, 3)
+	assert.Equal(t, result.Rows[1].Error, "date '2019-01-32' must be like YYYY-MM-DD")
+	assert.Equal(t, result.Rows[2].Status, "error")
+
+	// nothing is created while any line has an error
+	count, _ := CountTransactions(s.db, account.ID, TransactionFilter{})
+	assert.Equal(t, count, 0)
+}
+
+func TestImportTransactionsValidation(t *testing.T) {
+	ClearDB(s.db)
+
+	account, category := createImportAccount()
+
+	requests := map[string]string{
+		fmt.Sprintf("/accounts/%d/imports?category=food", account.ID):                         "parameter 'category' must be a list of ids",
+		fmt.Sprintf("/accounts/%d/imports?category=%d&sign=up", account.ID, category.ID):      "parameter 'sign' must be 'negative_expense' or 'positive_expense'",
+		fmt.Sprintf("/accounts/%d/imports?category=%d&format=xls", account.ID, category.ID):   "parameter 'format' must be 'csv', 'ofx' or 'qfx'",
+		fmt.Sprintf("/accounts/%d/imports?category=%d&amount=Value", account.ID, category.ID): "parameter 'amount': column 'Value' not found in the header",
+	}
+
+	for url, message := range requests {
+		response := Request(s.router, "POST", url, bytes.NewBufferString("date,description,amount\n"))
+		assert.Equal(t, http.StatusBadRequest, response.Code, url)
+
+		var err CustomError
+		json.Unmarshal(response.Body.Bytes(), &err)
+		assert.Equal(t, err.Error, message, url)
+	}
+
+	response := Request(s.router, "POST", fmt.Sprintf("/accounts/%d/imports?category=%d", account.ID+1, category.ID), nil)
+	assert.Equal(t, http.StatusNotFound, response.Code)
+}
+
+func TestImportTransactionsOFX(t *testing.T) {
+	ClearDB(s.db)
+
+	account, category := createImportAccount()
+
+	statement := `<OFX><BANKMSGSRSV1><STMTTRNRS><STMTRS><CURDEF>EUR<BANKTRANLIST>
+<STMTTRN><TRNTYPE>POS<DTPOSTED>20190105<TRNAMT>-3.50<FITID>A1<NAME>Coffee</STMTTRN>
+<STMTTRN><TRNTYPE>POS<DTPOSTED>20190105<TRNAMT>-3.50<FITID>A2<NAME>Coffee</STMTTRN>
+</BANKTRANLIST></STMTRS></STMTTRNRS></BANKMSGSRSV1></OFX>`
+	url := fmt.Sprintf("/accounts/%d/imports?format=ofx&category=%d", account.ID, category.ID)
+
+	response := Request(s.router, "POST", url, bytes.NewBufferString(statement))
+	assert.Equal(t, http.StatusCreated, response.Code)
+
+	var result ImportResult
+	json.Unmarshal(response.Body.Bytes(), &result)
+
+	// the same values on the same day are different transactions when their FITID differ
+	assert.Equal(t, result.Created, 2)
+
+	transaction, _ := GetTransaction(s.db, testUser.ID, result.Rows[1].TransactionID)
+	assert.Equal(t, transaction.ExternalID, "A2")
+
+	response = Request(s.router, "POST", url, bytes.NewBufferString(statement))
+	result = ImportResult{}
+	json.Unmarshal(response.Body.Bytes(), &result)
+
+	assert.Equal(t, result.Created, 0)
+	assert.Equal(t, result.Duplicates, 2)
+
+	response = Request(s.router, "POST", url, bytes.NewBufferString(strings.Replace(statement, "EUR", "USD", 1)))
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+
+	var err CustomError
+	json.Unmarshal(response.Body.Bytes(), &err)
+	assert.Equal(t, err.Error, "statement currency 'USD' doesn't match the account currency 'EUR'")
+}
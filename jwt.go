@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	errInvalidToken = errors.New("invalid token")
+	errExpiredToken = errors.New("token expired")
+)
+
+// tokenHeader is the only header accepted, tokens with any other algorithm are rejected
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// tokenClaims are the JWT claims of a session token, Subject is the User ID
+type tokenClaims struct {
+	Subject   int   `json:"sub"`
+	IssuedAt  int64 `json:"iat"`
+	ExpiresAt int64 `json:"exp"`
+}
+
+// signToken creates a JWT signed with HMAC-SHA256 for the User, valid for ttl
+func signToken(secret []byte, userID int, now time.Time, ttl time.Duration) (token string, expiresAt time.Time, err error) {
+	expiresAt = now.Add(ttl)
+
+	claims, err := json.Marshal(tokenClaims{
+		Subject:   userID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	})
+	if err != nil {
+		return
+	}
+
+	unsigned := tokenHeader + "." + base64.RawURLEncoding.EncodeToString(claims)
+	token = unsigned + "." + base64.RawURLEncoding.EncodeToString(tokenSignature(secret, unsigned))
+
+	return
+}
+
+// parseToken checks the signature and the expiration of a JWT created by signToken
+func parseToken(secret []byte, token string, now time.Time) (claims tokenClaims, err error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != tokenHeader {
+		return claims, errInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, errInvalidToken
+	}
+
+	if !hmac.Equal(signature, tokenSignature(secret, parts[0]+"."+parts[1])) {
+		return claims, errInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return claims, errInvalidToken
+	}
+
+	err = json.Unmarshal(payload, &claims)
+	if err != nil || claims.Subject == 0 {
+		return claims, errInvalidToken
+	}
+
+	if now.Unix() >= claims.ExpiresAt {
+		return claims, errExpiredToken
+	}
+
+	return
+}
+
+func tokenSignature(secret []byte, unsigned string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignAndParseToken(t *testing.T) {
+	secret := []byte("secret")
+	now := time.Unix(1550000000, 0)
+
+	token, expiresAt, err := signToken(secret, 42, now, time.Hour)
+	assert.Nil(t, err)
+	assert.Equal(t, expiresAt, now.Add(time.Hour))
+
+	claims, err := parseToken(secret, token, now.Add(time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, claims.Subject, 42)
+
+	_, err = parseToken(secret, token, now.Add(time.Hour))
+	assert.Equal(t, err, errExpiredToken)
+
+	_, err = parseToken([]byte("other"), token, now)
+	assert.Equal(t, err, errInvalidToken)
+}
+
+func TestParseTokenRejectsOtherAlgorithms(t *testing.T) {
+	secret := []byte("secret")
+	token, _, _ := signToken(secret, 42, time.Now(), time.Hour)
+	parts := strings.Split(token, ".")
+
+	// {"alg":"none","typ":"JWT"}
+	unsigned := "eyJhbGciOiJub25lIiwidHlwIjoiSldUIn0." + parts[1] + "."
+	_, err := parseToken(secret, unsigned, time.Now())
+	assert.Equal(t, err, errInvalidToken)
+}
@@ -1,21 +1,244 @@
 package main
 
 import (
+	"bufio"
 	"database/sql"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 )
 
-func initializeScrape(db *sql.DB) {
+func newRateProvider() RateProvider {
 	httpClient := &http.Client{Timeout: 10 * time.Second}
-	err := Scrape(db, httpClient)
+	provider, err := NewRateProvider(os.Getenv("RATE_PROVIDERS"), httpClient)
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	return provider
+}
+
+// newScrapper reads SCRAPE_MODE, "per-currency" (default) makes one upstream call per currency,
+// "cross" makes a single call for SCRAPE_BASE (default EUR) and derives the other rates from it
+func newScrapper() Scrapper {
+	switch os.Getenv("SCRAPE_MODE") {
+	case "", "per-currency":
+		return Scrape
+	case "cross":
+		base := strings.ToUpper(os.Getenv("SCRAPE_BASE"))
+		if base == "" {
+			base = "EUR"
+		}
+		if _, ok := supportedRatesAndSymbols[base]; !ok {
+			log.Fatal(fmt.Sprintf("invalid SCRAPE_BASE: '%s' is not supported", base))
+		}
+		return CrossRatesScrapper(base)
+	default:
+		log.Fatal(fmt.Sprintf("invalid SCRAPE_MODE: '%s'", os.Getenv("SCRAPE_MODE")))
+	}
+
+	return nil
+}
+
+func initializeScrape(db *sql.DB) (summary ScrapeSummary, err error) {
+	var errScrape error
+	scrape := newScrapper()
+
+	acquired, err := withScrapeLock(db, func() {
+		summary, errScrape = scrape(db, newRateProvider())
+		fmt.Println(summary)
+	})
+
+	if err != nil {
+		return
+	}
+
+	if !acquired {
+		return summary, errors.New("another instance is scraping, try again later")
+	}
+
+	return summary, errScrape
+}
+
+// initializeScheduler reads SCRAPE_INTERVAL, like "12h", "0" disables the scheduler
+func initializeScheduler(db *sql.DB) *RateScheduler {
+	interval := 24 * time.Hour
+
+	if value := os.Getenv("SCRAPE_INTERVAL"); value != "" {
+		var err error
+		interval, err = time.ParseDuration(value)
+		if err != nil {
+			log.Fatal(fmt.Sprintf("invalid SCRAPE_INTERVAL: %s", err))
+		}
+	}
+
+	if interval <= 0 {
+		return nil
+	}
+
+	return NewRateScheduler(db, newRateProvider(), newScrapper(), interval)
+}
+
+// initializeMaterializer reads MATERIALIZE_INTERVAL, like "30m", "0" disables the materializer
+func initializeMaterializer(db *sql.DB) *Materializer {
+	interval := time.Hour
+
+	if value := os.Getenv("MATERIALIZE_INTERVAL"); value != "" {
+		var err error
+		interval, err = time.ParseDuration(value)
+		if err != nil {
+			log.Fatal(fmt.Sprintf("invalid MATERIALIZE_INTERVAL: %s", err))
+		}
+	}
+
+	if interval <= 0 {
+		return nil
+	}
+
+	return NewMaterializer(db, interval)
+}
+
+// importFile imports the statement at path into an account, the format comes from the extension
+// and CSV files must have the date, description and amount columns
+func importFile(db *sql.DB, path string, accountID int, categoryIDs string, dryRun bool) (result ImportResult, err error) {
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	if !importFormats[format] {
+		return result, fmt.Errorf("file must be .csv, .ofx or .qfx")
+	}
+
+	var userID int
+	err = db.QueryRow("SELECT COALESCE(user_id, 0) FROM accounts WHERE id = $1", accountID).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return result, fmt.Errorf("account %d not found", accountID)
+	}
+	if err != nil {
+		return
+	}
+
+	account, err := GetAccount(db, userID, accountID, "")
+	if err != nil {
+		return
+	}
+
+	categories := []Category{}
+	for _, value := range strings.Split(categoryIDs, ",") {
+		// without -category, rules give the categories
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+
+		categoryID, errAtoi := strconv.Atoi(strings.TrimSpace(value))
+		if errAtoi != nil {
+			return result, errors.New("-category must be a list of ids")
+		}
+
+		category, errCategory := GetCategory(db, userID, categoryID)
+		if errCategory != nil {
+			return result, fmt.Errorf("category %d not found", categoryID)
+		}
+
+		categories = append(categories, category)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	csvOptions := newCSVImportOptions()
+	csvOptions.AmountColumn = "amount"
+
+	rows, err := parseStatement(format, file, account, csvOptions)
+	if err != nil {
+		return
+	}
+
+	return importTransactions(db, account, categories, rows, dryRun)
+}
+
+// exportToStdout writes the accounts, categories or transactions of the user with email
+func exportToStdout(db *sql.DB, resource string, format string, email string, accountID int, from string, to string) (err error) {
+	if _, ok := exportFormats[resource]; !ok {
+		return errors.New("-export must be accounts, categories or transactions")
+	}
+
+	user, err := GetUserByEmail(db, email)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("user '%s' not found", email)
+	}
+	if err != nil {
+		return
+	}
+
+	filter := ExportFilter{AccountID: accountID}
+
+	if from != "" {
+		filter.From, err = time.Parse(dateLayout, from)
+		if err != nil {
+			return fmt.Errorf("-from must be like %s", dateLayout)
+		}
+	}
+
+	if to != "" {
+		filter.To, err = time.Parse(dateLayout, to)
+		if err != nil {
+			return fmt.Errorf("-to must be like %s", dateLayout)
+		}
+	}
+
+	output := bufio.NewWriter(os.Stdout)
+	err = Export(db, output, user.ID, resource, format, filter)
+	if err != nil {
+		return
+	}
+
+	return output.Flush()
+}
+
+// backupToFile writes the archive to a temporary file first, so a failed backup doesn't replace a good one
+func backupToFile(db *sql.DB, path string) (err error) {
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return
+	}
+
+	err = Backup(db, file)
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		os.Remove(path + ".tmp")
+		return
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+func restoreFromFile(db *sql.DB, path string) (err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	restored, err := Restore(db, file)
+	if err != nil {
+		return
+	}
+
+	for _, table := range backupTables {
+		fmt.Println(fmt.Sprintf("Restored %d %s", restored[table.name], strings.Replace(table.name, "_", " ", -1)))
+	}
+
+	return
 }
 
 func isCurrenciesEmpty(db *sql.DB) (ok bool) {
@@ -35,22 +258,49 @@ func main() {
 	serve := flag.Bool("serve", false, "initialize server")
 	scrape := flag.Bool("scrape", false, "initialize scrapper")
 	migrate := flag.Bool("migrate", false, "migrate database")
+	materialize := flag.Bool("materialize", false, "create the pending transactions of recurring transactions")
+	importPath := flag.String("import", "", "import a .csv, .ofx or .qfx statement, with -account and -category")
+	accountID := flag.Int("account", 0, "account receiving the imported transactions, or the only one exported")
+	importCategory := flag.String("category", "", "comma separated categories of the imported transactions no rule matches")
+	importDryRun := flag.Bool("dry-run", false, "only report what the import would create")
+	exportResource := flag.String("export", "", "write accounts, categories or transactions of -user to the standard output")
+	exportFormat := flag.String("format", "csv", "format of the export: csv, jsonl or ofx")
+	exportUser := flag.String("user", "", "email of the user to export")
+	exportFrom := flag.String("from", "", "export transactions since this date, like 2019-01-31")
+	exportTo := flag.String("to", "", "export transactions until this date, like 2019-01-31")
+	backupPath := flag.String("backup", "", "write an archive of the whole database to the file")
+	restorePath := flag.String("restore", "", "restore an archive from -backup into an empty database")
 	flag.Parse()
 
 	if len(os.Args) > 1 {
-		if flag.NFlag() != 1 {
-			fmt.Println("pass just one argument")
+		modes := 0
+		for _, mode := range []bool{*serve, *scrape, *migrate, *materialize, *importPath != "", *exportResource != "", *backupPath != "", *restorePath != ""} {
+			if mode {
+				modes++
+			}
+		}
+
+		if modes != 1 {
+			fmt.Println("pass just one of -serve, -scrape, -migrate, -materialize, -import, -export, -backup or -restore")
 			flag.Usage()
 			os.Exit(1)
 		}
 
+		// ROUNDING_MODE is how converted values are rounded to cents: truncate (default), half_up or half_even
+		if err := SetRoundingMode(os.Getenv("ROUNDING_MODE")); err != nil {
+			log.Fatal(err)
+		}
+
 		s := Server{}
 		s.Initialize()
 
 		if *serve {
-			if isCurrenciesEmpty(s.db) {
+			s.scheduler = initializeScheduler(s.db)
+			if s.scheduler == nil && isCurrenciesEmpty(s.db) {
+				// the server can start with some currencies missing, they are reported by the summary
 				initializeScrape(s.db)
 			}
+			s.materializer = initializeMaterializer(s.db)
 			s.Run(fmt.Sprintf(":%s", os.Getenv("PORT")))
 		}
 
@@ -59,7 +309,63 @@ func main() {
 		}
 
 		if *scrape {
-			initializeScrape(s.db)
+			_, err := initializeScrape(s.db)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		}
+
+		if *materialize {
+			created, err := MaterializeRecurringTransactions(s.db, time.Now())
+			fmt.Println(fmt.Sprintf("Created %d transactions", created))
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		}
+
+		if *importPath != "" {
+			result, err := importFile(s.db, *importPath, *accountID, *importCategory, *importDryRun)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			for _, row := range result.Rows {
+				if row.Status == importStatusError {
+					fmt.Println(fmt.Sprintf("line %d: %s", row.Line, row.Error))
+				}
+			}
+			fmt.Println(fmt.Sprintf("Created %d transactions, %d duplicates, %d errors", result.Created, result.Duplicates, result.Errors))
+
+			if result.Errors > 0 {
+				os.Exit(1)
+			}
+		}
+
+		if *exportResource != "" {
+			err := exportToStdout(s.db, *exportResource, strings.ToLower(*exportFormat), *exportUser, *accountID, *exportFrom, *exportTo)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+
+		if *backupPath != "" {
+			err := backupToFile(s.db, *backupPath)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		}
+
+		if *restorePath != "" {
+			err := restoreFromFile(s.db, *restorePath)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
 		}
 
 	} else {
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Materializer creates the transactions of the recurring transactions in the background,
+// it runs when started and then on a fixed interval
+type Materializer struct {
+	db       *sql.DB
+	interval time.Duration
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewMaterializer(db *sql.DB, interval time.Duration) *Materializer {
+	return &Materializer{db: db, interval: interval}
+}
+
+func (materializer *Materializer) Start() {
+	materializer.stop = make(chan struct{})
+	materializer.done = make(chan struct{})
+
+	go func() {
+		defer close(materializer.done)
+
+		materializer.run()
+
+		ticker := time.NewTicker(materializer.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				materializer.run()
+			case <-materializer.stop:
+				return
+			}
+		}
+	}()
+
+	log.Print(fmt.Sprintf("Materializer started, running every %s", materializer.interval))
+}
+
+// Stop waits for a running materialization to finish and stops the materializer
+func (materializer *Materializer) Stop() {
+	if materializer.stop == nil {
+		return
+	}
+
+	close(materializer.stop)
+	<-materializer.done
+
+	log.Print("Materializer stopped")
+}
+
+func (materializer *Materializer) run() {
+	created, err := MaterializeRecurringTransactions(materializer.db, time.Now())
+	if err != nil {
+		log.Print(fmt.Sprintf("Materializer failed after creating %d transactions: %s", created, err))
+		return
+	}
+
+	log.Print(fmt.Sprintf("Materializer created %d transactions", created))
+}
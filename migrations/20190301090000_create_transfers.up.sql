@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS transfers
+(
+id serial primary key,
+from_account_id int references accounts (id),
+to_account_id int references accounts (id),
+description varchar(255),
+value numeric(12,2) not null,
+rate numeric(12,2) not null,
+created_at timestamp not null,
+updated_at timestamp not null
+);
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS transfer_id int REFERENCES transfers ON DELETE CASCADE;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS transactions_account_id_date_idx;
+
+ALTER TABLE transfers DROP COLUMN IF EXISTS date;
+
+ALTER TABLE transactions DROP COLUMN IF EXISTS date;
@@ -0,0 +1,9 @@
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS date date;
+UPDATE transactions SET date = created_at::date WHERE date IS NULL;
+ALTER TABLE transactions ALTER COLUMN date SET NOT NULL;
+
+ALTER TABLE transfers ADD COLUMN IF NOT EXISTS date date;
+UPDATE transfers SET date = created_at::date WHERE date IS NULL;
+ALTER TABLE transfers ALTER COLUMN date SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS transactions_account_id_date_idx ON transactions (account_id, date);
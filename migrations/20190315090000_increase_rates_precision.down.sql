@@ -0,0 +1,3 @@
+ALTER TABLE transfers ALTER COLUMN rate TYPE numeric(12,2);
+
+ALTER TABLE rates ALTER COLUMN value TYPE numeric(12,2);
@@ -0,0 +1,3 @@
+ALTER TABLE rates ALTER COLUMN value TYPE numeric(20,10);
+
+ALTER TABLE transfers ALTER COLUMN rate TYPE numeric(20,10);
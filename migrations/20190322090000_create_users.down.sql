@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS categories_user_id_idx;
+
+DROP INDEX IF EXISTS accounts_user_id_idx;
+
+ALTER TABLE categories DROP COLUMN IF EXISTS user_id;
+
+ALTER TABLE accounts DROP COLUMN IF EXISTS user_id;
+
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS users
+(
+id serial primary key,
+email varchar(255) not null unique,
+name varchar(255),
+password_hash varchar(255) not null,
+created_at timestamp not null,
+updated_at timestamp not null
+);
+
+ALTER TABLE accounts ADD COLUMN user_id int REFERENCES users ON DELETE CASCADE;
+
+ALTER TABLE categories ADD COLUMN user_id int REFERENCES users ON DELETE CASCADE;
+
+-- existing accounts and categories go to the first registered user, who makes the owner required,
+-- without them it's required right away
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM accounts) THEN
+    ALTER TABLE accounts ALTER COLUMN user_id SET NOT NULL;
+  END IF;
+
+  IF NOT EXISTS (SELECT 1 FROM categories) THEN
+    ALTER TABLE categories ALTER COLUMN user_id SET NOT NULL;
+  END IF;
+END $$;
+
+CREATE INDEX accounts_user_id_idx ON accounts (user_id);
+
+CREATE INDEX categories_user_id_idx ON categories (user_id);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS api_keys
+(
+id serial primary key,
+user_id int not null REFERENCES users ON DELETE CASCADE,
+name varchar(255) not null,
+prefix varchar(255) not null,
+key_hash varchar(64) not null unique,
+read_only boolean not null default false,
+last_used_at timestamp,
+revoked_at timestamp,
+created_at timestamp not null
+);
+
+CREATE INDEX api_keys_user_id_idx ON api_keys (user_id);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS budgets
+(
+id serial primary key,
+user_id int not null REFERENCES users ON DELETE CASCADE,
+category_id int not null REFERENCES categories ON DELETE CASCADE,
+period varchar(255) not null,
+amount numeric(12,2) not null,
+currency_name varchar(255) not null REFERENCES currencies (name),
+rollover boolean not null default false,
+start_date date not null,
+created_at timestamp not null,
+updated_at timestamp not null
+);
+
+CREATE INDEX budgets_user_id_idx ON budgets (user_id);
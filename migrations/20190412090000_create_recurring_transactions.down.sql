@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS recurring_transactions_occurrences;
+
+DROP TABLE IF EXISTS recurring_transactions_categories;
+
+DROP TABLE IF EXISTS recurring_transactions;
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS recurring_transactions
+(
+id serial primary key,
+account_id int not null REFERENCES accounts ON DELETE CASCADE,
+description varchar(255),
+value numeric(12,2) not null,
+type varchar(255) not null,
+frequency varchar(255) not null,
+interval int not null default 1,
+start_date date not null,
+end_date date,
+count int,
+created_at timestamp not null,
+updated_at timestamp not null
+);
+
+CREATE TABLE IF NOT EXISTS recurring_transactions_categories
+(
+recurring_transaction_id int REFERENCES recurring_transactions ON DELETE CASCADE,
+category_id int REFERENCES categories,
+PRIMARY KEY (recurring_transaction_id, category_id)
+);
+
+CREATE TABLE IF NOT EXISTS recurring_transactions_occurrences
+(
+recurring_transaction_id int REFERENCES recurring_transactions ON DELETE CASCADE,
+date date not null,
+transaction_id int REFERENCES transactions ON DELETE SET NULL,
+PRIMARY KEY (recurring_transaction_id, date)
+);
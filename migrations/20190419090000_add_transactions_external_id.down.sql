@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS transactions_account_external_id_index;
+
+ALTER TABLE transactions DROP COLUMN IF EXISTS external_id;
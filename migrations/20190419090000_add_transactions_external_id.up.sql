@@ -0,0 +1,3 @@
+ALTER TABLE transactions ADD COLUMN external_id varchar(255);
+
+CREATE UNIQUE INDEX transactions_account_external_id_index ON transactions (account_id, external_id) WHERE external_id IS NOT NULL;
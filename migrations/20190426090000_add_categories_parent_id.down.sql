@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS categories_parent_id_index;
+
+ALTER TABLE categories DROP COLUMN IF EXISTS parent_id;
@@ -0,0 +1,3 @@
+ALTER TABLE categories ADD COLUMN parent_id int REFERENCES categories;
+
+CREATE INDEX categories_parent_id_index ON categories (parent_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS rules_categories;
+DROP TABLE IF EXISTS rules;
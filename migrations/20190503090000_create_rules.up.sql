@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS rules
+(
+id serial primary key,
+user_id int not null REFERENCES users ON DELETE CASCADE,
+name varchar(255) not null,
+priority int not null default 0,
+description varchar(255) not null default '',
+match varchar(255) not null default 'CONTAINS',
+min_value numeric(12,2),
+max_value numeric(12,2),
+account_id int REFERENCES accounts ON DELETE CASCADE,
+type varchar(255) not null default '',
+created_at timestamp not null,
+updated_at timestamp not null
+);
+
+CREATE TABLE IF NOT EXISTS rules_categories
+(
+rule_id int REFERENCES rules ON DELETE CASCADE,
+category_id int REFERENCES categories,
+PRIMARY KEY (rule_id, category_id)
+);
@@ -0,0 +1 @@
+ALTER TABLE transactions_categories DROP COLUMN IF EXISTS amount;
@@ -0,0 +1,14 @@
+ALTER TABLE transactions_categories ADD COLUMN amount numeric(12,2);
+
+-- the value of existing transactions is divided evenly, the cents left go to the lowest category ids
+UPDATE transactions_categories tc SET amount = s.amount
+FROM (
+  SELECT c.transaction_id, c.category_id,
+  (floor(t.value * 100 / count(*) OVER w)
+    + CASE WHEN row_number() OVER (w ORDER BY c.category_id) <= (t.value * 100)::bigint % count(*) OVER w THEN 1 ELSE 0 END
+  ) / 100 AS amount
+  FROM transactions_categories c
+  INNER JOIN transactions t ON (c.transaction_id = t.id)
+  WINDOW w AS (PARTITION BY c.transaction_id)
+) s
+WHERE tc.transaction_id = s.transaction_id AND tc.category_id = s.category_id AND tc.amount IS NULL;
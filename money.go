@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	// rateScale is the number of decimal places kept for exchange rates, matches rates.value numeric(20,10)
+	rateScale int32 = 10
+	// moneyScale is the number of decimal places of monetary values, matches numeric(12,2)
+	moneyScale int32 = 2
+)
+
+// roundingModes maps the accepted ROUNDING_MODE values to their rounding functions
+var roundingModes = map[string]func(decimal.Decimal, int32) decimal.Decimal{
+	"truncate":  decimal.Decimal.Truncate,
+	"half_up":   decimal.Decimal.Round,
+	"half_even": decimal.Decimal.RoundBank,
+}
+
+// roundingMode is used to round every converted monetary value, it defaults to "truncate"
+var roundingMode = "truncate"
+
+// SetRoundingMode changes how converted monetary values are rounded,
+// an empty mode keeps the default
+func SetRoundingMode(mode string) error {
+	if mode == "" {
+		return nil
+	}
+
+	mode = strings.ToLower(mode)
+	if _, ok := roundingModes[mode]; !ok {
+		return fmt.Errorf("rounding mode '%s' not supported, use 'truncate', 'half_up' or 'half_even'", mode)
+	}
+
+	roundingMode = mode
+
+	return nil
+}
+
+// roundMoney rounds a monetary value to cents, it must only be applied to final results,
+// never to the rates or intermediate sums used to calculate them
+func roundMoney(value decimal.Decimal) decimal.Decimal {
+	return roundingModes[roundingMode](value, moneyScale)
+}
+
+// roundRate rounds an exchange rate to the precision stored in the database
+func roundRate(value decimal.Decimal) decimal.Decimal {
+	return value.Round(rateScale)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	. "github.com/jonatasbaldin/fin/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoundMoney(t *testing.T) {
+	defer SetRoundingMode("truncate")
+
+	values := map[string][]string{
+		"truncate":  {"1.23", "1.22", "-1.23"},
+		"half_up":   {"1.24", "1.23", "-1.24"},
+		"half_even": {"1.24", "1.22", "-1.24"},
+	}
+
+	for mode, expected := range values {
+		err := SetRoundingMode(mode)
+		assert.Nil(t, err)
+
+		assert.Equal(t, roundMoney(Decimal("1.2350")).String(), expected[0], mode)
+		assert.Equal(t, roundMoney(Decimal("1.2250")).String(), expected[1], mode)
+		assert.Equal(t, roundMoney(Decimal("-1.2351")).String(), expected[2], mode)
+	}
+}
+
+func TestSetRoundingModeInvalid(t *testing.T) {
+	err := SetRoundingMode("ceil")
+	assert.NotNil(t, err)
+	assert.Equal(t, roundingMode, "truncate")
+}
+
+func TestRoundRate(t *testing.T) {
+	assert.Equal(t, roundRate(Decimal("0.006712345678")).String(), "0.0067123457")
+}
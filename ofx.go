@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ofxStatement is what matters of an OFX file, the transactions and their currency
+type ofxStatement struct {
+	Currency string
+	Rows     []ImportRow
+}
+
+// ofxIncomeTypes and ofxExpenseTypes map TRNTYPE to a Transaction type,
+// the others, like XFER and OTHER, use the sign of TRNAMT
+var ofxIncomeTypes = map[string]bool{
+	"CREDIT":    true,
+	"DEP":       true,
+	"DIRECTDEP": true,
+	"DIV":       true,
+	"INT":       true,
+}
+
+var ofxExpenseTypes = map[string]bool{
+	"ATM":         true,
+	"CASH":        true,
+	"CHECK":       true,
+	"DEBIT":       true,
+	"DIRECTDEBIT": true,
+	"FEE":         true,
+	"PAYMENT":     true,
+	"POS":         true,
+	"REPEATPMT":   true,
+	"SRVCHG":      true,
+}
+
+// ofxTag matches an opening or closing tag and the text after it
+var ofxTag = regexp.MustCompile(`<(/?)([A-Za-z0-9_.]+)[^>]*>([^<]*)`)
+
+// parseOFX reads OFX and QFX files, both 1.x, which is SGML and doesn't close the elements with values,
+// and 2.x, which is XML. Only the tags are read, so both are handled the same way.
+func parseOFX(reader io.Reader) (statement ofxStatement, err error) {
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return
+	}
+
+	text := string(content)
+	start := strings.Index(strings.ToUpper(text), "<OFX>")
+	if start < 0 {
+		return statement, errors.New("invalid ofx: <OFX> not found")
+	}
+
+	line := 1 + strings.Count(text[:start], "\n")
+	previousEnd := start
+	statement.Rows = []ImportRow{}
+
+	var transaction map[string]string
+	var transactionLine int
+
+	closeTransaction := func() {
+		if transaction == nil {
+			return
+		}
+
+		row := ImportRow{Line: transactionLine}
+		errRow := parseOFXTransaction(transaction, &row)
+		if errRow != nil {
+			row.Status = importStatusError
+			row.Error = errRow.Error()
+		}
+
+		statement.Rows = append(statement.Rows, row)
+		transaction = nil
+	}
+
+	for _, match := range ofxTag.FindAllStringSubmatchIndex(text[start:], -1) {
+		matchStart := start + match[0]
+		line += strings.Count(text[previousEnd:matchStart], "\n")
+		previousEnd = matchStart
+
+		closing := match[3] > match[2]
+		tag := strings.ToUpper(text[start+match[4] : start+match[5]])
+		value := strings.TrimSpace(html.UnescapeString(text[start+match[6] : start+match[7]]))
+
+		switch {
+		case tag == "STMTTRN" && !closing:
+			// in SGML a missing closing tag is tolerated
+			closeTransaction()
+			transaction = map[string]string{}
+			transactionLine = line
+		case tag == "STMTTRN" || tag == "BANKTRANLIST":
+			closeTransaction()
+		case closing || value == "":
+		case tag == "CURDEF":
+			currency := strings.ToUpper(value)
+			if statement.Currency != "" && statement.Currency != currency {
+				return statement, fmt.Errorf("invalid ofx: statements in '%s' and '%s' in the same file", statement.Currency, currency)
+			}
+			statement.Currency = currency
+		case transaction != nil:
+			if _, ok := transaction[tag]; !ok {
+				transaction[tag] = value
+			}
+		}
+	}
+
+	closeTransaction()
+
+	return statement, nil
+}
+
+// parseOFXTransaction fills the row from a STMTTRN, keeping the FITID to find duplicates
+func parseOFXTransaction(transaction map[string]string, row *ImportRow) error {
+	row.ExternalID = transaction["FITID"]
+
+	row.Description = transaction["NAME"]
+	if row.Description == "" {
+		row.Description = transaction["MEMO"]
+	}
+
+	posted := transaction["DTPOSTED"]
+	if posted == "" {
+		posted = transaction["DTUSER"]
+	}
+
+	// dates are like 20190131, optionally followed by the time and the timezone
+	if len(posted) < 8 {
+		return fmt.Errorf("date '%s' must be like 20190131", posted)
+	}
+
+	date, err := time.Parse("20060102", posted[:8])
+	if err != nil {
+		return fmt.Errorf("date '%s' must be like 20190131", posted)
+	}
+	row.Date = date.Format(dateLayout)
+
+	amountValue := transaction["TRNAMT"]
+	// some banks use a comma as decimal separator
+	if !strings.Contains(amountValue, ".") {
+		amountValue = strings.Replace(amountValue, ",", ".", 1)
+	}
+
+	amount, err := decimal.NewFromString(strings.TrimPrefix(amountValue, "+"))
+	if err != nil {
+		return fmt.Errorf("amount '%s' is not a number", transaction["TRNAMT"])
+	}
+	if amount.IsZero() {
+		return errors.New("amount must not be 0")
+	}
+	row.Value = amount.Abs()
+
+	transactionType := strings.ToUpper(transaction["TRNTYPE"])
+	switch {
+	case ofxIncomeTypes[transactionType]:
+		row.Type = "INCOME"
+	case ofxExpenseTypes[transactionType]:
+		row.Type = "EXPENSE"
+	case amount.LessThan(decimal.New(0, 0)):
+		row.Type = "EXPENSE"
+	default:
+		row.Type = "INCOME"
+	}
+
+	return nil
+}
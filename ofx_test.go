@@ -0,0 +1,112 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const sgmlStatement = `OFXHEADER:100
+DATA:OFXSGML
+VERSION:102
+ENCODING:USASCII
+CHARSET:1252
+
+<OFX>
+<BANKMSGSRSV1>
+<STMTTRNRS>
+<STMTRS>
+<CURDEF>EUR
+<BANKTRANLIST>
+<DTSTART>20190101
+<DTEND>20190131
+<STMTTRN>
+<TRNTYPE>POS
+<DTPOSTED>20190105120000.000[-5:EST]
+<TRNAMT>-3.50
+<FITID>2019010501
+<NAME>Coffee &amp; Cake
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>XFER
+<DTPOSTED>20190106
+<TRNAMT>1000,00
+<FITID>2019010601
+<MEMO>Salary
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>DEBIT
+<DTPOSTED>2019
+<TRNAMT>-10
+<FITID>2019010701
+</STMTTRN>
+</BANKTRANLIST>
+</STMTRS>
+</STMTTRNRS>
+</BANKMSGSRSV1>
+</OFX>
+`
+
+const xmlStatement = `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<?OFX OFXHEADER="200" VERSION="211" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+<OFX>
+  <CREDITCARDMSGSRSV1>
+    <CCSTMTTRNRS>
+      <CCSTMTRS>
+        <CURDEF>USD</CURDEF>
+        <BANKTRANLIST>
+          <STMTTRN>
+            <TRNTYPE>CREDIT</TRNTYPE>
+            <DTPOSTED>20190210</DTPOSTED>
+            <TRNAMT>25.00</TRNAMT>
+            <FITID>A1</FITID>
+            <NAME>Refund</NAME>
+          </STMTTRN>
+        </BANKTRANLIST>
+      </CCSTMTRS>
+    </CCSTMTTRNRS>
+  </CREDITCARDMSGSRSV1>
+</OFX>
+`
+
+func TestParseOFXSGML(t *testing.T) {
+	statement, err := parseOFX(strings.NewReader(sgmlStatement))
+	assert.Nil(t, err)
+
+	assert.Equal(t, statement.Currency, "EUR")
+	assert.Equal(t, len(statement.Rows), 3)
+
+	assert.Equal(t, statement.Rows[0].Line, 15)
+	assert.Equal(t, statement.Rows[0].Date, "2019-01-05")
+	assert.Equal(t, statement.Rows[0].Description, "Coffee & Cake")
+	assert.Equal(t, statement.Rows[0].Value.String(), "3.5")
+	assert.Equal(t, statement.Rows[0].Type, "EXPENSE")
+	assert.Equal(t, statement.Rows[0].ExternalID, "2019010501")
+
+	assert.Equal(t, statement.Rows[1].Description, "Salary")
+	assert.Equal(t, statement.Rows[1].Value.String(), "1000")
+	assert.Equal(t, statement.Rows[1].Type, "INCOME")
+
+	assert.Equal(t, statement.Rows[2].Status, "error")
+	assert.Equal(t, statement.Rows[2].Error, "date '2019' must be like 20190131")
+}
+
+func TestParseOFXXML(t *testing.T) {
+	statement, err := parseOFX(strings.NewReader(xmlStatement))
+	assert.Nil(t, err)
+
+	assert.Equal(t, statement.Currency, "USD")
+	assert.Equal(t, len(statement.Rows), 1)
+	assert.Equal(t, statement.Rows[0].Line, 9)
+	assert.Equal(t, statement.Rows[0].Date, "2019-02-10")
+	assert.Equal(t, statement.Rows[0].Value.String(), "25")
+	assert.Equal(t, statement.Rows[0].Type, "INCOME")
+	assert.Equal(t, statement.Rows[0].ExternalID, "A1")
+	assert.Equal(t, statement.Rows[0].Status, "")
+}
+
+func TestParseOFXInvalid(t *testing.T) {
+	_, err := parseOFX(strings.NewReader("date,description,amount\n"))
+	assert.Equal(t, err.Error(), "invalid ofx: <OFX> not found")
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	passwordSaltSize = 16
+	passwordKeySize  = 32
+)
+
+// passwordIterations is the PBKDF2 cost of new password hashes,
+// the cost of existing hashes is read from the hash itself
+var passwordIterations = 100000
+
+// hashPassword derives a key from the password with PBKDF2-HMAC-SHA256 and a random salt,
+// the result looks like "pbkdf2-sha256$100000$<salt>$<key>"
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, passwordSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := pbkdf2SHA256([]byte(password), salt, passwordIterations, passwordKeySize)
+
+	return fmt.Sprintf(
+		"pbkdf2-sha256$%d$%s$%s",
+		passwordIterations,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// checkPassword tells if the password matches a hash created by hashPassword
+func checkPassword(password string, hash string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations < 1 {
+		return false
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+
+	derived := pbkdf2SHA256([]byte(password), salt, iterations, len(key))
+
+	return subtle.ConstantTimeCompare(derived, key) == 1
+}
+
+// pbkdf2SHA256 implements PBKDF2 from RFC 8018 using HMAC-SHA256 as the pseudorandom function
+func pbkdf2SHA256(password []byte, salt []byte, iterations int, keySize int) []byte {
+	prf := hmac.New(sha256.New, password)
+	blocks := (keySize + prf.Size() - 1) / prf.Size()
+
+	key := make([]byte, 0, blocks*prf.Size())
+	counter := make([]byte, 4)
+
+	for block := 1; block <= blocks; block++ {
+		binary.BigEndian.PutUint32(counter, uint32(block))
+
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(counter)
+		u := prf.Sum(nil)
+
+		t := make([]byte, len(u))
+		copy(t, u)
+
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+
+		key = append(key, t...)
+	}
+
+	return key[:keySize]
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPBKDF2SHA256(t *testing.T) {
+	// test vector from RFC 7914, section 11
+	key := pbkdf2SHA256([]byte("passwd"), []byte("salt"), 1, 64)
+	assert.Equal(
+		t,
+		hex.EncodeToString(key),
+		"55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783",
+	)
+}
+
+func TestHashPassword(t *testing.T) {
+	hash, err := hashPassword("my-secret-password")
+	assert.Nil(t, err)
+
+	assert.True(t, checkPassword("my-secret-password", hash))
+	assert.False(t, checkPassword("other-password", hash))
+	assert.False(t, checkPassword("my-secret-password", "not-a-hash"))
+}
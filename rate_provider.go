@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const ecbDailyURL string = "https://www.ecb.europa.eu/stats/eurofxref/eurofxref-daily.xml"
+
+// RateProvider gets the exchange rates of a base currency from an upstream source
+type RateProvider interface {
+	Name() string
+	GetExchangeRates(base string) (ExchangeRates, error)
+}
+
+// NewRateProvider builds the provider chain from a comma separated list of provider names,
+// like "exchangeratesapi,ecb", the first one is the primary and the others are fallbacks
+func NewRateProvider(names string, client httpClient) (RateProvider, error) {
+	if names == "" {
+		names = "exchangeratesapi"
+	}
+
+	providers := []RateProvider{}
+
+	for _, name := range strings.Split(names, ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "exchangeratesapi":
+			providers = append(providers, ExchangeRatesAPIProvider{URL: exchangeRateAPIURL, Client: client})
+		case "ecb":
+			providers = append(providers, ECBProvider{URL: ecbDailyURL, Client: client})
+		default:
+			return nil, fmt.Errorf("rate provider '%s' not supported", name)
+		}
+	}
+
+	if len(providers) == 1 {
+		return providers[0], nil
+	}
+
+	return FallbackProvider{Providers: providers}, nil
+}
+
+// ExchangeRatesAPIProvider reads the JSON from exchangeratesapi.io
+type ExchangeRatesAPIProvider struct {
+	URL    string
+	Client httpClient
+}
+
+func (provider ExchangeRatesAPIProvider) Name() string {
+	return "exchangeratesapi"
+}
+
+func (provider ExchangeRatesAPIProvider) GetExchangeRates(base string) (er ExchangeRates, err error) {
+	url := provider.URL + fmt.Sprintf("/latest?base=%s", base)
+	log.Print(fmt.Sprintf("Getting ExchageRate from %s", url))
+
+	resp, err := provider.Client.Get(url)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return er, fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&er)
+	if err != nil {
+		return er, fmt.Errorf("could not decode response from %s: %s", url, err)
+	}
+
+	return
+}
+
+// ECBProvider reads the daily XML feed from the European Central Bank,
+// which only has EUR based rates, so other bases are calculated from them
+type ECBProvider struct {
+	URL    string
+	Client httpClient
+}
+
+type ecbEnvelope struct {
+	Cube struct {
+		Cube struct {
+			Time  string `xml:"time,attr"`
+			Rates []struct {
+				Currency string  `xml:"currency,attr"`
+				Rate     float64 `xml:"rate,attr"`
+			} `xml:"Cube"`
+		} `xml:"Cube"`
+	} `xml:"Cube"`
+}
+
+func (provider ECBProvider) Name() string {
+	return "ecb"
+}
+
+func (provider ECBProvider) GetExchangeRates(base string) (er ExchangeRates, err error) {
+	log.Print(fmt.Sprintf("Getting ExchageRate from %s", provider.URL))
+
+	resp, err := provider.Client.Get(provider.URL)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return er, fmt.Errorf("%s returned status %d", provider.URL, resp.StatusCode)
+	}
+
+	var envelope ecbEnvelope
+	err = xml.NewDecoder(resp.Body).Decode(&envelope)
+	if err != nil {
+		return er, fmt.Errorf("could not decode response from %s: %s", provider.URL, err)
+	}
+
+	euroRates := map[string]float64{"EUR": 1}
+	for _, rate := range envelope.Cube.Cube.Rates {
+		euroRates[rate.Currency] = rate.Rate
+	}
+
+	baseRate, ok := euroRates[base]
+	if !ok || baseRate == 0 {
+		return er, fmt.Errorf("%s has no rate for '%s'", provider.URL, base)
+	}
+
+	er.Base = base
+	er.Date = envelope.Cube.Cube.Time
+	er.Rates = map[string]float64{}
+
+	for name, value := range euroRates {
+		if name != base {
+			er.Rates[name] = value / baseRate
+		}
+	}
+
+	return
+}
+
+// FallbackProvider tries each provider in order, until one of them succeeds
+type FallbackProvider struct {
+	Providers []RateProvider
+}
+
+func (provider FallbackProvider) Name() string {
+	names := []string{}
+	for _, p := range provider.Providers {
+		names = append(names, p.Name())
+	}
+
+	return strings.Join(names, ",")
+}
+
+func (provider FallbackProvider) GetExchangeRates(base string) (er ExchangeRates, err error) {
+	errs := []string{}
+
+	for _, p := range provider.Providers {
+		er, err = p.GetExchangeRates(base)
+		if err == nil {
+			return
+		}
+
+		log.Print(fmt.Sprintf("Rate provider %s failed for %s: %s", p.Name(), base, err))
+		errs = append(errs, fmt.Sprintf("%s: %s", p.Name(), err))
+	}
+
+	return er, fmt.Errorf("all rate providers failed for '%s': %s", base, strings.Join(errs, "; "))
+}
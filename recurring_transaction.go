@@ -0,0 +1,612 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/shopspring/decimal"
+)
+
+// maxOccurrences caps how many occurrences are calculated at once,
+// so a daily schedule without an end can't loop forever
+const maxOccurrences = 1000
+
+// RecurringTransaction is the template of a Transaction repeated on a schedule,
+// like "every 2 weeks" or "monthly, 12 times", the materializer creates the real transactions
+type RecurringTransaction struct {
+	ID          int             `json:"id"`
+	Account     Account         `json:"account"`
+	Description string          `json:"description"`
+	Value       decimal.Decimal `json:"value"`
+	Type        string          `json:"type"`
+	Categories  []Category      `json:"categories"`
+	Frequency   string          `json:"frequency"`
+	Interval    int             `json:"interval"`
+	StartDate   string          `json:"start_date"`
+	EndDate     string          `json:"end_date,omitempty"`
+	Count       int             `json:"count,omitempty"`
+	CreatedAt   string          `json:"created_at"`
+	UpdatedAt   string          `json:"updated_at"`
+}
+
+// RecurringOccurrence is one date of the schedule, Materialized tells if its Transaction was already created
+type RecurringOccurrence struct {
+	Date          string          `json:"date"`
+	Description   string          `json:"description"`
+	Value         decimal.Decimal `json:"value"`
+	Type          string          `json:"type"`
+	Materialized  bool            `json:"materialized"`
+	TransactionID int             `json:"transaction_id,omitempty"`
+}
+
+const recurringTransactionColumns = `r.id, r.account_id, a.user_id, r.description, r.value, r.type, r.frequency, r.interval,
+	to_char(r.start_date, 'YYYY-MM-DD'), COALESCE(to_char(r.end_date, 'YYYY-MM-DD'), ''), COALESCE(r.count, 0), r.created_at, r.updated_at`
+
+func ListRecurringTransactions(db *sql.DB, userID int) ([]RecurringTransaction, error) {
+	return listRecurringTransactions(db, "a.user_id = $1", userID)
+}
+
+// listAllRecurringTransactions returns the recurring transactions of every User, for the materializer
+func listAllRecurringTransactions(db *sql.DB) ([]RecurringTransaction, error) {
+	return listRecurringTransactions(db, "TRUE")
+}
+
+func listRecurringTransactions(db *sql.DB, where string, args ...interface{}) ([]RecurringTransaction, error) {
+	rows, err := db.Query(
+		`SELECT `+recurringTransactionColumns+`
+		FROM recurring_transactions r INNER JOIN accounts a ON (r.account_id = a.id)
+		WHERE `+where+`
+		ORDER BY r.id`,
+		args...,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	recurrings := []RecurringTransaction{}
+
+	for rows.Next() {
+		var recurring RecurringTransaction
+		errScan := recurring.scan(rows)
+		if errScan != nil {
+			return nil, errScan
+		}
+
+		recurrings = append(recurrings, recurring)
+	}
+
+	for index := range recurrings {
+		errCat := recurrings[index].getRelatedCategories(db)
+		if errCat != nil {
+			return nil, errCat
+		}
+	}
+
+	return recurrings, nil
+}
+
+func GetRecurringTransaction(db *sql.DB, userID int, id int) (recurring RecurringTransaction, err error) {
+	row := db.QueryRow(
+		`SELECT `+recurringTransactionColumns+`
+		FROM recurring_transactions r INNER JOIN accounts a ON (r.account_id = a.id)
+		WHERE r.id = $1 AND a.user_id = $2`, id, userID,
+	)
+
+	err = recurring.scan(row)
+	if err != nil {
+		return
+	}
+
+	err = recurring.getRelatedCategories(db)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (recurring *RecurringTransaction) scan(row rowScanner) error {
+	return row.Scan(
+		&recurring.ID,
+		&recurring.Account.ID,
+		&recurring.Account.UserID,
+		&recurring.Description,
+		&recurring.Value,
+		&recurring.Type,
+		&recurring.Frequency,
+		&recurring.Interval,
+		&recurring.StartDate,
+		&recurring.EndDate,
+		&recurring.Count,
+		&recurring.CreatedAt,
+		&recurring.UpdatedAt,
+	)
+}
+
+func (recurring *RecurringTransaction) getRelatedCategories(db *sql.DB) (err error) {
+	rows, err := db.Query(
+		"SELECT category_id FROM recurring_transactions_categories WHERE recurring_transaction_id = $1 ORDER BY category_id",
+		recurring.ID,
+	)
+
+	if err != nil {
+		return
+	}
+
+	ids := []int{}
+
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			return
+		}
+
+		ids = append(ids, id)
+	}
+
+	recurring.Categories = []Category{}
+
+	for _, id := range ids {
+		category, errCat := GetCategory(db, recurring.Account.UserID, id)
+		if errCat != nil {
+			return errCat
+		}
+
+		recurring.Categories = append(recurring.Categories, category)
+	}
+
+	return
+}
+
+func (recurring *RecurringTransaction) saveRelatedCategories(db *sql.DB, tx *sql.Tx) (err error) {
+	_, err = tx.Exec(
+		"DELETE FROM recurring_transactions_categories WHERE recurring_transaction_id = $1",
+		recurring.ID,
+	)
+	if err != nil {
+		return
+	}
+
+	for index, structCategory := range recurring.Categories {
+		category, errCat := GetCategory(db, recurring.Account.UserID, structCategory.ID)
+		if errCat != nil {
+			return fmt.Errorf("category %d not found", structCategory.ID)
+		}
+
+		recurring.Categories[index] = category
+
+		_, err = tx.Exec(
+			"INSERT INTO recurring_transactions_categories(recurring_transaction_id, category_id) VALUES($1, $2)",
+			recurring.ID,
+			category.ID,
+		)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func (recurring *RecurringTransaction) Create(db *sql.DB) (err error) {
+	createdAt := time.Now()
+
+	if recurring.StartDate == "" {
+		recurring.StartDate = createdAt.Format(dateLayout)
+	}
+
+	if recurring.Interval == 0 {
+		recurring.Interval = 1
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+
+	err = tx.QueryRow(
+		`INSERT INTO recurring_transactions(account_id, description, value, type, frequency, interval, start_date, end_date, count, created_at, updated_at)
+		VALUES($1, $2, $3, $4, $5, $6, $7, NULLIF($8, '')::date, NULLIF($9, 0), $10, $11)
+		RETURNING id, created_at, updated_at`,
+		recurring.Account.ID,
+		recurring.Description,
+		recurring.Value,
+		recurring.Type,
+		recurring.Frequency,
+		recurring.Interval,
+		recurring.StartDate,
+		recurring.EndDate,
+		recurring.Count,
+		createdAt,
+		createdAt,
+	).Scan(&recurring.ID, &recurring.CreatedAt, &recurring.UpdatedAt)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+
+	err = recurring.saveRelatedCategories(db, tx)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// Update changes the schedule of an Account of its User, occurrences already materialized are kept
+func (recurring *RecurringTransaction) Update(db *sql.DB) (err error) {
+	updatedAt := time.Now()
+
+	if recurring.Interval == 0 {
+		recurring.Interval = 1
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+
+	err = tx.QueryRow(
+		`UPDATE recurring_transactions
+		SET description = $1, value = $2, type = $3, frequency = $4, interval = $5, start_date = $6,
+		end_date = NULLIF($7, '')::date, count = NULLIF($8, 0), updated_at = $9
+		WHERE id = $10 AND account_id IN (SELECT id FROM accounts WHERE user_id = $11)
+		RETURNING updated_at`,
+		recurring.Description,
+		recurring.Value,
+		recurring.Type,
+		recurring.Frequency,
+		recurring.Interval,
+		recurring.StartDate,
+		recurring.EndDate,
+		recurring.Count,
+		updatedAt,
+		recurring.ID,
+		recurring.Account.UserID,
+	).Scan(&recurring.UpdatedAt)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+
+	err = recurring.saveRelatedCategories(db, tx)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// Delete removes the schedule, the transactions it created are kept
+func (recurring *RecurringTransaction) Delete(db *sql.DB) (err error) {
+	_, err = db.Exec(
+		"DELETE FROM recurring_transactions WHERE id = $1",
+		recurring.ID,
+	)
+
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// Occurrences returns the dates of the schedule between from and to, both inclusive
+func (recurring RecurringTransaction) Occurrences(from time.Time, to time.Time) ([]time.Time, error) {
+	return recurring.occurrencesExcept(from, to, nil)
+}
+
+// occurrencesExcept is like Occurrences, leaving out the recorded dates, which don't count for maxOccurrences
+func (recurring RecurringTransaction) occurrencesExcept(from time.Time, to time.Time, recorded map[string]int) ([]time.Time, error) {
+	start, err := time.Parse(dateLayout, recurring.StartDate)
+	if err != nil {
+		return nil, err
+	}
+
+	end := to
+	if recurring.EndDate != "" {
+		endDate, errDate := time.Parse(dateLayout, recurring.EndDate)
+		if errDate != nil {
+			return nil, errDate
+		}
+
+		if endDate.Before(end) {
+			end = endDate
+		}
+	}
+
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	end = time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, time.UTC)
+
+	dates := []time.Time{}
+
+	for n := 0; recurring.Count == 0 || n < recurring.Count; n++ {
+		date := recurring.occurrence(start, n)
+		if date.After(end) || len(dates) >= maxOccurrences {
+			break
+		}
+
+		if _, ok := recorded[date.Format(dateLayout)]; ok {
+			continue
+		}
+
+		if !date.Before(from) {
+			dates = append(dates, date)
+		}
+	}
+
+	return dates, nil
+}
+
+// occurrence calculates the nth date from the start, instead of adding to the previous one,
+// so a schedule starting on the 31st stays at the end of the month after February
+func (recurring RecurringTransaction) occurrence(start time.Time, n int) time.Time {
+	steps := n * recurring.Interval
+
+	switch recurring.Frequency {
+	case "DAILY":
+		return start.AddDate(0, 0, steps)
+	case "WEEKLY":
+		return start.AddDate(0, 0, 7*steps)
+	case "YEARLY":
+		return addMonthsClamped(start, 12*steps)
+	default:
+		return addMonthsClamped(start, steps)
+	}
+}
+
+// addMonthsClamped adds months to date, using the last day of the month when the day doesn't exist,
+// like January 31 plus one month is February 28
+func addMonthsClamped(date time.Time, months int) time.Time {
+	firstDay := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, months, 0)
+	lastDay := firstDay.AddDate(0, 1, -1).Day()
+
+	day := date.Day()
+	if day > lastDay {
+		day = lastDay
+	}
+
+	return time.Date(firstDay.Year(), firstDay.Month(), day, 0, 0, 0, 0, time.UTC)
+}
+
+// Preview returns the next occurrences from the given date, up to limit
+func (recurring RecurringTransaction) Preview(db *sql.DB, from time.Time, limit int) ([]RecurringOccurrence, error) {
+	// limit periods of the longest frequency is enough to find limit occurrences
+	to := from.AddDate(limit*recurring.Interval, 0, 0)
+
+	dates, err := recurring.Occurrences(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(dates) > limit {
+		dates = dates[:limit]
+	}
+
+	materialized, err := recurring.materializedOccurrences(db)
+	if err != nil {
+		return nil, err
+	}
+
+	occurrences := []RecurringOccurrence{}
+
+	for _, date := range dates {
+		transactionID, ok := materialized[date.Format(dateLayout)]
+
+		occurrences = append(occurrences, RecurringOccurrence{
+			Date:          date.Format(dateLayout),
+			Description:   recurring.Description,
+			Value:         recurring.Value,
+			Type:          recurring.Type,
+			Materialized:  ok,
+			TransactionID: transactionID,
+		})
+	}
+
+	return occurrences, nil
+}
+
+// materializedOccurrences maps the dates already materialized to their transaction ids,
+// the id is 0 when the transaction was deleted afterwards
+func (recurring RecurringTransaction) materializedOccurrences(db *sql.DB) (map[string]int, error) {
+	rows, err := db.Query(
+		`SELECT to_char(date, 'YYYY-MM-DD'), COALESCE(transaction_id, 0)
+		FROM recurring_transactions_occurrences WHERE recurring_transaction_id = $1`,
+		recurring.ID,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	materialized := map[string]int{}
+
+	for rows.Next() {
+		var date string
+		var transactionID int
+
+		errScan := rows.Scan(&date, &transactionID)
+		if errScan != nil {
+			return nil, errScan
+		}
+
+		materialized[date] = transactionID
+	}
+
+	return materialized, rows.Err()
+}
+
+// materialize creates the transactions of every occurrence up to until, each one only once:
+// the occurrence is recorded in the same db transaction, so a deleted Transaction isn't created again.
+// The recorded occurrences are skipped, so maxOccurrences only limits the new ones,
+// and dates added by an earlier start_date or a shorter interval are still created.
+func (recurring RecurringTransaction) materialize(db *sql.DB, until time.Time) (created int, err error) {
+	materialized, err := recurring.materializedOccurrences(db)
+	if err != nil {
+		return
+	}
+
+	dates, err := recurring.occurrencesExcept(time.Time{}, until, materialized)
+	if err != nil {
+		return
+	}
+
+	for _, date := range dates {
+		tx, errTx := db.Begin()
+		if errTx != nil {
+			return created, errTx
+		}
+
+		var recorded bool
+		err = tx.QueryRow(
+			`INSERT INTO recurring_transactions_occurrences(recurring_transaction_id, date)
+			VALUES($1, $2)
+			ON CONFLICT DO NOTHING
+			RETURNING true`,
+			recurring.ID,
+			date.Format(dateLayout),
+		).Scan(&recorded)
+
+		if err == sql.ErrNoRows {
+			tx.Rollback()
+			err = nil
+			continue
+		}
+
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		transaction := Transaction{
+			Account:     recurring.Account,
+			Description: recurring.Description,
+			Value:       recurring.Value,
+			Type:        recurring.Type,
+			Date:        date.Format(dateLayout),
+			Categories:  append([]Category{}, recurring.Categories...),
+		}
+
+		err = transaction.insert(db, tx)
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		_, err = tx.Exec(
+			`UPDATE recurring_transactions_occurrences SET transaction_id = $1
+			WHERE recurring_transaction_id = $2 AND date = $3`,
+			transaction.ID,
+			recurring.ID,
+			date.Format(dateLayout),
+		)
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return
+		}
+
+		created++
+	}
+
+	return
+}
+
+// MaterializeRecurringTransactions creates the pending transactions of every User up to until,
+// running it many times, even concurrently, creates each occurrence only once
+func MaterializeRecurringTransactions(db *sql.DB, until time.Time) (created int, err error) {
+	recurrings, err := listAllRecurringTransactions(db)
+	if err != nil {
+		return
+	}
+
+	for _, recurring := range recurrings {
+		count, errMaterialize := recurring.materialize(db, until)
+		created += count
+
+		if errMaterialize != nil {
+			return created, fmt.Errorf("recurring transaction %d: %s", recurring.ID, errMaterialize)
+		}
+	}
+
+	return
+}
+
+func (recurring RecurringTransaction) Validate() (err error) {
+	typeCheck := regexp.MustCompile(`^(INCOME|EXPENSE)$`)
+	if !typeCheck.MatchString(recurring.Type) {
+		err = errors.New("field 'type' must be 'INCOME' or 'EXPENSE'")
+	}
+
+	if recurring.Value.LessThanOrEqual(decimal.NewFromFloat(0)) != false {
+		err = errors.New("field 'value' must be more than 0")
+	}
+
+	valueCheck := regexp.MustCompile(`^\d*(\.\d{1,2}|\d)$`)
+	if !valueCheck.MatchString(recurring.Value.String()) {
+		err = errors.New("field 'value' must be like 1.99")
+	}
+
+	if len(recurring.Categories) <= 0 {
+		err = errors.New("field 'categories' must not be empty")
+	}
+
+	frequencyCheck := regexp.MustCompile(`^(DAILY|WEEKLY|MONTHLY|YEARLY)$`)
+	if !frequencyCheck.MatchString(recurring.Frequency) {
+		err = errors.New("field 'frequency' must be 'DAILY', 'WEEKLY', 'MONTHLY' or 'YEARLY'")
+	}
+
+	if recurring.Interval < 0 {
+		err = errors.New("field 'interval' must be more than 0")
+	}
+
+	if recurring.Count < 0 {
+		err = errors.New("field 'count' must be more than 0")
+	}
+
+	var start, end time.Time
+	var errStart, errEnd error
+
+	if recurring.StartDate != "" {
+		start, errStart = time.Parse(dateLayout, recurring.StartDate)
+		if errStart != nil {
+			err = errors.New("field 'start_date' must be like 2019-01-31")
+		}
+	}
+
+	if recurring.EndDate != "" {
+		end, errEnd = time.Parse(dateLayout, recurring.EndDate)
+		if errEnd != nil {
+			err = errors.New("field 'end_date' must be like 2019-01-31")
+		}
+	}
+
+	if recurring.StartDate != "" && recurring.EndDate != "" && errStart == nil && errEnd == nil && end.Before(start) {
+		err = errors.New("field 'end_date' must not be before 'start_date'")
+	}
+
+	return
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultPreviewLimit = 10
+	maxPreviewLimit     = 100
+)
+
+func (s *Server) ListRecurringTransactions(w http.ResponseWriter, r *http.Request) {
+	recurrings, err := ListRecurringTransactions(s.db, currentUser(r).ID)
+
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, recurrings, http.StatusOK)
+	return
+}
+
+func (s *Server) CreateRecurringTransaction(w http.ResponseWriter, r *http.Request) {
+	var recurring RecurringTransaction
+	json.NewDecoder(r.Body).Decode(&recurring)
+	recurring.Frequency = strings.ToUpper(recurring.Frequency)
+
+	err := validateRequest(recurring)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	accountID := recurring.Account.ID
+	recurring.Account, err = GetAccount(s.db, currentUser(r).ID, accountID, "")
+	if err == sql.ErrNoRows {
+		respondWithError(w, fmt.Sprintf("account %d not found", accountID), http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = recurring.Create(s.db)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	respondWithJSON(w, recurring, http.StatusCreated)
+	return
+}
+
+func (s *Server) GetRecurringTransaction(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	recurringID, _ := strconv.Atoi(vars["id"])
+	recurring, err := GetRecurringTransaction(s.db, currentUser(r).ID, recurringID)
+
+	if err == sql.ErrNoRows {
+		respondWithError(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, recurring, http.StatusOK)
+	return
+}
+
+func (s *Server) UpdateRecurringTransaction(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	recurringID, _ := strconv.Atoi(vars["id"])
+	recurring, err := GetRecurringTransaction(s.db, currentUser(r).ID, recurringID)
+
+	if err == sql.ErrNoRows {
+		respondWithError(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	account := recurring.Account
+	json.NewDecoder(r.Body).Decode(&recurring)
+	recurring.ID = recurringID
+	recurring.Frequency = strings.ToUpper(recurring.Frequency)
+	// the account can't be changed, create another recurring transaction instead
+	recurring.Account = account
+
+	err = validateRequest(recurring)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = recurring.Update(s.db)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	respondWithJSON(w, recurring, http.StatusOK)
+	return
+}
+
+func (s *Server) DeleteRecurringTransaction(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	recurringID, _ := strconv.Atoi(vars["id"])
+	recurring, err := GetRecurringTransaction(s.db, currentUser(r).ID, recurringID)
+
+	if err == sql.ErrNoRows {
+		respondWithError(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = recurring.Delete(s.db)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, nil, http.StatusNoContent)
+	return
+}
+
+// PreviewRecurringTransaction lists the next '?limit=' occurrences from '?from=', today by default
+func (s *Server) PreviewRecurringTransaction(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	recurringID, _ := strconv.Atoi(vars["id"])
+	query := r.URL.Query()
+
+	from := time.Now()
+	if value := query.Get("from"); value != "" {
+		var err error
+		from, err = time.Parse(dateLayout, value)
+		if err != nil {
+			respondWithError(w, fmt.Sprintf("parameter 'from' must be like %s", dateLayout), http.StatusBadRequest)
+			return
+		}
+	}
+
+	limit := defaultPreviewLimit
+	if value := query.Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPreviewLimit {
+			respondWithError(w, fmt.Sprintf("parameter 'limit' must be between 1 and %d", maxPreviewLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	recurring, err := GetRecurringTransaction(s.db, currentUser(r).ID, recurringID)
+
+	if err == sql.ErrNoRows {
+		respondWithError(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	occurrences, err := recurring.Preview(s.db, from, limit)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, occurrences, http.StatusOK)
+	return
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/jonatasbaldin/fin/test"
+)
+
+func TestRecurringTransactionOccurrences(t *testing.T) {
+	from := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2019, 12, 31, 0, 0, 0, 0, time.UTC)
+
+	recurring := RecurringTransaction{Frequency: "MONTHLY", Interval: 1, StartDate: "2019-01-31", Count: 3}
+	dates, err := recurring.Occurrences(from, to)
+	assert.Nil(t, err)
+	assert.Equal(t, formatDates(dates), []string{"2019-01-31", "2019-02-28", "2019-03-31"})
+
+	recurring = RecurringTransaction{Frequency: "WEEKLY", Interval: 2, StartDate: "2019-01-07", EndDate: "2019-02-10"}
+	dates, err = recurring.Occurrences(from, to)
+	assert.Nil(t, err)
+	assert.Equal(t, formatDates(dates), []string{"2019-01-07", "2019-01-21", "2019-02-04"})
+
+	recurring = RecurringTransaction{Frequency: "DAILY", Interval: 1, StartDate: "2018-12-30"}
+	dates, err = recurring.Occurrences(from, time.Date(2019, 1, 2, 0, 0, 0, 0, time.UTC))
+	assert.Nil(t, err)
+	assert.Equal(t, formatDates(dates), []string{"2019-01-01", "2019-01-02"})
+
+	recurring = RecurringTransaction{Frequency: "YEARLY", Interval: 1, StartDate: "2016-02-29"}
+	dates, err = recurring.Occurrences(from, to)
+	assert.Nil(t, err)
+	assert.Equal(t, formatDates(dates), []string{"2019-02-28"})
+}
+
+func formatDates(dates []time.Time) []string {
+	formatted := []string{}
+	for _, date := range dates {
+		formatted = append(formatted, date.Format(dateLayout))
+	}
+
+	return formatted
+}
+
+func TestCreateRecurringTransaction(t *testing.T) {
+	ClearDB(s.db)
+
+	currency := Currency{
+		Name: "USD",
+	}
+	currency.Create(s.db)
+	account := Account{
+		UserID:         testUser.ID,
+		Currency:       currency,
+		Name:           "My Wallet",
+		InitialBalance: Decimal("100.00"),
+	}
+	account.Create(s.db)
+	category := Category{
+		UserID: testUser.ID,
+		Name:   "Rent",
+	}
+	category.Create(s.db)
+
+	body := []byte(fmt.Sprintf(
+		`{"account": {"id": %d}, "description": "Rent", "value": 500, "type": "EXPENSE", "categories": [{"id": %d}], "frequency": "monthly", "start_date": "2019-01-05", "count": 12}`,
+		account.ID,
+		category.ID,
+	))
+	response := Request(s.router, "POST", "/recurring-transactions", bytes.NewBuffer(body))
+	assert.Equal(t, http.StatusCreated, response.Code)
+
+	var recurring RecurringTransaction
+	json.Unmarshal(response.Body.Bytes(), &recurring)
+
+	assert.Equal(t, recurring.Frequency, "MONTHLY")
+	assert.Equal(t, recurring.Interval, 1)
+	assert.Equal(t, recurring.Categories[0].Name, "Rent")
+
+	response = Request(s.router, "GET", fmt.Sprintf("/recurring-transactions/%d/preview?from=2019-11-01&limit=5", recurring.ID), nil)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	var occurrences []RecurringOccurrence
+	json.Unmarshal(response.Body.Bytes(), &occurrences)
+
+	// the 12th and last occurrence is in December
+	assert.Equal(t, len(occurrences), 2)
+	assert.Equal(t, occurrences[0].Date, "2019-11-05")
+	assert.Equal(t, occurrences[1].Date, "2019-12-05")
+	assert.False(t, occurrences[0].Materialized)
+}
+
+func TestUpdateRecurringTransactionIgnoresBodyID(t *testing.T) {
+	ClearDB(s.db)
+	s.db.Exec("DELETE FROM users WHERE id <> $1", testUser.ID)
+
+	other := User{Email: "other@fin.com", Password: "other-password"}
+	other.Create(s.db)
+
+	currency := Currency{
+		Name: "USD",
+	}
+	currency.Create(s.db)
+
+	recurrings := []RecurringTransaction{}
+	for _, userID := range []int{testUser.ID, other.ID} {
+		account := Account{
+			UserID:         userID,
+			Currency:       currency,
+			Name:           "My Wallet",
+			InitialBalance: Decimal("100.00"),
+		}
+		account.Create(s.db)
+		category := Category{
+			UserID: userID,
+			Name:   "Rent",
+		}
+		category.Create(s.db)
+		recurring := RecurringTransaction{
+			Account:     account,
+			Description: "Rent",
+			Value:       Decimal("500.00"),
+			Type:        "EXPENSE",
+			Categories:  []Category{category},
+			Frequency:   "MONTHLY",
+			Interval:    1,
+			StartDate:   "2019-01-05",
+		}
+		recurring.Create(s.db)
+		recurrings = append(recurrings, recurring)
+	}
+	mine, theirs := recurrings[0], recurrings[1]
+
+	body := []byte(fmt.Sprintf(`{"id": %d, "description": "Edited"}`, theirs.ID))
+	response := Request(s.router, "PATCH", fmt.Sprintf("/recurring-transactions/%d", mine.ID), bytes.NewBuffer(body))
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	saved, _ := GetRecurringTransaction(s.db, testUser.ID, mine.ID)
+	assert.Equal(t, saved.Description, "Edited")
+
+	saved, _ = GetRecurringTransaction(s.db, other.ID, theirs.ID)
+	assert.Equal(t, saved.Description, "Rent")
+}
+
+func TestValidateRecurringTransactionFrequency(t *testing.T) {
+	ClearDB(s.db)
+
+	body := []byte(`{"account": {"id": 1}, "description": "Rent", "value": 500, "type": "EXPENSE", "categories": [{"id": 1}], "frequency": "hourly"}`)
+	response := Request(s.router, "POST", "/recurring-transactions", bytes.NewBuffer(body))
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+
+	var err CustomError
+	json.Unmarshal(response.Body.Bytes(), &err)
+
+	assert.Equal(t, err.Error, "field 'frequency' must be 'DAILY', 'WEEKLY', 'MONTHLY' or 'YEARLY'")
+}
+
+func TestMaterializeRecurringTransactions(t *testing.T) {
+	ClearDB(s.db)
+
+	currency := Currency{
+		Name: "USD",
+	}
+	currency.Create(s.db)
+	account := Account{
+		UserID:         testUser.ID,
+		Currency:       currency,
+		Name:           "My Wallet",
+		InitialBalance: Decimal("100.00"),
+	}
+	account.Create(s.db)
+	category := Category{
+		UserID: testUser.ID,
+		Name:   "Salary",
+	}
+	category.Create(s.db)
+	recurring := RecurringTransaction{
+		Account:     account,
+		Description: "Salary",
+		Value:       Decimal("1000.00"),
+		Type:        "INCOME",
+		Categories:  []Category{category},
+		Frequency:   "MONTHLY",
+		Interval:    1,
+		StartDate:   "2019-01-01",
+		EndDate:     "2019-03-31",
+	}
+	recurring.Create(s.db)
+
+	created, err := MaterializeRecurringTransactions(s.db, time.Date(2019, 2, 15, 0, 0, 0, 0, time.UTC))
+	assert.Nil(t, err)
+	assert.Equal(t, created, 2)
+
+	// running again only creates the new occurrences
+	created, err = MaterializeRecurringTransactions(s.db, time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC))
+	assert.Nil(t, err)
+	assert.Equal(t, created, 1)
+
+	transactions, _ := ListTransactions(s.db, account.ID, TransactionFilter{})
+	assert.Equal(t, len(transactions), 3)
+	assert.Equal(t, transactions[0].Date, "2019-01-01")
+	assert.Equal(t, transactions[0].Categories[0].ID, category.ID)
+
+	// a deleted occurrence is not created again
+	transactions[0].Delete(s.db)
+	created, err = MaterializeRecurringTransactions(s.db, time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC))
+	assert.Nil(t, err)
+	assert.Equal(t, created, 0)
+
+	account, _ = GetAccount(s.db, testUser.ID, account.ID, "")
+	assert.Equal(t, account.Balance.String(), "2100")
+}
+
+func TestMaterializeLongRunningRecurringTransaction(t *testing.T) {
+	ClearDB(s.db)
+
+	currency := Currency{
+		Name: "USD",
+	}
+	currency.Create(s.db)
+	account := Account{
+		UserID:         testUser.ID,
+		Currency:       currency,
+		Name:           "My Wallet",
+		InitialBalance: Decimal("100.00"),
+	}
+	account.Create(s.db)
+	category := Category{
+		UserID: testUser.ID,
+		Name:   "Coffee",
+	}
+	category.Create(s.db)
+	recurring := RecurringTransaction{
+		Account:     account,
+		Description: "Coffee",
+		Value:       Decimal("1.00"),
+		Type:        "EXPENSE",
+		Categories:  []Category{category},
+		Frequency:   "DAILY",
+		Interval:    1,
+		StartDate:   "2015-01-01",
+	}
+	recurring.Create(s.db)
+
+	// the first 1000 days were already materialized
+	s.db.Exec(
+		`INSERT INTO recurring_transactions_occurrences(recurring_transaction_id, date)
+		SELECT $1, generate_series('2015-01-01'::date, '2015-01-01'::date + 999, '1 day')`,
+		recurring.ID,
+	)
+
+	start, _ := time.Parse(dateLayout, "2015-01-01")
+	created, err := MaterializeRecurringTransactions(s.db, start.AddDate(0, 0, 1002))
+	assert.Nil(t, err)
+	assert.Equal(t, created, 3)
+
+	transactions, _ := ListTransactions(s.db, account.ID, TransactionFilter{})
+	assert.Equal(t, len(transactions), 3)
+	assert.Equal(t, transactions[0].Date, start.AddDate(0, 0, 1000).Format(dateLayout))
+}
+
+func TestMaterializeRecurringTransactionEarlierStartDate(t *testing.T) {
+	ClearDB(s.db)
+
+	currency := Currency{
+		Name: "USD",
+	}
+	currency.Create(s.db)
+	account := Account{
+		UserID:         testUser.ID,
+		Currency:       currency,
+		Name:           "My Wallet",
+		InitialBalance: Decimal("100.00"),
+	}
+	account.Create(s.db)
+	category := Category{
+		UserID: testUser.ID,
+		Name:   "Gym",
+	}
+	category.Create(s.db)
+	recurring := RecurringTransaction{
+		Account:     account,
+		Description: "Gym",
+		Value:       Decimal("30.00"),
+		Type:        "EXPENSE",
+		Categories:  []Category{category},
+		Frequency:   "MONTHLY",
+		Interval:    1,
+		StartDate:   "2019-03-01",
+	}
+	recurring.Create(s.db)
+
+	until, _ := time.Parse(dateLayout, "2019-04-15")
+	created, err := MaterializeRecurringTransactions(s.db, until)
+	assert.Nil(t, err)
+	assert.Equal(t, created, 2)
+
+	// the dates before the last one recorded are created after moving the start_date back
+	body := []byte(`{"start_date": "2019-01-01"}`)
+	response := Request(s.router, "PATCH", fmt.Sprintf("/recurring-transactions/%d", recurring.ID), bytes.NewBuffer(body))
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	created, err = MaterializeRecurringTransactions(s.db, until)
+	assert.Nil(t, err)
+	assert.Equal(t, created, 2)
+
+	transactions, _ := ListTransactions(s.db, account.ID, TransactionFilter{})
+	assert.Equal(t, len(transactions), 4)
+}
@@ -0,0 +1,661 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/shopspring/decimal"
+)
+
+// maxReportPeriods limits how many intervals a report can have, like about 3 years of days
+const maxReportPeriods = 1000
+
+// ReportFilter selects what goes in a report, without AccountIDs every account of the User is used
+type ReportFilter struct {
+	UserID     int
+	AccountIDs []int
+	From       time.Time
+	To         time.Time
+	Interval   string
+	RateName   string
+	Historical bool
+}
+
+// reportFilterError is an error caused by the filter, not by the database
+type reportFilterError string
+
+func (err reportFilterError) Error() string {
+	return string(err)
+}
+
+// reportIntervals are the intervals a report can be grouped by
+var reportIntervals = map[string]bool{
+	"day":   true,
+	"week":  true,
+	"month": true,
+	"year":  true,
+}
+
+// reportPeriod returns the first and last days of the interval containing date, weeks start on Monday
+func reportPeriod(interval string, date time.Time) (start time.Time, end time.Time) {
+	switch interval {
+	case "day":
+		start = time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+		return start, start
+	case "week":
+		return budgetPeriod("WEEKLY", date)
+	case "year":
+		return budgetPeriod("YEARLY", date)
+	}
+
+	return budgetPeriod("MONTHLY", date)
+}
+
+// addIntervals moves the start of a period n intervals, n can be negative
+func addIntervals(interval string, start time.Time, n int) time.Time {
+	switch interval {
+	case "day":
+		return start.AddDate(0, 0, n)
+	case "week":
+		return start.AddDate(0, 0, 7*n)
+	case "year":
+		return start.AddDate(n, 0, 0)
+	}
+
+	return start.AddDate(0, n, 0)
+}
+
+// reportAccount is what reports need of an Account
+type reportAccount struct {
+	ID             int
+	Name           string
+	CurrencyName   string
+	InitialBalance decimal.Decimal
+}
+
+// prepare fills the defaults of the filter and checks the accounts belong to the User,
+// without a rate all the accounts must have the same currency, which is used
+func (filter *ReportFilter) prepare(db *sql.DB) (accounts []reportAccount, err error) {
+	if filter.Interval == "" {
+		filter.Interval = "month"
+	}
+
+	if !reportIntervals[filter.Interval] {
+		return nil, reportFilterError("parameter 'interval' must be 'day', 'week', 'month' or 'year'")
+	}
+
+	if filter.To.IsZero() {
+		filter.To = time.Now()
+	}
+	filter.To = time.Date(filter.To.Year(), filter.To.Month(), filter.To.Day(), 0, 0, 0, 0, time.UTC)
+
+	// by default, the last 12 intervals
+	if filter.From.IsZero() {
+		start, _ := reportPeriod(filter.Interval, filter.To)
+		filter.From = addIntervals(filter.Interval, start, -11)
+	}
+
+	if filter.From.After(filter.To) {
+		return nil, reportFilterError("parameter 'from' must be before 'to'")
+	}
+
+	rows, err := db.Query(
+		`SELECT id, name, currency_name, initial_balance
+		FROM accounts
+		WHERE user_id = $1 AND (cardinality($2::int[]) = 0 OR id = ANY($2))
+		ORDER BY id`,
+		filter.UserID,
+		pq.Array(filter.AccountIDs),
+	)
+
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	found := map[int]bool{}
+	currencies := map[string]bool{}
+
+	for rows.Next() {
+		var account reportAccount
+		errScan := rows.Scan(&account.ID, &account.Name, &account.CurrencyName, &account.InitialBalance)
+		if errScan != nil {
+			return nil, errScan
+		}
+
+		found[account.ID] = true
+		currencies[account.CurrencyName] = true
+		accounts = append(accounts, account)
+	}
+
+	for _, accountID := range filter.AccountIDs {
+		if !found[accountID] {
+			return nil, reportFilterError(fmt.Sprintf("account %d not found", accountID))
+		}
+	}
+
+	if filter.RateName == "" {
+		if len(currencies) > 1 {
+			return nil, reportFilterError("parameter 'rate' is required for accounts in different currencies")
+		}
+
+		for name := range currencies {
+			filter.RateName = name
+		}
+	}
+
+	return accounts, nil
+}
+
+// reportAccountIDs returns the ids of the accounts
+func reportAccountIDs(accounts []reportAccount) []int {
+	ids := []int{}
+	for _, account := range accounts {
+		ids = append(ids, account.ID)
+	}
+
+	return ids
+}
+
+// reportConverter converts values with the latest Rate, like Account.getBalance,
+// or, when historical, with the Rate effective at their dates
+type reportConverter struct {
+	db         *sql.DB
+	rateName   string
+	historical bool
+	latest     map[string]decimal.Decimal
+	atDate     *rateConverter
+}
+
+func newReportConverter(db *sql.DB, rateName string, historical bool) *reportConverter {
+	return &reportConverter{
+		db:         db,
+		rateName:   rateName,
+		historical: historical,
+		latest:     map[string]decimal.Decimal{},
+		atDate:     newRateConverter(db, rateName),
+	}
+}
+
+// convert returns value, in currencyName, converted to the report currency, without rounding
+func (converter *reportConverter) convert(value decimal.Decimal, currencyName string, date string) (decimal.Decimal, error) {
+	if currencyName == converter.rateName {
+		return value, nil
+	}
+
+	if converter.historical {
+		return converter.atDate.convert(value, currencyName, date)
+	}
+
+	if _, ok := converter.latest[currencyName]; !ok {
+		currency, err := GetCurrency(converter.db, currencyName)
+		if err != nil {
+			return value, err
+		}
+
+		rate, err := currency.GetRate(converter.db, converter.rateName)
+		if err != nil {
+			return value, err
+		}
+		if rate.Name == "" {
+			return value, reportFilterError(fmt.Sprintf("rate '%s' of currency '%s' not found", converter.rateName, currencyName))
+		}
+
+		converter.latest[currencyName] = rate.Value
+	}
+
+	return value.Mul(converter.latest[currencyName]), nil
+}
+
+// CashflowPeriod is the income and expense of a period, in the report currency
+type CashflowPeriod struct {
+	Start   string          `json:"start"`
+	End     string          `json:"end"`
+	Income  decimal.Decimal `json:"income"`
+	Expense decimal.Decimal `json:"expense"`
+	Net     decimal.Decimal `json:"net"`
+}
+
+type CashflowReport struct {
+	From       string           `json:"from"`
+	To         string           `json:"to"`
+	Interval   string           `json:"interval"`
+	Rate       string           `json:"rate"`
+	Historical bool             `json:"historical"`
+	Income     decimal.Decimal  `json:"income"`
+	Expense    decimal.Decimal  `json:"expense"`
+	Net        decimal.Decimal  `json:"net"`
+	Periods    []CashflowPeriod `json:"periods"`
+}
+
+// GetCashflowReport sums the income and expense of each period between From and To.
+// Transfers between the selected accounts are left out, transfers from or to other accounts count as income or expense.
+func GetCashflowReport(db *sql.DB, filter ReportFilter) (report CashflowReport, err error) {
+	accounts, err := filter.prepare(db)
+	if err != nil {
+		return
+	}
+
+	report.Interval = filter.Interval
+	report.Rate = filter.RateName
+	report.Historical = filter.Historical
+
+	type periodTotals struct {
+		income  decimal.Decimal
+		expense decimal.Decimal
+	}
+
+	totals := map[string]*periodTotals{}
+	starts := []time.Time{}
+
+	firstStart, _ := reportPeriod(filter.Interval, filter.From)
+	for start := firstStart; !start.After(filter.To); start = addIntervals(filter.Interval, start, 1) {
+		if len(starts) >= maxReportPeriods {
+			return report, reportFilterError(fmt.Sprintf("report must have at most %d intervals", maxReportPeriods))
+		}
+
+		starts = append(starts, start)
+		totals[start.Format(dateLayout)] = &periodTotals{}
+	}
+
+	accountIDs := pq.Array(reportAccountIDs(accounts))
+
+	rows, err := db.Query(
+		`SELECT a.currency_name, `+transactionKindSQL+` AS kind, to_char(t.date, 'YYYY-MM-DD'), SUM(t.value)
+		FROM transactions t
+		INNER JOIN accounts a ON (t.account_id = a.id)
+		LEFT JOIN transfers tr ON (t.transfer_id = tr.id)
+		WHERE a.id = ANY($1) AND t.date >= $2 AND t.date <= $3
+		AND NOT (tr.id IS NOT NULL AND tr.from_account_id = ANY($1) AND tr.to_account_id = ANY($1))
+		GROUP BY a.currency_name, kind, t.date`,
+		accountIDs,
+		filter.From.Format(dateLayout),
+		filter.To.Format(dateLayout),
+	)
+
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	converter := newReportConverter(db, filter.RateName, filter.Historical)
+
+	for rows.Next() {
+		var currencyName, kind, date string
+		var total decimal.Decimal
+
+		err = rows.Scan(&currencyName, &kind, &date, &total)
+		if err != nil {
+			return
+		}
+
+		converted, errConvert := converter.convert(total, currencyName, date)
+		if errConvert != nil {
+			return report, errConvert
+		}
+
+		day, _ := time.Parse(dateLayout, date)
+		start, _ := reportPeriod(filter.Interval, day)
+		period := totals[start.Format(dateLayout)]
+
+		switch kind {
+		case "INCOME", "TRANSFER_IN":
+			period.income = period.income.Add(converted)
+		case "EXPENSE", "TRANSFER_OUT":
+			period.expense = period.expense.Add(converted)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	income := decimal.New(0, 0)
+	expense := decimal.New(0, 0)
+	report.Periods = []CashflowPeriod{}
+
+	for _, start := range starts {
+		_, end := reportPeriod(filter.Interval, start)
+		period := totals[start.Format(dateLayout)]
+
+		income = income.Add(period.income)
+		expense = expense.Add(period.expense)
+
+		report.Periods = append(report.Periods, CashflowPeriod{
+			Start:   start.Format(dateLayout),
+			End:     end.Format(dateLayout),
+			Income:  roundMoney(period.income),
+			Expense: roundMoney(period.expense),
+			Net:     roundMoney(period.income.Sub(period.expense)),
+		})
+	}
+
+	report.From = filter.From.Format(dateLayout)
+	report.To = filter.To.Format(dateLayout)
+	report.Income = roundMoney(income)
+	report.Expense = roundMoney(expense)
+	report.Net = roundMoney(income.Sub(expense))
+
+	return
+}
+
+// categorySplits are how a transaction with many categories is counted:
+// amount counts the amount of each category, even divides its value between them,
+// full counts the whole value in each one and primary only in its first category, the one with the lowest id
+var categorySplits = map[string]bool{
+	"amount":  true,
+	"even":    true,
+	"full":    true,
+	"primary": true,
+}
+
+// CategoryTotal is how much went to a Category, in the report currency,
+// Total includes its children and OwnTotal only the transactions of the Category itself
+type CategoryTotal struct {
+	Category     Category        `json:"category"`
+	Total        decimal.Decimal `json:"total"`
+	OwnTotal     decimal.Decimal `json:"own_total"`
+	Percentage   decimal.Decimal `json:"percentage"`
+	Transactions int             `json:"transactions"`
+}
+
+type CategoryReport struct {
+	From       string          `json:"from"`
+	To         string          `json:"to"`
+	Type       string          `json:"type"`
+	Split      string          `json:"split"`
+	Rate       string          `json:"rate"`
+	Historical bool            `json:"historical"`
+	Total      decimal.Decimal `json:"total"`
+	Categories []CategoryTotal `json:"categories"`
+}
+
+// GetCategoryReport sums the INCOME or EXPENSE transactions between From and To by Category,
+// see categorySplits for transactions with many categories. Totals of parents include their children.
+// Percentages are of the total of the transactions, so they add up to more than 100 with parents and children.
+func GetCategoryReport(db *sql.DB, filter ReportFilter, transactionType string, split string) (report CategoryReport, err error) {
+	if transactionType == "" {
+		transactionType = "EXPENSE"
+	}
+
+	if transactionType != "INCOME" && transactionType != "EXPENSE" {
+		return report, reportFilterError("parameter 'type' must be 'INCOME' or 'EXPENSE'")
+	}
+
+	if split == "" {
+		split = "amount"
+	}
+
+	if !categorySplits[split] {
+		return report, reportFilterError("parameter 'split' must be 'amount', 'even', 'full' or 'primary'")
+	}
+
+	accounts, err := filter.prepare(db)
+	if err != nil {
+		return
+	}
+
+	report.From = filter.From.Format(dateLayout)
+	report.To = filter.To.Format(dateLayout)
+	report.Type = transactionType
+	report.Split = split
+	report.Rate = filter.RateName
+	report.Historical = filter.Historical
+
+	categories, err := ListCategories(db, filter.UserID)
+	if err != nil {
+		return
+	}
+
+	rows, err := db.Query(
+		`SELECT a.currency_name, to_char(t.date, 'YYYY-MM-DD'), t.value,
+		array_agg(tc.category_id ORDER BY tc.category_id), array_agg(tc.amount ORDER BY tc.category_id)
+		FROM transactions t
+		INNER JOIN accounts a ON (t.account_id = a.id)
+		INNER JOIN transactions_categories tc ON (tc.transaction_id = t.id)
+		WHERE a.id = ANY($1) AND t.type = $2 AND t.date >= $3 AND t.date <= $4
+		GROUP BY t.id, a.currency_name`,
+		pq.Array(reportAccountIDs(accounts)),
+		transactionType,
+		report.From,
+		report.To,
+	)
+
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	converter := newReportConverter(db, filter.RateName, filter.Historical)
+	ancestors := categoryAncestors(categories)
+	total := decimal.New(0, 0)
+	totals := map[int]decimal.Decimal{}
+	ownTotals := map[int]decimal.Decimal{}
+	counts := map[int]int{}
+
+	for rows.Next() {
+		var currencyName, date string
+		var value decimal.Decimal
+		var categoryIDs pq.Int64Array
+		var amounts []decimal.Decimal
+
+		err = rows.Scan(&currencyName, &date, &value, &categoryIDs, pq.Array(&amounts))
+		if err != nil {
+			return
+		}
+
+		converted, errConvert := converter.convert(value, currencyName, date)
+		if errConvert != nil {
+			return report, errConvert
+		}
+
+		total = total.Add(converted)
+
+		// rolls up into the parents, a transaction in a parent and in its child only counts once in the parent
+		if split == "primary" {
+			categoryIDs = categoryIDs[:1]
+		}
+
+		rolledUp := map[int]decimal.Decimal{}
+		for index, categoryID := range categoryIDs {
+			var share decimal.Decimal
+			switch split {
+			case "even":
+				share = converted.Div(decimal.New(int64(len(categoryIDs)), 0))
+			case "full", "primary":
+				share = converted
+			default:
+				share, errConvert = converter.convert(amounts[index], currencyName, date)
+				if errConvert != nil {
+					return report, errConvert
+				}
+			}
+
+			ownTotals[int(categoryID)] = ownTotals[int(categoryID)].Add(share)
+
+			for _, ancestorID := range ancestors[int(categoryID)] {
+				rolledUp[ancestorID] = rolledUp[ancestorID].Add(share)
+			}
+		}
+
+		for categoryID, value := range rolledUp {
+			totals[categoryID] = totals[categoryID].Add(value)
+			counts[categoryID]++
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	report.Total = roundMoney(total)
+	report.Categories = []CategoryTotal{}
+
+	for _, category := range categories {
+		if counts[category.ID] == 0 {
+			continue
+		}
+
+		categoryTotal := CategoryTotal{
+			Category:     category,
+			Total:        roundMoney(totals[category.ID]),
+			OwnTotal:     roundMoney(ownTotals[category.ID]),
+			Percentage:   decimal.New(0, 0),
+			Transactions: counts[category.ID],
+		}
+
+		if !total.IsZero() {
+			categoryTotal.Percentage = totals[category.ID].Mul(decimal.New(100, 0)).Div(total).Round(2)
+		}
+
+		report.Categories = append(report.Categories, categoryTotal)
+	}
+
+	// the biggest first
+	sort.SliceStable(report.Categories, func(i, j int) bool {
+		return report.Categories[i].Total.GreaterThan(report.Categories[j].Total)
+	})
+
+	return
+}
+
+// NetWorthAccount is the balance of an Account at a point, in its currency and in the report currency
+type NetWorthAccount struct {
+	ID        int             `json:"id"`
+	Name      string          `json:"name"`
+	Currency  string          `json:"currency"`
+	Balance   decimal.Decimal `json:"balance"`
+	Converted decimal.Decimal `json:"converted"`
+}
+
+// NetWorthPoint is the sum of the balances at the end of a period, or at To for the last one
+type NetWorthPoint struct {
+	Date     string            `json:"date"`
+	NetWorth decimal.Decimal   `json:"net_worth"`
+	Accounts []NetWorthAccount `json:"accounts"`
+}
+
+type NetWorthReport struct {
+	From       string          `json:"from"`
+	To         string          `json:"to"`
+	Interval   string          `json:"interval"`
+	Rate       string          `json:"rate"`
+	Historical bool            `json:"historical"`
+	Points     []NetWorthPoint `json:"points"`
+}
+
+// GetNetWorthReport rebuilds the balance of each account, from its initial balance and the transactions
+// up to the end of each period, like Account.getBalance. When historical, balances are converted
+// with the Rate effective at each point, otherwise with the latest one.
+func GetNetWorthReport(db *sql.DB, filter ReportFilter) (report NetWorthReport, err error) {
+	accounts, err := filter.prepare(db)
+	if err != nil {
+		return
+	}
+
+	report.From = filter.From.Format(dateLayout)
+	report.To = filter.To.Format(dateLayout)
+	report.Interval = filter.Interval
+	report.Rate = filter.RateName
+	report.Historical = filter.Historical
+
+	points := []time.Time{}
+
+	firstStart, _ := reportPeriod(filter.Interval, filter.From)
+	for start := firstStart; !start.After(filter.To); start = addIntervals(filter.Interval, start, 1) {
+		if len(points) >= maxReportPeriods {
+			return report, reportFilterError(fmt.Sprintf("report must have at most %d intervals", maxReportPeriods))
+		}
+
+		_, end := reportPeriod(filter.Interval, start)
+		if end.After(filter.To) {
+			end = filter.To
+		}
+
+		points = append(points, end)
+	}
+
+	type dailyChange struct {
+		accountID int
+		date      string
+		change    decimal.Decimal
+	}
+
+	rows, err := db.Query(
+		`SELECT t.account_id, to_char(t.date, 'YYYY-MM-DD'),
+		SUM(CASE WHEN `+transactionKindSQL+` IN ('INCOME', 'TRANSFER_IN') THEN t.value ELSE -t.value END)
+		FROM transactions t
+		LEFT JOIN transfers tr ON (t.transfer_id = tr.id)
+		WHERE t.account_id = ANY($1) AND t.date <= $2
+		GROUP BY t.account_id, t.date
+		ORDER BY t.date`,
+		pq.Array(reportAccountIDs(accounts)),
+		report.To,
+	)
+
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	changes := []dailyChange{}
+
+	for rows.Next() {
+		var daily dailyChange
+		err = rows.Scan(&daily.accountID, &daily.date, &daily.change)
+		if err != nil {
+			return
+		}
+
+		changes = append(changes, daily)
+	}
+
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	balances := map[int]decimal.Decimal{}
+	for _, account := range accounts {
+		balances[account.ID] = account.InitialBalance
+	}
+
+	converter := newReportConverter(db, filter.RateName, filter.Historical)
+	report.Points = []NetWorthPoint{}
+	next := 0
+
+	for _, point := range points {
+		date := point.Format(dateLayout)
+
+		// dates sort as strings
+		for ; next < len(changes) && changes[next].date <= date; next++ {
+			balances[changes[next].accountID] = balances[changes[next].accountID].Add(changes[next].change)
+		}
+
+		netWorth := decimal.New(0, 0)
+		netWorthPoint := NetWorthPoint{Date: date, Accounts: []NetWorthAccount{}}
+
+		for _, account := range accounts {
+			converted, errConvert := converter.convert(balances[account.ID], account.CurrencyName, date)
+			if errConvert != nil {
+				return report, errConvert
+			}
+
+			netWorth = netWorth.Add(converted)
+			netWorthPoint.Accounts = append(netWorthPoint.Accounts, NetWorthAccount{
+				ID:        account.ID,
+				Name:      account.Name,
+				Currency:  account.CurrencyName,
+				Balance:   roundMoney(balances[account.ID]),
+				Converted: roundMoney(converted),
+			})
+		}
+
+		netWorthPoint.NetWorth = roundMoney(netWorth)
+		report.Points = append(report.Points, netWorthPoint)
+	}
+
+	return
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GetCashflowReport returns the income, expense and net of each period,
+// see parseReportFilter for the query string
+func (s *Server) GetCashflowReport(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseReportFilter(r)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := GetCashflowReport(s.db, filter)
+	if err != nil {
+		respondReportError(w, err)
+		return
+	}
+
+	respondWithJSON(w, report, http.StatusOK)
+	return
+}
+
+// GetCategoryReport returns the totals of each category, ?type=INCOME or EXPENSE (default)
+// and ?split=amount (default), even, full or primary for transactions with many categories
+func (s *Server) GetCategoryReport(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseReportFilter(r)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	report, err := GetCategoryReport(s.db, filter, strings.ToUpper(query.Get("type")), strings.ToLower(query.Get("split")))
+	if err != nil {
+		respondReportError(w, err)
+		return
+	}
+
+	respondWithJSON(w, report, http.StatusOK)
+	return
+}
+
+// GetNetWorthReport returns the balances at the end of each period, converted with the
+// rates of those dates unless ?historical=false
+func (s *Server) GetNetWorthReport(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseReportFilter(r)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.URL.Query().Get("historical") == "" {
+		filter.Historical = true
+	}
+
+	report, err := GetNetWorthReport(s.db, filter)
+	if err != nil {
+		respondReportError(w, err)
+		return
+	}
+
+	respondWithJSON(w, report, http.StatusOK)
+	return
+}
+
+// respondReportError answers with 400 for errors caused by the filter
+func respondReportError(w http.ResponseWriter, err error) {
+	if _, ok := err.(reportFilterError); ok {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	respondWithError(w, err.Error(), http.StatusInternalServerError)
+}
+
+// parseReportFilter reads ?from=, ?to=, ?interval=, ?rate=, ?historical= and
+// ?account=1&account=2 or ?account=1,2 from the query string
+func parseReportFilter(r *http.Request) (filter ReportFilter, err error) {
+	query := r.URL.Query()
+	filter.UserID = currentUser(r).ID
+	filter.Interval = strings.ToLower(query.Get("interval"))
+	filter.RateName = strings.ToUpper(query.Get("rate"))
+
+	if from := query.Get("from"); from != "" {
+		filter.From, err = time.Parse(dateLayout, from)
+		if err != nil {
+			return filter, fmt.Errorf("parameter 'from' must be like %s", dateLayout)
+		}
+	}
+
+	if to := query.Get("to"); to != "" {
+		filter.To, err = time.Parse(dateLayout, to)
+		if err != nil {
+			return filter, fmt.Errorf("parameter 'to' must be like %s", dateLayout)
+		}
+	}
+
+	if value := query.Get("historical"); value != "" {
+		filter.Historical, err = strconv.ParseBool(value)
+		if err != nil {
+			return filter, errors.New("parameter 'historical' must be 'true' or 'false'")
+		}
+	}
+
+	for _, param := range query["account"] {
+		for _, value := range strings.Split(param, ",") {
+			accountID, errID := strconv.Atoi(strings.TrimSpace(value))
+			if errID != nil {
+				return filter, errors.New("parameter 'account' must be a list of ids")
+			}
+
+			filter.AccountIDs = append(filter.AccountIDs, accountID)
+		}
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/jonatasbaldin/fin/test"
+)
+
+func createReportAccounts() (Account, Account, Category) {
+	euro := Currency{
+		Name:  "EUR",
+		Rates: []Rate{{Name: "BRL", Symbol: "R$", Value: Decimal("4.00")}},
+	}
+	euro.Create(s.db)
+	brl := Currency{
+		Name:  "BRL",
+		Rates: []Rate{{Name: "EUR", Symbol: "€", Value: Decimal("0.25")}},
+	}
+	brl.Create(s.db)
+
+	bank := Account{
+		UserID:         testUser.ID,
+		Currency:       euro,
+		Name:           "Bank",
+		InitialBalance: Decimal("100.00"),
+	}
+	bank.Create(s.db)
+	carteira := Account{
+		UserID:         testUser.ID,
+		Currency:       brl,
+		Name:           "Carteira",
+		InitialBalance: Decimal("0.00"),
+	}
+	carteira.Create(s.db)
+
+	category := Category{
+		UserID: testUser.ID,
+		Name:   "Food",
+	}
+	category.Create(s.db)
+
+	transactions := []Transaction{
+		{Account: bank, Description: "Salary", Value: Decimal("1000.00"), Type: "INCOME", Date: "2019-01-06", Categories: []Category{category}},
+		{Account: bank, Description: "Coffee", Value: Decimal("3.50"), Type: "EXPENSE", Date: "2019-01-07", Categories: []Category{category}},
+		{Account: carteira, Description: "Feira", Value: Decimal("40.00"), Type: "EXPENSE", Date: "2019-03-02", Categories: []Category{category}},
+	}
+	for _, transaction := range transactions {
+		transaction.Create(s.db)
+	}
+
+	transfer := Transfer{
+		UserID:      testUser.ID,
+		FromAccount: bank,
+		ToAccount:   carteira,
+		Value:       Decimal("10.00"),
+		Date:        "2019-03-01",
+	}
+	transfer.Create(s.db)
+
+	return bank, carteira, category
+}
+
+func TestReportPeriod(t *testing.T) {
+	date := time.Date(2019, 3, 14, 0, 0, 0, 0, time.UTC)
+
+	cases := map[string][2]string{
+		"day":   {"2019-03-14", "2019-03-14"},
+		"week":  {"2019-03-11", "2019-03-17"},
+		"month": {"2019-03-01", "2019-03-31"},
+		"year":  {"2019-01-01", "2019-12-31"},
+	}
+
+	for interval, expected := range cases {
+		start, end := reportPeriod(interval, date)
+		assert.Equal(t, expected[0], start.Format(dateLayout), interval)
+		assert.Equal(t, expected[1], end.Format(dateLayout), interval)
+	}
+
+	start, _ := reportPeriod("month", date)
+	assert.Equal(t, "2018-04-01", addIntervals("month", start, -11).Format(dateLayout))
+}
+
+func TestGetCashflowReport(t *testing.T) {
+	ClearDB(s.db)
+
+	createReportAccounts()
+
+	response := Request(s.router, "GET", "/reports/cashflow?from=2019-01-01&to=2019-03-31&rate=EUR", nil)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	var report CashflowReport
+	json.Unmarshal(response.Body.Bytes(), &report)
+
+	assert.Equal(t, "month", report.Interval)
+	assert.Equal(t, "EUR", report.Rate)
+	assert.Equal(t, 3, len(report.Periods))
+
+	assert.Equal(t, "2019-01-01", report.Periods[0].Start)
+	assert.Equal(t, "2019-01-31", report.Periods[0].End)
+	assert.Equal(t, "1000", report.Periods[0].Income.String())
+	assert.Equal(t, "3.5", report.Periods[0].Expense.String())
+	assert.Equal(t, "996.5", report.Periods[0].Net.String())
+
+	// an empty month is still there
+	assert.Equal(t, "0", report.Periods[1].Income.String())
+
+	// the transfer between the two accounts isn't income nor expense, the BRL expense is converted
+	assert.Equal(t, "0", report.Periods[2].Income.String())
+	assert.Equal(t, "10", report.Periods[2].Expense.String())
+
+	assert.Equal(t, "1000", report.Income.String())
+	assert.Equal(t, "13.5", report.Expense.String())
+	assert.Equal(t, "986.5", report.Net.String())
+}
+
+func TestGetCashflowReportAccounts(t *testing.T) {
+	ClearDB(s.db)
+
+	bank, _, _ := createReportAccounts()
+
+	// without the other account the transfer is an expense, the currency is the account's
+	response := Request(s.router, "GET", fmt.Sprintf("/reports/cashflow?from=2019-03-01&to=2019-03-31&account=%d", bank.ID), nil)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	var report CashflowReport
+	json.Unmarshal(response.Body.Bytes(), &report)
+
+	assert.Equal(t, "EUR", report.Rate)
+	assert.Equal(t, 1, len(report.Periods))
+	assert.Equal(t, "10", report.Periods[0].Expense.String())
+}
+
+func TestGetCashflowReportInvalid(t *testing.T) {
+	ClearDB(s.db)
+
+	createReportAccounts()
+
+	cases := map[string]string{
+		"/reports/cashflow?rate=EUR&interval=hour":                 "parameter 'interval' must be 'day', 'week', 'month' or 'year'",
+		"/reports/cashflow?rate=EUR&from=2019-02-01&to=2019-01-01": "parameter 'from' must be before 'to'",
+		"/reports/cashflow?rate=EUR&from=01/02/2019":               "parameter 'from' must be like 2006-01-02",
+		"/reports/cashflow":                    "parameter 'rate' is required for accounts in different currencies",
+		"/reports/cashflow?rate=EUR&account=0": "account 0 not found",
+		"/reports/cashflow?rate=EUR&from=2000-01-01&to=2019-01-01&interval=day": "report must have at most 1000 intervals",
+	}
+
+	for path, message := range cases {
+		response := Request(s.router, "GET", path, nil)
+		assert.Equal(t, http.StatusBadRequest, response.Code, path)
+
+		var e CustomError
+		json.Unmarshal(response.Body.Bytes(), &e)
+		assert.Equal(t, message, e.Error, path)
+	}
+}
+
+func TestGetCategoryReport(t *testing.T) {
+	ClearDB(s.db)
+
+	bank, _, food := createReportAccounts()
+
+	drinks := Category{
+		UserID: testUser.ID,
+		Name:   "Drinks",
+	}
+	drinks.Create(s.db)
+
+	// without amounts the value is divided evenly
+	transaction := Transaction{Account: bank, Description: "Bar", Value: Decimal("20.00"), Type: "EXPENSE", Date: "2019-01-20", Categories: []Category{food, drinks}}
+	transaction.Create(s.db)
+
+	foodAmount := Decimal("1.50")
+	drinksAmount := Decimal("6.00")
+	food.Amount = &foodAmount
+	drinks.Amount = &drinksAmount
+	transaction = Transaction{Account: bank, Description: "Pub", Value: Decimal("7.50"), Type: "EXPENSE", Date: "2019-01-21", Categories: []Category{food, drinks}}
+	transaction.Create(s.db)
+
+	// the totals of each split, in the order of the report
+	cases := map[string][]struct {
+		id           int
+		total        string
+		transactions int
+	}{
+		"amount":  {{drinks.ID, "16", 2}, {food.ID, "15", 3}},
+		"even":    {{food.ID, "17.25", 3}, {drinks.ID, "13.75", 2}},
+		"full":    {{food.ID, "31", 3}, {drinks.ID, "27.5", 2}},
+		"primary": {{food.ID, "31", 3}},
+	}
+
+	for split, expected := range cases {
+		response := Request(s.router, "GET", "/reports/categories?from=2019-01-01&to=2019-01-31&rate=EUR&split="+split, nil)
+		assert.Equal(t, http.StatusOK, response.Code, split)
+
+		var report CategoryReport
+		json.Unmarshal(response.Body.Bytes(), &report)
+
+		assert.Equal(t, "EXPENSE", report.Type, split)
+		assert.Equal(t, split, report.Split)
+		assert.Equal(t, "31", report.Total.String(), split)
+		assert.Equal(t, len(expected), len(report.Categories), split)
+
+		for index, category := range report.Categories {
+			assert.Equal(t, expected[index].id, category.Category.ID, split)
+			assert.Equal(t, expected[index].total, category.Total.String(), split)
+			assert.Equal(t, expected[index].transactions, category.Transactions, split)
+		}
+	}
+}
+
+func TestGetCategoryReportPercentage(t *testing.T) {
+	ClearDB(s.db)
+
+	createReportAccounts()
+
+	// the BRL expense is converted, the transfer has no category
+	response := Request(s.router, "GET", "/reports/categories?from=2019-01-01&to=2019-03-31&rate=EUR", nil)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	var report CategoryReport
+	json.Unmarshal(response.Body.Bytes(), &report)
+
+	assert.Equal(t, "amount", report.Split)
+	assert.Equal(t, "13.5", report.Total.String())
+	assert.Equal(t, 1, len(report.Categories))
+	assert.Equal(t, "100", report.Categories[0].Percentage.String())
+
+	queries := map[string]string{
+		"type=transfer": "parameter 'type' must be 'INCOME' or 'EXPENSE'",
+		"split=half":    "parameter 'split' must be 'amount', 'even', 'full' or 'primary'",
+	}
+
+	for query, message := range queries {
+		response = Request(s.router, "GET", "/reports/categories?rate=EUR&"+query, nil)
+		assert.Equal(t, http.StatusBadRequest, response.Code, query)
+
+		var e CustomError
+		json.Unmarshal(response.Body.Bytes(), &e)
+		assert.Equal(t, message, e.Error, query)
+	}
+}
+
+func TestGetNetWorthReport(t *testing.T) {
+	ClearDB(s.db)
+
+	bank, carteira, _ := createReportAccounts()
+	s.db.Exec(
+		`INSERT INTO rates(currency_name, name, symbol, value, created_at, updated_at)
+		VALUES ('BRL', 'EUR', '€', 0.20, '2019-01-01', '2019-01-01')`,
+	)
+
+	response := Request(s.router, "GET", "/reports/net-worth?from=2019-01-01&to=2019-03-01&rate=EUR", nil)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	var report NetWorthReport
+	json.Unmarshal(response.Body.Bytes(), &report)
+
+	assert.True(t, report.Historical)
+	assert.Equal(t, 3, len(report.Points))
+
+	assert.Equal(t, "2019-01-31", report.Points[0].Date)
+	assert.Equal(t, "1096.5", report.Points[0].NetWorth.String())
+	assert.Equal(t, "1096.5", report.Points[1].NetWorth.String())
+
+	// the last point is at to, after the transfer, the BRL balance with the rate of that date
+	last := report.Points[2]
+	assert.Equal(t, "2019-03-01", last.Date)
+	assert.Equal(t, bank.ID, last.Accounts[0].ID)
+	assert.Equal(t, "1086.5", last.Accounts[0].Balance.String())
+	assert.Equal(t, carteira.ID, last.Accounts[1].ID)
+	assert.Equal(t, "40", last.Accounts[1].Balance.String())
+	assert.Equal(t, "8", last.Accounts[1].Converted.String())
+	assert.Equal(t, "1094.5", last.NetWorth.String())
+
+	// with the latest rates
+	response = Request(s.router, "GET", "/reports/net-worth?from=2019-03-01&to=2019-03-01&rate=EUR&historical=false", nil)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	json.Unmarshal(response.Body.Bytes(), &report)
+	assert.Equal(t, 1, len(report.Points))
+	assert.Equal(t, "1096.5", report.Points[0].NetWorth.String())
+}
+
+func TestGetCategoryReportRollup(t *testing.T) {
+	ClearDB(s.db)
+
+	bank, _, food := createReportAccounts()
+
+	restaurants := Category{
+		UserID:   testUser.ID,
+		ParentID: &food.ID,
+		Name:     "Restaurants",
+	}
+	restaurants.Create(s.db)
+
+	for _, categories := range [][]Category{{restaurants}, {food, restaurants}} {
+		transaction := Transaction{Account: bank, Description: "Dinner", Value: Decimal("20.00"), Type: "EXPENSE", Date: "2019-01-20", Categories: categories}
+		transaction.Create(s.db)
+	}
+
+	response := Request(s.router, "GET", "/reports/categories?from=2019-01-01&to=2019-01-31&rate=EUR", nil)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	var report CategoryReport
+	json.Unmarshal(response.Body.Bytes(), &report)
+
+	assert.Equal(t, "43.5", report.Total.String())
+	assert.Equal(t, 2, len(report.Categories))
+
+	// the transaction in both only counts once in the parent
+	assert.Equal(t, food.ID, report.Categories[0].Category.ID)
+	assert.Equal(t, "43.5", report.Categories[0].Total.String())
+	assert.Equal(t, "13.5", report.Categories[0].OwnTotal.String())
+	assert.Equal(t, 3, report.Categories[0].Transactions)
+	assert.Equal(t, "100", report.Categories[0].Percentage.String())
+
+	assert.Equal(t, restaurants.ID, report.Categories[1].Category.ID)
+	assert.Equal(t, "30", report.Categories[1].Total.String())
+	assert.Equal(t, "30", report.Categories[1].OwnTotal.String())
+}
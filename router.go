@@ -4,6 +4,14 @@ import "github.com/gorilla/mux"
 
 func (s *Server) initializeRoutes() {
 	s.router = mux.NewRouter()
+	s.router.Use(s.authenticate)
+
+	s.router.HandleFunc("/users", s.RegisterUser).Methods("POST").Name("register")
+	s.router.HandleFunc("/login", s.Login).Methods("POST").Name("login")
+	s.router.HandleFunc("/users/me", s.GetCurrentUser).Methods("GET")
+	s.router.HandleFunc("/api-keys", s.ListAPIKeys).Methods("GET")
+	s.router.HandleFunc("/api-keys", s.CreateAPIKey).Methods("POST")
+	s.router.HandleFunc("/api-keys/{id:[0-9]+}", s.RevokeAPIKey).Methods("DELETE")
 
 	s.router.HandleFunc("/accounts", s.ListAccounts).Methods("GET")
 	s.router.HandleFunc("/accounts", s.CreateAccount).Methods("POST")
@@ -15,11 +23,45 @@ func (s *Server) initializeRoutes() {
 	s.router.HandleFunc("/accounts/{account_id:[0-9]+}/transactions/{id:[0-9]+}", s.GetTransaction).Methods("GET")
 	s.router.HandleFunc("/accounts/{account_id:[0-9]+}/transactions/{id:[0-9]+}", s.UpdateTransaction).Methods("PATCH")
 	s.router.HandleFunc("/accounts/{account_id:[0-9]+}/transactions/{id:[0-9]+}", s.DeleteTransaction).Methods("DELETE")
+	s.router.HandleFunc("/accounts/{account_id:[0-9]+}/imports", s.ImportTransactions).Methods("POST")
+	s.router.HandleFunc("/transfers", s.ListTransfers).Methods("GET")
+	s.router.HandleFunc("/transfers", s.CreateTransfer).Methods("POST")
+	s.router.HandleFunc("/transfers/{id:[0-9]+}", s.GetTransfer).Methods("GET")
+	s.router.HandleFunc("/transfers/{id:[0-9]+}", s.UpdateTransfer).Methods("PATCH")
+	s.router.HandleFunc("/transfers/{id:[0-9]+}", s.DeleteTransfer).Methods("DELETE")
 	s.router.HandleFunc("/categories", s.ListCategories).Methods("GET")
 	s.router.HandleFunc("/categories", s.CreateCategory).Methods("POST")
 	s.router.HandleFunc("/categories/{id:[0-9]+}", s.GetCategory).Methods("GET")
 	s.router.HandleFunc("/categories/{id:[0-9]+}", s.UpdateCategory).Methods("PATCH")
 	s.router.HandleFunc("/categories/{id:[0-9]+}", s.DeleteCategory).Methods("DELETE")
+	s.router.HandleFunc("/budgets", s.ListBudgets).Methods("GET")
+	s.router.HandleFunc("/budgets", s.CreateBudget).Methods("POST")
+	s.router.HandleFunc("/budgets/{id:[0-9]+}", s.GetBudget).Methods("GET")
+	s.router.HandleFunc("/budgets/{id:[0-9]+}", s.UpdateBudget).Methods("PATCH")
+	s.router.HandleFunc("/budgets/{id:[0-9]+}", s.DeleteBudget).Methods("DELETE")
+	s.router.HandleFunc("/budgets/{id:[0-9]+}/status", s.GetBudgetStatus).Methods("GET")
+	s.router.HandleFunc("/recurring-transactions", s.ListRecurringTransactions).Methods("GET")
+	s.router.HandleFunc("/recurring-transactions", s.CreateRecurringTransaction).Methods("POST")
+	s.router.HandleFunc("/recurring-transactions/{id:[0-9]+}", s.GetRecurringTransaction).Methods("GET")
+	s.router.HandleFunc("/recurring-transactions/{id:[0-9]+}", s.UpdateRecurringTransaction).Methods("PATCH")
+	s.router.HandleFunc("/recurring-transactions/{id:[0-9]+}", s.DeleteRecurringTransaction).Methods("DELETE")
+	s.router.HandleFunc("/recurring-transactions/{id:[0-9]+}/preview", s.PreviewRecurringTransaction).Methods("GET")
+	s.router.HandleFunc("/exports/{resource:accounts|categories|transactions}", s.Export).Methods("GET")
+	s.router.HandleFunc("/admin/backup", s.Backup).Methods("GET")
+	s.router.HandleFunc("/admin/restore", s.Restore).Methods("POST")
+	s.router.HandleFunc("/rules", s.ListRules).Methods("GET")
+	s.router.HandleFunc("/rules", s.CreateRule).Methods("POST")
+	s.router.HandleFunc("/rules/{id:[0-9]+}", s.GetRule).Methods("GET")
+	s.router.HandleFunc("/rules/{id:[0-9]+}", s.UpdateRule).Methods("PATCH")
+	s.router.HandleFunc("/rules/{id:[0-9]+}", s.DeleteRule).Methods("DELETE")
+	s.router.HandleFunc("/rules/dry-run", s.DryRunRule).Methods("POST")
+	s.router.HandleFunc("/rules/apply", s.ApplyRules).Methods("POST")
+	s.router.HandleFunc("/reports/cashflow", s.GetCashflowReport).Methods("GET")
+	s.router.HandleFunc("/reports/categories", s.GetCategoryReport).Methods("GET")
+	s.router.HandleFunc("/reports/net-worth", s.GetNetWorthReport).Methods("GET")
+	s.router.HandleFunc("/scrapper/status", s.GetSchedulerStatus).Methods("GET")
 	s.router.HandleFunc("/currencies", s.ListCurrencies).Methods("GET")
 	s.router.HandleFunc("/currencies/{name:[a-zA-Z]{3}}", s.GetCurrency).Methods("GET")
+	s.router.HandleFunc("/currencies/{name:[a-zA-Z]{3}}/rates", s.ListRates).Methods("GET")
+	s.router.HandleFunc("/currencies/{name:[a-zA-Z]{3}}/rates/{rate:[a-zA-Z]{3}}", s.ListRateHistory).Methods("GET")
 }
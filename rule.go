@@ -0,0 +1,581 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/shopspring/decimal"
+)
+
+// Rule assigns its categories to transactions created or imported without any,
+// when the description, value, account and type match. Empty conditions match everything.
+// Rules are tried by Priority, lowest first, and the first one matching wins.
+type Rule struct {
+	ID       int    `json:"id"`
+	UserID   int    `json:"-"`
+	Name     string `json:"name"`
+	Priority int    `json:"priority"`
+	// Description is a text the description must contain, ignoring case,
+	// or a regular expression when Match is REGEX
+	Description string           `json:"description"`
+	Match       string           `json:"match"`
+	MinValue    *decimal.Decimal `json:"min_value,omitempty"`
+	MaxValue    *decimal.Decimal `json:"max_value,omitempty"`
+	AccountID   int              `json:"account_id,omitempty"`
+	Type        string           `json:"type,omitempty"`
+	Categories  []Category       `json:"categories"`
+	CreatedAt   string           `json:"created_at"`
+	UpdatedAt   string           `json:"updated_at"`
+
+	pattern *regexp.Regexp
+}
+
+// RuleMatch is a transaction matched by a Rule, with the categories it has and the ones the Rule gives
+type RuleMatch struct {
+	TransactionID int             `json:"transaction_id"`
+	AccountID     int             `json:"account_id"`
+	Date          string          `json:"date"`
+	Description   string          `json:"description"`
+	Value         decimal.Decimal `json:"value"`
+	Type          string          `json:"type"`
+	RuleID        int             `json:"rule_id,omitempty"`
+	CategoryIDs   []int           `json:"category_ids"`
+	NewCategories []Category      `json:"new_categories"`
+	Changed       bool            `json:"changed"`
+}
+
+// RulesResult is the report of applying the rules to existing transactions
+type RulesResult struct {
+	DryRun  bool        `json:"dry_run"`
+	Total   int         `json:"total"`
+	Matched int         `json:"matched"`
+	Updated int         `json:"updated"`
+	Matches []RuleMatch `json:"matches"`
+}
+
+const ruleColumns = `id, user_id, name, priority, description, match, min_value, max_value, COALESCE(account_id, 0), type, created_at, updated_at`
+
+// ListRules returns the rules of the User in the order they are tried
+func ListRules(db *sql.DB, userID int) ([]Rule, error) {
+	rows, err := db.Query(
+		`SELECT `+ruleColumns+` FROM rules WHERE user_id = $1 ORDER BY priority, id`, userID,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rules := []Rule{}
+
+	for rows.Next() {
+		var rule Rule
+		errScan := rule.scan(rows)
+		if errScan != nil {
+			rows.Close()
+			return nil, errScan
+		}
+
+		rules = append(rules, rule)
+	}
+	rows.Close()
+
+	for index := range rules {
+		errCat := rules[index].getRelatedCategories(db)
+		if errCat != nil {
+			return nil, errCat
+		}
+	}
+
+	return rules, nil
+}
+
+func GetRule(db *sql.DB, userID int, id int) (rule Rule, err error) {
+	row := db.QueryRow(
+		`SELECT `+ruleColumns+` FROM rules WHERE id = $1 AND user_id = $2`, id, userID,
+	)
+
+	err = rule.scan(row)
+	if err != nil {
+		return
+	}
+
+	err = rule.getRelatedCategories(db)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (rule *Rule) scan(row rowScanner) (err error) {
+	var minValue, maxValue sql.NullString
+
+	err = row.Scan(
+		&rule.ID,
+		&rule.UserID,
+		&rule.Name,
+		&rule.Priority,
+		&rule.Description,
+		&rule.Match,
+		&minValue,
+		&maxValue,
+		&rule.AccountID,
+		&rule.Type,
+		&rule.CreatedAt,
+		&rule.UpdatedAt,
+	)
+
+	if err != nil {
+		return
+	}
+
+	if minValue.Valid {
+		value, _ := decimal.NewFromString(minValue.String)
+		rule.MinValue = &value
+	}
+
+	if maxValue.Valid {
+		value, _ := decimal.NewFromString(maxValue.String)
+		rule.MaxValue = &value
+	}
+
+	return rule.compile()
+}
+
+func (rule *Rule) getRelatedCategories(db *sql.DB) (err error) {
+	rows, err := db.Query(
+		"SELECT category_id FROM rules_categories WHERE rule_id = $1 ORDER BY category_id",
+		rule.ID,
+	)
+
+	if err != nil {
+		return
+	}
+
+	ids := []int{}
+
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			rows.Close()
+			return
+		}
+
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	rule.Categories = []Category{}
+
+	for _, id := range ids {
+		category, errCat := GetCategory(db, rule.UserID, id)
+		if errCat != nil {
+			return errCat
+		}
+
+		rule.Categories = append(rule.Categories, category)
+	}
+
+	return
+}
+
+func (rule *Rule) saveRelatedCategories(db *sql.DB, tx *sql.Tx) (err error) {
+	_, err = tx.Exec(
+		"DELETE FROM rules_categories WHERE rule_id = $1",
+		rule.ID,
+	)
+	if err != nil {
+		return
+	}
+
+	for index, structCategory := range rule.Categories {
+		category, errCat := GetCategory(db, rule.UserID, structCategory.ID)
+		if errCat != nil {
+			return fmt.Errorf("category %d not found", structCategory.ID)
+		}
+
+		rule.Categories[index] = category
+
+		_, err = tx.Exec(
+			"INSERT INTO rules_categories(rule_id, category_id) VALUES($1, $2)",
+			rule.ID,
+			category.ID,
+		)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// checkAccount makes sure the account of the Rule, if any, belongs to its User
+func (rule Rule) checkAccount(db *sql.DB) error {
+	if rule.AccountID == 0 {
+		return nil
+	}
+
+	var exists bool
+	err := db.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM accounts WHERE id = $1 AND user_id = $2)",
+		rule.AccountID,
+		rule.UserID,
+	).Scan(&exists)
+
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return fmt.Errorf("account %d not found", rule.AccountID)
+	}
+
+	return nil
+}
+
+func (rule *Rule) Create(db *sql.DB) (err error) {
+	createdAt := time.Now()
+
+	err = rule.checkAccount(db)
+	if err != nil {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+
+	err = tx.QueryRow(
+		`INSERT INTO rules(user_id, name, priority, description, match, min_value, max_value, account_id, type, created_at, updated_at)
+		VALUES($1, $2, $3, $4, $5, $6, $7, NULLIF($8, 0), $9, $10, $11)
+		RETURNING id, created_at, updated_at`,
+		rule.UserID,
+		rule.Name,
+		rule.Priority,
+		rule.Description,
+		rule.Match,
+		rule.MinValue,
+		rule.MaxValue,
+		rule.AccountID,
+		rule.Type,
+		createdAt,
+		createdAt,
+	).Scan(&rule.ID, &rule.CreatedAt, &rule.UpdatedAt)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+
+	err = rule.saveRelatedCategories(db, tx)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+
+	return tx.Commit()
+}
+
+func (rule *Rule) Update(db *sql.DB) (err error) {
+	updatedAt := time.Now()
+
+	err = rule.checkAccount(db)
+	if err != nil {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+
+	err = tx.QueryRow(
+		`UPDATE rules
+		SET name = $1, priority = $2, description = $3, match = $4, min_value = $5, max_value = $6,
+		account_id = NULLIF($7, 0), type = $8, updated_at = $9
+		WHERE id = $10 AND user_id = $11
+		RETURNING updated_at`,
+		rule.Name,
+		rule.Priority,
+		rule.Description,
+		rule.Match,
+		rule.MinValue,
+		rule.MaxValue,
+		rule.AccountID,
+		rule.Type,
+		updatedAt,
+		rule.ID,
+		rule.UserID,
+	).Scan(&rule.UpdatedAt)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+
+	err = rule.saveRelatedCategories(db, tx)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+
+	return tx.Commit()
+}
+
+func (rule *Rule) Delete(db *sql.DB) (err error) {
+	_, err = db.Exec(
+		"DELETE FROM rules WHERE id = $1 AND user_id = $2",
+		rule.ID,
+		rule.UserID,
+	)
+
+	return
+}
+
+func (rule Rule) Validate() (err error) {
+	if rule.Name == "" {
+		err = errors.New("field 'name' must not be empty")
+	}
+
+	matchCheck := regexp.MustCompile(`^(CONTAINS|REGEX)$`)
+	if !matchCheck.MatchString(rule.Match) {
+		err = errors.New("field 'match' must be 'CONTAINS' or 'REGEX'")
+	}
+
+	if rule.Match == "REGEX" {
+		if _, errRegexp := regexp.Compile(rule.Description); errRegexp != nil {
+			err = errors.New("field 'description' must be a valid regular expression")
+		}
+	}
+
+	typeCheck := regexp.MustCompile(`^(INCOME|EXPENSE|)$`)
+	if !typeCheck.MatchString(rule.Type) {
+		err = errors.New("field 'type' must be 'INCOME' or 'EXPENSE'")
+	}
+
+	if rule.MinValue != nil && rule.MaxValue != nil && rule.MinValue.GreaterThan(*rule.MaxValue) {
+		err = errors.New("field 'min_value' must not be more than 'max_value'")
+	}
+
+	if len(rule.Categories) <= 0 {
+		err = errors.New("field 'categories' must not be empty")
+	}
+
+	return
+}
+
+// compile prepares the regular expression of a REGEX Rule
+func (rule *Rule) compile() (err error) {
+	rule.pattern = nil
+	if rule.Match == "REGEX" {
+		rule.pattern, err = regexp.Compile(rule.Description)
+	}
+
+	return
+}
+
+// Matches tells if the transaction meets every condition of the Rule
+func (rule Rule) Matches(transaction Transaction) bool {
+	if rule.AccountID != 0 && rule.AccountID != transaction.Account.ID {
+		return false
+	}
+
+	if rule.Type != "" && rule.Type != transaction.Type {
+		return false
+	}
+
+	if rule.MinValue != nil && transaction.Value.LessThan(*rule.MinValue) {
+		return false
+	}
+
+	if rule.MaxValue != nil && transaction.Value.GreaterThan(*rule.MaxValue) {
+		return false
+	}
+
+	if rule.pattern != nil {
+		return rule.pattern.MatchString(transaction.Description)
+	}
+
+	return strings.Contains(strings.ToLower(transaction.Description), strings.ToLower(rule.Description))
+}
+
+// matchRule returns the first of the rules matching the transaction, nil if none does
+func matchRule(rules []Rule, transaction Transaction) *Rule {
+	for index := range rules {
+		if rules[index].Matches(transaction) {
+			return &rules[index]
+		}
+	}
+
+	return nil
+}
+
+// applyRules gives the transaction the categories of the first Rule of its User matching it,
+// unless it already has categories
+func applyRules(db *sql.DB, userID int, transaction *Transaction) (err error) {
+	if len(transaction.Categories) > 0 {
+		return
+	}
+
+	rules, err := ListRules(db, userID)
+	if err != nil {
+		return
+	}
+
+	if rule := matchRule(rules, *transaction); rule != nil {
+		transaction.Categories = append([]Category{}, rule.Categories...)
+	}
+
+	return
+}
+
+// matchTransactions runs the rules over the INCOME and EXPENSE transactions of the User matching the filter.
+// Matched transactions get the categories of their first matching Rule, unless dryRun,
+// all in a single database transaction.
+func matchTransactions(db *sql.DB, userID int, rules []Rule, filter ExportFilter, dryRun bool) (result RulesResult, err error) {
+	result.DryRun = dryRun
+	result.Matches = []RuleMatch{}
+
+	// the categories are compared by id with the ones of the transactions
+	for index := range rules {
+		categories := rules[index].Categories
+		sort.Slice(categories, func(i, j int) bool {
+			return categories[i].ID < categories[j].ID
+		})
+	}
+
+	conditions := []string{"a.user_id = $1", "t.type IN ('INCOME', 'EXPENSE')"}
+	args := []interface{}{userID}
+
+	if filter.AccountID != 0 {
+		args = append(args, filter.AccountID)
+		conditions = append(conditions, fmt.Sprintf("t.account_id = $%d", len(args)))
+	}
+
+	if !filter.From.IsZero() {
+		args = append(args, filter.From.Format(dateLayout))
+		conditions = append(conditions, fmt.Sprintf("t.date >= $%d", len(args)))
+	}
+
+	if !filter.To.IsZero() {
+		args = append(args, filter.To.Format(dateLayout))
+		conditions = append(conditions, fmt.Sprintf("t.date <= $%d", len(args)))
+	}
+
+	rows, err := db.Query(
+		`SELECT t.id, t.account_id, to_char(t.date, 'YYYY-MM-DD'), t.description, t.value, t.type,
+		COALESCE(array_agg(tc.category_id ORDER BY tc.category_id) FILTER (WHERE tc.category_id IS NOT NULL), '{}')
+		FROM transactions t
+		INNER JOIN accounts a ON (t.account_id = a.id)
+		LEFT JOIN transactions_categories tc ON (tc.transaction_id = t.id)
+		WHERE `+strings.Join(conditions, " AND ")+`
+		GROUP BY t.id
+		ORDER BY t.date, t.id`,
+		args...,
+	)
+
+	if err != nil {
+		return
+	}
+
+	for rows.Next() {
+		var transaction Transaction
+		var categoryIDs pq.Int64Array
+
+		err = rows.Scan(
+			&transaction.ID,
+			&transaction.Account.ID,
+			&transaction.Date,
+			&transaction.Description,
+			&transaction.Value,
+			&transaction.Type,
+			&categoryIDs,
+		)
+		if err != nil {
+			rows.Close()
+			return
+		}
+
+		result.Total++
+
+		rule := matchRule(rules, transaction)
+		if rule == nil {
+			continue
+		}
+
+		match := RuleMatch{
+			TransactionID: transaction.ID,
+			AccountID:     transaction.Account.ID,
+			Date:          transaction.Date,
+			Description:   transaction.Description,
+			Value:         transaction.Value,
+			Type:          transaction.Type,
+			RuleID:        rule.ID,
+			CategoryIDs:   []int{},
+			NewCategories: rule.Categories,
+		}
+
+		for _, categoryID := range categoryIDs {
+			match.CategoryIDs = append(match.CategoryIDs, int(categoryID))
+		}
+
+		// both lists are ordered by id
+		match.Changed = len(match.CategoryIDs) != len(rule.Categories)
+		for index := 0; !match.Changed && index < len(rule.Categories); index++ {
+			match.Changed = match.CategoryIDs[index] != rule.Categories[index].ID
+		}
+
+		result.Matched++
+		if match.Changed {
+			result.Updated++
+		}
+
+		result.Matches = append(result.Matches, match)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil || dryRun {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+
+	for _, match := range result.Matches {
+		if !match.Changed {
+			continue
+		}
+
+		_, err = tx.Exec("DELETE FROM transactions_categories WHERE transaction_id = $1", match.TransactionID)
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		amounts := splitEvenly(match.Value, len(match.NewCategories))
+		for index, category := range match.NewCategories {
+			_, err = tx.Exec(
+				"INSERT INTO transactions_categories(transaction_id, category_id, amount) VALUES($1, $2, $3)",
+				match.TransactionID,
+				category.ID,
+				amounts[index],
+			)
+			if err != nil {
+				tx.Rollback()
+				return
+			}
+		}
+	}
+
+	err = tx.Commit()
+
+	return
+}
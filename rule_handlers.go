@@ -0,0 +1,208 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+func (s *Server) ListRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := ListRules(s.db, currentUser(r).ID)
+
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, rules, http.StatusOK)
+	return
+}
+
+func (s *Server) CreateRule(w http.ResponseWriter, r *http.Request) {
+	rule, err := decodeRule(r, Rule{})
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rule.UserID = currentUser(r).ID
+	err = rule.Create(s.db)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	respondWithJSON(w, rule, http.StatusCreated)
+	return
+}
+
+func (s *Server) GetRule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	ruleID, _ := strconv.Atoi(vars["id"])
+	rule, err := GetRule(s.db, currentUser(r).ID, ruleID)
+
+	if err == sql.ErrNoRows {
+		respondWithError(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, rule, http.StatusOK)
+	return
+}
+
+func (s *Server) UpdateRule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	ruleID, _ := strconv.Atoi(vars["id"])
+	rule, err := GetRule(s.db, currentUser(r).ID, ruleID)
+
+	if err == sql.ErrNoRows {
+		respondWithError(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rule, err = decodeRule(r, rule)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = rule.Update(s.db)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	respondWithJSON(w, rule, http.StatusOK)
+	return
+}
+
+func (s *Server) DeleteRule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	ruleID, _ := strconv.Atoi(vars["id"])
+	rule, err := GetRule(s.db, currentUser(r).ID, ruleID)
+
+	if err == sql.ErrNoRows {
+		respondWithError(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = rule.Delete(s.db)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, nil, http.StatusNoContent)
+	return
+}
+
+// DryRunRule tests the Rule in the body, without saving it, against the existing transactions
+// filtered by ?account=, ?from= and ?to=, nothing is changed
+func (s *Server) DryRunRule(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+
+	rule, err := decodeRule(r, Rule{})
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rule.UserID = user.ID
+	for index, structCategory := range rule.Categories {
+		rule.Categories[index], err = GetCategory(s.db, user.ID, structCategory.ID)
+		if err != nil {
+			respondWithError(w, fmt.Sprintf("category %d not found", structCategory.ID), http.StatusBadRequest)
+			return
+		}
+	}
+
+	filter, err := parseExportFilter(r)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := matchTransactions(s.db, user.ID, []Rule{rule}, filter, true)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, result, http.StatusOK)
+	return
+}
+
+// ApplyRules gives every existing transaction filtered by ?account=, ?from= and ?to=
+// the categories of its first matching Rule, ?dry_run=true only reports what would change
+func (s *Server) ApplyRules(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+
+	dryRun := false
+	if value := r.URL.Query().Get("dry_run"); value != "" {
+		var err error
+		dryRun, err = strconv.ParseBool(value)
+		if err != nil {
+			respondWithError(w, "parameter 'dry_run' must be 'true' or 'false'", http.StatusBadRequest)
+			return
+		}
+	}
+
+	filter, err := parseExportFilter(r)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rules, err := ListRules(s.db, user.ID)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result, err := matchTransactions(s.db, user.ID, rules, filter, dryRun)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, result, http.StatusOK)
+	return
+}
+
+// decodeRule reads the body over rule, validates it and prepares its regular expression
+func decodeRule(r *http.Request, rule Rule) (Rule, error) {
+	json.NewDecoder(r.Body).Decode(&rule)
+
+	rule.Match = strings.ToUpper(rule.Match)
+	if rule.Match == "" {
+		rule.Match = "CONTAINS"
+	}
+	rule.Type = strings.ToUpper(rule.Type)
+
+	err := validateRequest(rule)
+	if err != nil {
+		return rule, err
+	}
+
+	return rule, rule.compile()
+}
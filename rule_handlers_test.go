@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/jonatasbaldin/fin/test"
+)
+
+func createRuleAccount() (Account, Category, Category) {
+	currency := Currency{
+		Name: "EUR",
+	}
+	currency.Create(s.db)
+	account := Account{
+		UserID:         testUser.ID,
+		Currency:       currency,
+		Name:           "Bank",
+		InitialBalance: Decimal("100.00"),
+	}
+	account.Create(s.db)
+	transport := Category{
+		UserID: testUser.ID,
+		Name:   "Transport",
+	}
+	transport.Create(s.db)
+	food := Category{
+		UserID: testUser.ID,
+		Name:   "Food",
+	}
+	food.Create(s.db)
+
+	return account, transport, food
+}
+
+func TestRuleMatches(t *testing.T) {
+	minValue := Decimal("10.00")
+	maxValue := Decimal("50.00")
+
+	rule := Rule{Match: "CONTAINS", Description: "uber"}
+	rule.compile()
+	transaction := Transaction{Account: Account{ID: 1}, Description: "UBER *TRIP", Value: Decimal("12.00"), Type: "EXPENSE"}
+
+	assert.True(t, rule.Matches(transaction))
+
+	rule.MinValue = &minValue
+	rule.MaxValue = &maxValue
+	rule.Type = "EXPENSE"
+	rule.AccountID = 1
+	assert.True(t, rule.Matches(transaction))
+
+	rule.AccountID = 2
+	assert.False(t, rule.Matches(transaction))
+
+	rule.AccountID = 0
+	transaction.Value = Decimal("50.01")
+	assert.False(t, rule.Matches(transaction))
+
+	rule = Rule{Match: "REGEX", Description: `^(?i)uber \*(trip|eats)$`}
+	rule.compile()
+	assert.True(t, rule.Matches(transaction))
+	transaction.Description = "Uber *Pass"
+	assert.False(t, rule.Matches(transaction))
+
+	// the first rule matching wins
+	rules := []Rule{{ID: 1, Match: "CONTAINS", Description: "pizza"}, {ID: 2, Match: "CONTAINS"}, {ID: 3, Match: "CONTAINS", Description: "uber"}}
+	assert.Equal(t, matchRule(rules, transaction).ID, 2)
+	assert.Nil(t, matchRule(rules[:1], transaction))
+}
+
+func TestCreateRuleValidation(t *testing.T) {
+	ClearDB(s.db)
+
+	_, transport, _ := createRuleAccount()
+
+	requests := map[string]string{
+		`{"name": "Uber", "description": "uber"}`:                                                "field 'categories' must not be empty",
+		`{"description": "uber", "categories": [{"id": %d}]}`:                                    "field 'name' must not be empty",
+		`{"name": "Uber", "match": "regex", "description": "(uber", "categories": [{"id": %d}]}`: "field 'description' must be a valid regular expression",
+		`{"name": "Uber", "match": "like", "categories": [{"id": %d}]}`:                          "field 'match' must be 'CONTAINS' or 'REGEX'",
+		`{"name": "Uber", "min_value": 20, "max_value": 10, "categories": [{"id": %d}]}`:         "field 'min_value' must not be more than 'max_value'",
+		`{"name": "Uber", "account_id": 99999, "categories": [{"id": %d}]}`:                      "account 99999 not found",
+	}
+
+	for body, message := range requests {
+		response := Request(s.router, "POST", "/rules", bytes.NewBufferString(fmt.Sprintf(body, transport.ID)))
+		assert.Equal(t, http.StatusBadRequest, response.Code, body)
+
+		var err CustomError
+		json.Unmarshal(response.Body.Bytes(), &err)
+		assert.Equal(t, err.Error, message, body)
+	}
+}
+
+func TestCreateTransactionWithRules(t *testing.T) {
+	ClearDB(s.db)
+
+	account, transport, food := createRuleAccount()
+
+	body := []byte(fmt.Sprintf(`{"name": "Uber Eats", "priority": 1, "description": "uber eats", "categories": [{"id": %d}]}`, food.ID))
+	response := Request(s.router, "POST", "/rules", bytes.NewBuffer(body))
+	assert.Equal(t, http.StatusCreated, response.Code)
+
+	body = []byte(fmt.Sprintf(`{"name": "Uber", "priority": 2, "description": "uber", "type": "expense", "categories": [{"id": %d}]}`, transport.ID))
+	response = Request(s.router, "POST", "/rules", bytes.NewBuffer(body))
+	assert.Equal(t, http.StatusCreated, response.Code)
+
+	var rule Rule
+	json.Unmarshal(response.Body.Bytes(), &rule)
+	assert.Equal(t, rule.Match, "CONTAINS")
+	assert.Equal(t, rule.Type, "EXPENSE")
+	assert.Equal(t, rule.Categories[0].Name, "Transport")
+
+	expected := map[string]int{
+		"Uber Trip":       transport.ID,
+		"UBER EATS Sushi": food.ID,
+	}
+
+	for description, categoryID := range expected {
+		body = []byte(fmt.Sprintf(`{"description": "%s", "value": 9.90, "type": "EXPENSE"}`, description))
+		response = Request(s.router, "POST", fmt.Sprintf("/accounts/%d/transactions", account.ID), bytes.NewBuffer(body))
+		assert.Equal(t, http.StatusCreated, response.Code, description)
+
+		var transaction Transaction
+		json.Unmarshal(response.Body.Bytes(), &transaction)
+		assert.Equal(t, transaction.Categories[0].ID, categoryID, description)
+	}
+
+	// categories given explicitly are kept
+	body = []byte(fmt.Sprintf(`{"description": "Uber Trip", "value": 9.90, "type": "EXPENSE", "categories": [{"id": %d}]}`, food.ID))
+	response = Request(s.router, "POST", fmt.Sprintf("/accounts/%d/transactions", account.ID), bytes.NewBuffer(body))
+	assert.Equal(t, http.StatusCreated, response.Code)
+
+	var transaction Transaction
+	json.Unmarshal(response.Body.Bytes(), &transaction)
+	assert.Equal(t, transaction.Categories[0].ID, food.ID)
+
+	// no rule matches
+	body = []byte(`{"description": "Salary", "value": 1000, "type": "INCOME"}`)
+	response = Request(s.router, "POST", fmt.Sprintf("/accounts/%d/transactions", account.ID), bytes.NewBuffer(body))
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+
+	var err CustomError
+	json.Unmarshal(response.Body.Bytes(), &err)
+	assert.Equal(t, err.Error, "field 'categories' must not be empty")
+}
+
+func TestImportTransactionsWithRules(t *testing.T) {
+	ClearDB(s.db)
+
+	account, transport, food := createRuleAccount()
+
+	rule := Rule{UserID: testUser.ID, Name: "Uber", Match: "CONTAINS", Description: "uber", Categories: []Category{transport}}
+	rule.Create(s.db)
+
+	statement := []byte("date,description,amount\n2019-01-05,Uber Trip,-9.90\n2019-01-06,Bakery,-3.50\n")
+
+	// without a category, the line no rule matches has an error
+	response := Request(s.router, "POST", fmt.Sprintf("/accounts/%d/imports", account.ID), bytes.NewBuffer(statement))
+	assert.Equal(t, http.StatusUnprocessableEntity, response.Code)
+
+	var result ImportResult
+	json.Unmarshal(response.Body.Bytes(), &result)
+	assert.Equal(t, result.Rows[0].RuleID, rule.ID)
+	assert.Equal(t, result.Rows[1].Error, "field 'categories' must not be empty")
+
+	// the given category is kept, like on create
+	response = Request(s.router, "POST", fmt.Sprintf("/accounts/%d/imports?category=%d", account.ID, food.ID), bytes.NewBuffer(statement))
+	assert.Equal(t, http.StatusCreated, response.Code)
+
+	result = ImportResult{}
+	json.Unmarshal(response.Body.Bytes(), &result)
+	assert.Equal(t, result.Created, 2)
+	assert.Equal(t, result.Rows[0].RuleID, 0)
+
+	uber, _ := GetTransaction(s.db, testUser.ID, result.Rows[0].TransactionID)
+	assert.Equal(t, uber.Categories[0].ID, food.ID)
+	bakery, _ := GetTransaction(s.db, testUser.ID, result.Rows[1].TransactionID)
+	assert.Equal(t, bakery.Categories[0].ID, food.ID)
+}
+
+func TestDryRunAndApplyRules(t *testing.T) {
+	ClearDB(s.db)
+
+	account, transport, food := createRuleAccount()
+
+	for _, description := range []string{"Uber Trip", "Bakery", "UBER Trip"} {
+		transaction := Transaction{Account: account, Description: description, Value: Decimal("9.90"), Type: "EXPENSE", Date: "2019-01-05", Categories: []Category{food}}
+		transaction.Create(s.db)
+	}
+
+	body := []byte(fmt.Sprintf(`{"name": "Uber", "match": "regex", "description": "(?i)^uber", "categories": [{"id": %d}]}`, transport.ID))
+	response := Request(s.router, "POST", "/rules/dry-run", bytes.NewBuffer(body))
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	var result RulesResult
+	json.Unmarshal(response.Body.Bytes(), &result)
+	assert.True(t, result.DryRun)
+	assert.Equal(t, result.Total, 3)
+	assert.Equal(t, result.Matched, 2)
+	assert.Equal(t, result.Matches[0].Description, "Uber Trip")
+	assert.Equal(t, result.Matches[0].CategoryIDs, []int{food.ID})
+	assert.Equal(t, result.Matches[0].NewCategories[0].ID, transport.ID)
+
+	// the dry run saves nothing
+	rules, _ := ListRules(s.db, testUser.ID)
+	assert.Equal(t, len(rules), 0)
+
+	response = Request(s.router, "POST", "/rules", bytes.NewBuffer(body))
+	assert.Equal(t, http.StatusCreated, response.Code)
+
+	response = Request(s.router, "POST", "/rules/apply", nil)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	result = RulesResult{}
+	json.Unmarshal(response.Body.Bytes(), &result)
+	assert.False(t, result.DryRun)
+	assert.Equal(t, result.Updated, 2)
+
+	uber, _ := GetTransaction(s.db, testUser.ID, result.Matches[1].TransactionID)
+	assert.Equal(t, len(uber.Categories), 1)
+	assert.Equal(t, uber.Categories[0].ID, transport.ID)
+
+	// applying again changes nothing
+	response = Request(s.router, "POST", "/rules/apply", nil)
+	result = RulesResult{}
+	json.Unmarshal(response.Body.Bytes(), &result)
+	assert.Equal(t, result.Matched, 2)
+	assert.Equal(t, result.Updated, 0)
+
+	// the category can't be deleted while a rule uses it
+	response = Request(s.router, "DELETE", fmt.Sprintf("/categories/%d", transport.ID), nil)
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+}
+
+func TestDryRunRuleCategoriesOrder(t *testing.T) {
+	ClearDB(s.db)
+
+	account, transport, food := createRuleAccount()
+
+	transaction := Transaction{Account: account, Description: "Uber Eats", Value: Decimal("9.90"), Type: "EXPENSE", Date: "2019-01-05", Categories: []Category{transport, food}}
+	transaction.Create(s.db)
+
+	// the categories in the body are in the opposite order of their ids
+	body := []byte(fmt.Sprintf(`{"name": "Uber", "description": "uber", "categories": [{"id": %d}, {"id": %d}]}`, food.ID, transport.ID))
+	response := Request(s.router, "POST", "/rules/dry-run", bytes.NewBuffer(body))
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	var result RulesResult
+	json.Unmarshal(response.Body.Bytes(), &result)
+	assert.Equal(t, result.Matched, 1)
+	assert.Equal(t, result.Updated, 0)
+	assert.False(t, result.Matches[0].Changed)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// scrapeLockID is the Postgres advisory lock held while scraping,
+// so many Fin instances sharing a database don't write the same rates twice
+const scrapeLockID = 4623687
+
+// RateScheduler runs the scrapper on a fixed interval in the background
+type RateScheduler struct {
+	db       *sql.DB
+	provider RateProvider
+	scrapper Scrapper
+	interval time.Duration
+
+	mu     sync.Mutex
+	status SchedulerStatus
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// SchedulerStatus is the state of the RateScheduler and its last run
+type SchedulerStatus struct {
+	Running     bool           `json:"running"`
+	Interval    string         `json:"interval"`
+	LastRunAt   *time.Time     `json:"last_run_at"`
+	NextRunAt   *time.Time     `json:"next_run_at"`
+	LastSkipped bool           `json:"last_skipped"`
+	LastError   string         `json:"last_error,omitempty"`
+	LastSummary *ScrapeSummary `json:"last_summary"`
+}
+
+func NewRateScheduler(db *sql.DB, provider RateProvider, scrapper Scrapper, interval time.Duration) *RateScheduler {
+	return &RateScheduler{
+		db:       db,
+		provider: provider,
+		scrapper: scrapper,
+		interval: interval,
+		status:   SchedulerStatus{Interval: interval.String()},
+	}
+}
+
+// Start runs the scheduler in a goroutine, when runNow is true the first run doesn't wait for the interval
+func (scheduler *RateScheduler) Start(runNow bool) {
+	scheduler.stop = make(chan struct{})
+	scheduler.done = make(chan struct{})
+
+	scheduler.mu.Lock()
+	scheduler.status.Running = true
+	scheduler.mu.Unlock()
+
+	go func() {
+		defer close(scheduler.done)
+
+		if runNow {
+			scheduler.run()
+		}
+
+		ticker := time.NewTicker(scheduler.interval)
+		defer ticker.Stop()
+
+		for {
+			scheduler.setNextRun(time.Now().Add(scheduler.interval))
+
+			select {
+			case <-ticker.C:
+				scheduler.run()
+			case <-scheduler.stop:
+				return
+			}
+		}
+	}()
+
+	log.Print(fmt.Sprintf("Rate scheduler started, running every %s", scheduler.interval))
+}
+
+// Stop waits for a running scrape to finish and stops the scheduler
+func (scheduler *RateScheduler) Stop() {
+	if scheduler.stop == nil {
+		return
+	}
+
+	close(scheduler.stop)
+	<-scheduler.done
+
+	scheduler.mu.Lock()
+	scheduler.status.Running = false
+	scheduler.status.NextRunAt = nil
+	scheduler.mu.Unlock()
+
+	log.Print("Rate scheduler stopped")
+}
+
+func (scheduler *RateScheduler) Status() SchedulerStatus {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+
+	return scheduler.status
+}
+
+func (scheduler *RateScheduler) setNextRun(next time.Time) {
+	scheduler.mu.Lock()
+	scheduler.status.NextRunAt = &next
+	scheduler.mu.Unlock()
+}
+
+func (scheduler *RateScheduler) run() {
+	startedAt := time.Now()
+	var summary ScrapeSummary
+	var errScrape error
+
+	acquired, err := withScrapeLock(scheduler.db, func() {
+		summary, errScrape = scheduler.scrapper(scheduler.db, scheduler.provider)
+	})
+
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+
+	scheduler.status.LastRunAt = &startedAt
+	scheduler.status.LastSkipped = !acquired
+	scheduler.status.LastError = ""
+
+	if err != nil {
+		scheduler.status.LastError = err.Error()
+		log.Print(fmt.Sprintf("Rate scheduler failed: %s", err))
+		return
+	}
+
+	if !acquired {
+		log.Print("Rate scheduler skipped, another instance is scraping")
+		return
+	}
+
+	scheduler.status.LastSummary = &summary
+	if errScrape != nil {
+		scheduler.status.LastError = errScrape.Error()
+	}
+
+	log.Print(summary)
+}
+
+// withScrapeLock runs fn only if the scrape advisory lock could be acquired,
+// the lock lives in a single connection, so it is taken and released on the same one
+func withScrapeLock(db *sql.DB, fn func()) (acquired bool, err error) {
+	ctx := context.Background()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", scrapeLockID).Scan(&acquired)
+	if err != nil || !acquired {
+		return
+	}
+
+	defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", scrapeLockID)
+
+	fn()
+
+	return
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"net/http"
+)
+
+func (s *Server) GetSchedulerStatus(w http.ResponseWriter, r *http.Request) {
+	if s.scheduler == nil {
+		respondWithJSON(w, SchedulerStatus{}, http.StatusOK)
+		return
+	}
+
+	respondWithJSON(w, s.scheduler.Status(), http.StatusOK)
+	return
+}
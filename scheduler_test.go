@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/jonatasbaldin/fin/test"
+)
+
+func TestRateScheduler(t *testing.T) {
+	ClearDB(s.db)
+	backoff := scrapeBackoff
+	scrapeBackoff = 0
+	defer func() { scrapeBackoff = backoff }()
+
+	provider := flakyProvider{calls: map[string]int{}}
+	scheduler := NewRateScheduler(s.db, provider, Scrape, time.Hour)
+	scheduler.Start(true)
+
+	for i := 0; i < 100 && scheduler.Status().LastRunAt == nil; i++ {
+		time.Sleep(50 * time.Millisecond)
+	}
+	scheduler.Stop()
+
+	status := scheduler.Status()
+	assert.False(t, status.Running)
+	assert.False(t, status.LastSkipped)
+	assert.NotNil(t, status.LastRunAt)
+	assert.Equal(t, len(status.LastSummary.Failed), 1)
+	assert.Equal(t, status.LastError, "scrapper failed for 1 of 33 currencies")
+}
+
+func TestScrapeLockSkipsConcurrentRuns(t *testing.T) {
+	var innerAcquired bool
+
+	acquired, err := withScrapeLock(s.db, func() {
+		innerAcquired, _ = withScrapeLock(s.db, func() {})
+	})
+
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+	assert.False(t, innerAcquired)
+}
+
+func TestGetSchedulerStatus(t *testing.T) {
+	response := Request(s.router, "GET", "/scrapper/status", nil)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	var status SchedulerStatus
+	json.Unmarshal(response.Body.Bytes(), &status)
+
+	assert.False(t, status.Running)
+}
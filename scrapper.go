@@ -3,9 +3,13 @@ package main
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"sort"
+	"strings"
+	"time"
 
 	_ "github.com/lib/pq"
 	"github.com/shopspring/decimal"
@@ -23,65 +27,286 @@ type httpClient interface {
 	Get(url string) (resp *http.Response, err error)
 }
 
-func Scrape(db *sql.DB, httpClient httpClient) (err error) {
-	log.Print("Starting scrapper")
+// scrapeAttempts and scrapeBackoff control how a failing base currency is retried,
+// the backoff doubles after each attempt
+var scrapeAttempts = 3
+var scrapeBackoff = 2 * time.Second
 
-	for currencyName, currencySymbol := range supportedRatesAndSymbols {
-		currency, err := GetCurrency(db, currencyName)
-		if err != nil {
-			currency = Currency{
-				Name:   currencyName,
-				Symbol: currencySymbol,
-			}
-			err = currency.Create(db)
-			if err != nil {
-				return err
-			}
-		}
+// ScrapeError is the failure of scraping a single base currency
+type ScrapeError struct {
+	Currency string `json:"currency"`
+	Err      error  `json:"-"`
+}
 
-		var er ExchangeRates
-		er.getExchangeRates(currency.Name, httpClient)
+func (e ScrapeError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Currency, e.Err)
+}
 
-		currency.CleanRates()
+func (e ScrapeError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{"currency": e.Currency, "error": e.Err.Error()})
+}
 
-		for key, value := range er.Rates {
-			rate := Rate{
-				Name:   key,
-				Symbol: supportedRatesAndSymbols[key],
-				Value:  decimal.NewFromFloat(value).Truncate(2),
-			}
-			currency.Rates = append(currency.Rates, rate)
-		}
+// ScrapeSummary tells what happened in a scrapper run
+type ScrapeSummary struct {
+	Provider     string        `json:"provider"`
+	Succeeded    []string      `json:"succeeded"`
+	Failed       []ScrapeError `json:"failed"`
+	RatesWritten int           `json:"rates_written"`
+	StartedAt    time.Time     `json:"started_at"`
+	FinishedAt   time.Time     `json:"finished_at"`
+}
 
-		err = createRates(db, &currency)
-		if err != nil {
-			return err
+func (summary ScrapeSummary) String() string {
+	lines := []string{
+		fmt.Sprintf(
+			"Scrapper with %s finished in %s: %d succeeded, %d failed, %d rates written",
+			summary.Provider,
+			summary.FinishedAt.Sub(summary.StartedAt).Round(time.Millisecond),
+			len(summary.Succeeded),
+			len(summary.Failed),
+			summary.RatesWritten,
+		),
+	}
+
+	for _, failure := range summary.Failed {
+		lines = append(lines, fmt.Sprintf("  failed %s", failure))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Err returns an error when one or more base currencies failed
+func (summary ScrapeSummary) Err() error {
+	if len(summary.Failed) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("scrapper failed for %d of %d currencies", len(summary.Failed), len(summary.Failed)+len(summary.Succeeded))
+}
+
+// Scrapper gets and stores the rates of all supported currencies
+type Scrapper func(db *sql.DB, provider RateProvider) (ScrapeSummary, error)
+
+// Scrape gets the rates of every supported currency, a failing currency is skipped
+// and reported in the summary, the returned error is the same as summary.Err()
+func Scrape(db *sql.DB, provider RateProvider) (summary ScrapeSummary, err error) {
+	log.Print(fmt.Sprintf("Starting scrapper with %s", provider.Name()))
+
+	summary = ScrapeSummary{
+		Provider:  provider.Name(),
+		Succeeded: []string{},
+		Failed:    []ScrapeError{},
+		StartedAt: time.Now(),
+	}
+
+	currencyNames := []string{}
+	for currencyName := range supportedRatesAndSymbols {
+		currencyNames = append(currencyNames, currencyName)
+	}
+	sort.Strings(currencyNames)
+
+	for _, currencyName := range currencyNames {
+		written, errCurrency := scrapeCurrency(db, provider, currencyName)
+		if errCurrency != nil {
+			log.Print(fmt.Sprintf("Scrapper failed for %s: %s", currencyName, errCurrency))
+			summary.Failed = append(summary.Failed, ScrapeError{Currency: currencyName, Err: errCurrency})
+			continue
 		}
 
+		summary.Succeeded = append(summary.Succeeded, currencyName)
+		summary.RatesWritten += written
 	}
 
+	summary.FinishedAt = time.Now()
 	log.Print("Finishing scrapper")
 
+	return summary, summary.Err()
+}
+
+// scrapeCurrency gets and stores the rates of a single base currency, returning how many were written
+func scrapeCurrency(db *sql.DB, provider RateProvider, currencyName string) (written int, err error) {
+	currency, err := ensureCurrency(db, currencyName)
+	if err != nil {
+		return
+	}
+
+	er, err := getExchangeRatesWithRetry(provider, currency.Name)
+	if err != nil {
+		return
+	}
+
+	currency.CleanRates()
+
+	for key, value := range er.Rates {
+		rate := Rate{
+			Name:   key,
+			Symbol: supportedRatesAndSymbols[key],
+			Value:  roundRate(decimal.NewFromFloat(value)),
+		}
+		currency.Rates = append(currency.Rates, rate)
+	}
+
+	err = createRates(db, &currency)
+	if err != nil {
+		return
+	}
+
+	return len(currency.Rates), nil
+}
+
+// ensureCurrency gets the currency, creating it when it doesn't exist yet
+func ensureCurrency(db *sql.DB, currencyName string) (currency Currency, err error) {
+	currency, err = GetCurrency(db, currencyName)
+	if err == sql.ErrNoRows {
+		currency = Currency{
+			Name:   currencyName,
+			Symbol: supportedRatesAndSymbols[currencyName],
+		}
+		err = currency.Create(db)
+	}
+
 	return
 }
 
-func (er *ExchangeRates) getExchangeRates(currencyName string, httpClient httpClient) {
-	url := buildURL(currencyName)
+// CrossRatesScrapper returns a Scrapper that fetches only the base currency table
+// and derives every other pair from it
+func CrossRatesScrapper(base string) Scrapper {
+	return func(db *sql.DB, provider RateProvider) (ScrapeSummary, error) {
+		return ScrapeCrossRates(db, provider, base)
+	}
+}
+
+// ScrapeCrossRates makes a single upstream call for the base currency and calculates
+// the rate between any two supported currencies as base->to / base->from,
+// all rates are written in one transaction with the same timestamp
+func ScrapeCrossRates(db *sql.DB, provider RateProvider, base string) (summary ScrapeSummary, err error) {
+	log.Print(fmt.Sprintf("Starting cross rates scrapper with %s from %s", provider.Name(), base))
+
+	summary = ScrapeSummary{
+		Provider:  fmt.Sprintf("%s (cross rates from %s)", provider.Name(), base),
+		Succeeded: []string{},
+		Failed:    []ScrapeError{},
+		StartedAt: time.Now(),
+	}
+
+	currencyNames := []string{}
+	for currencyName := range supportedRatesAndSymbols {
+		currencyNames = append(currencyNames, currencyName)
+	}
+	sort.Strings(currencyNames)
+
+	er, errRates := getExchangeRatesWithRetry(provider, base)
+	if errRates != nil {
+		for _, currencyName := range currencyNames {
+			summary.Failed = append(summary.Failed, ScrapeError{Currency: currencyName, Err: errRates})
+		}
+		summary.FinishedAt = time.Now()
+		return summary, summary.Err()
+	}
+
+	baseRates := map[string]decimal.Decimal{base: decimal.New(1, 0)}
+	for name, value := range er.Rates {
+		if _, ok := supportedRatesAndSymbols[name]; ok && value > 0 {
+			baseRates[name] = decimal.NewFromFloat(value)
+		}
+	}
+
+	currencies := []Currency{}
+
+	for _, currencyName := range currencyNames {
+		from, ok := baseRates[currencyName]
+		if !ok {
+			summary.Failed = append(summary.Failed, ScrapeError{
+				Currency: currencyName,
+				Err:      fmt.Errorf("no rate from '%s'", base),
+			})
+			continue
+		}
+
+		currency, errCurrency := ensureCurrency(db, currencyName)
+		if errCurrency != nil {
+			summary.Failed = append(summary.Failed, ScrapeError{Currency: currencyName, Err: errCurrency})
+			continue
+		}
+
+		currency.CleanRates()
+
+		for name, to := range baseRates {
+			if name == currencyName {
+				continue
+			}
+
+			currency.Rates = append(currency.Rates, Rate{
+				Name:   name,
+				Symbol: supportedRatesAndSymbols[name],
+				Value:  roundRate(to.Div(from)),
+			})
+		}
+
+		currencies = append(currencies, currency)
+	}
 
-	resp, err := httpClient.Get(url)
+	// a database error fails every currency that was going to be written
+	defer func() {
+		if err != nil {
+			for _, currency := range currencies {
+				summary.Failed = append(summary.Failed, ScrapeError{Currency: currency.Name, Err: err})
+			}
+		}
+		summary.FinishedAt = time.Now()
+	}()
+
+	createdAt := time.Now()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+
+	for index := range currencies {
+		err = currencies[index].createRatesAt(tx, createdAt)
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+	}
+
+	err = tx.Commit()
 	if err != nil {
-		// TODO: should I panic here?
-		panic(err.Error())
+		return
+	}
+
+	for _, currency := range currencies {
+		summary.Succeeded = append(summary.Succeeded, currency.Name)
+		summary.RatesWritten += len(currency.Rates)
 	}
-	defer resp.Body.Close()
 
-	log.Print(fmt.Sprintf("Getting ExchageRate from %s", url))
+	log.Print("Finishing cross rates scrapper")
 
-	json.NewDecoder(resp.Body).Decode(er)
+	return summary, summary.Err()
 }
 
-func buildURL(currencyName string) string {
-	return exchangeRateAPIURL + fmt.Sprintf("/latest?base=%s", currencyName)
+func getExchangeRatesWithRetry(provider RateProvider, base string) (er ExchangeRates, err error) {
+	backoff := scrapeBackoff
+
+	for attempt := 1; attempt <= scrapeAttempts; attempt++ {
+		er, err = provider.GetExchangeRates(base)
+		if err == nil && len(er.Rates) == 0 {
+			err = errors.New("no rates returned")
+		}
+
+		if err == nil {
+			return
+		}
+
+		if attempt < scrapeAttempts {
+			log.Print(fmt.Sprintf("Attempt %d for %s failed: %s, retrying in %s", attempt, base, err, backoff))
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+
+	return er, fmt.Errorf("giving up after %d attempts: %s", scrapeAttempts, err)
 }
 
 func createRates(db *sql.DB, currency *Currency) (err error) {
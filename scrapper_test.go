@@ -3,9 +3,11 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	. "github.com/jonatasbaldin/fin/test"
@@ -32,7 +34,7 @@ func (client fakeHttpClient) Get(url string) (*http.Response, error) {
 		log.Fatal("error while marshaling the mocked data", err)
 	}
 
-	resp := &http.Response{Body: ioutil.NopCloser(bytes.NewBuffer(b))}
+	resp := &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(bytes.NewBuffer(b))}
 
 	return resp, nil
 }
@@ -40,6 +42,7 @@ func (client fakeHttpClient) Get(url string) (*http.Response, error) {
 func TestScrape(t *testing.T) {
 	ClearDB(s.db)
 	client := fakeHttpClient{}
+	provider := ExchangeRatesAPIProvider{URL: exchangeRateAPIURL, Client: client}
 
 	value, _ := decimal.NewFromString("3.80")
 	rate := Rate{
@@ -54,7 +57,7 @@ func TestScrape(t *testing.T) {
 	}
 	currency.Create(s.db)
 
-	err := Scrape(s.db, client)
+	_, err := Scrape(s.db, provider)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -71,3 +74,144 @@ func TestScrape(t *testing.T) {
 
 	assert.Equal(t, len(curr.Rates), 2)
 }
+
+const ecbDailyXML = `<?xml version="1.0" encoding="UTF-8"?>
+<gesmes:Envelope xmlns:gesmes="http://www.gesmes.org/xml/2002-08-01" xmlns="http://www.ecb.int/vocabulary/2002-08-01/eurofxref">
+	<gesmes:subject>Reference rates</gesmes:subject>
+	<Cube>
+		<Cube time="2019-01-28">
+			<Cube currency="USD" rate="1.25"/>
+			<Cube currency="BRL" rate="5.00"/>
+		</Cube>
+	</Cube>
+</gesmes:Envelope>`
+
+func TestExchangeRatesAPIProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, r.URL.Query().Get("base"), "USD")
+		w.Write([]byte(`{"rates": {"BRL": 3.75}, "base": "USD", "date": "2019-01-28"}`))
+	}))
+	defer server.Close()
+
+	provider := ExchangeRatesAPIProvider{URL: server.URL, Client: server.Client()}
+	er, err := provider.GetExchangeRates("USD")
+
+	assert.Nil(t, err)
+	assert.Equal(t, er.Base, "USD")
+	assert.Equal(t, er.Rates["BRL"], 3.75)
+}
+
+func TestECBProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(ecbDailyXML))
+	}))
+	defer server.Close()
+
+	provider := ECBProvider{URL: server.URL, Client: server.Client()}
+	er, err := provider.GetExchangeRates("USD")
+
+	assert.Nil(t, err)
+	assert.Equal(t, er.Date, "2019-01-28")
+	assert.Equal(t, er.Rates["EUR"], 0.8)
+	assert.Equal(t, er.Rates["BRL"], 4.0)
+	assert.NotContains(t, er.Rates, "USD")
+}
+
+func TestFallbackProvider(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	ecb := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(ecbDailyXML))
+	}))
+	defer ecb.Close()
+
+	provider := FallbackProvider{Providers: []RateProvider{
+		ExchangeRatesAPIProvider{URL: failing.URL, Client: failing.Client()},
+		ECBProvider{URL: ecb.URL, Client: ecb.Client()},
+	}}
+	er, err := provider.GetExchangeRates("EUR")
+
+	assert.Nil(t, err)
+	assert.Equal(t, er.Rates["USD"], 1.25)
+}
+
+func TestNewRateProvider(t *testing.T) {
+	provider, err := NewRateProvider("exchangeratesapi, ecb", fakeHttpClient{})
+	assert.Nil(t, err)
+	assert.Equal(t, provider.Name(), "exchangeratesapi,ecb")
+
+	_, err = NewRateProvider("what", fakeHttpClient{})
+	assert.Equal(t, err.Error(), "rate provider 'what' not supported")
+}
+
+type flakyProvider struct {
+	calls    map[string]int
+	failures int
+}
+
+func (provider flakyProvider) Name() string {
+	return "flaky"
+}
+
+// GetExchangeRates fails the first 'failures' calls of each base, and always fails for BRL
+func (provider flakyProvider) GetExchangeRates(base string) (ExchangeRates, error) {
+	provider.calls[base]++
+	if base == "BRL" || provider.calls[base] <= provider.failures {
+		return ExchangeRates{}, errors.New("upstream unavailable")
+	}
+
+	return ExchangeRates{Base: base, Rates: map[string]float64{"ZAR": 1.5}}, nil
+}
+
+func TestScrapeSummary(t *testing.T) {
+	ClearDB(s.db)
+	backoff := scrapeBackoff
+	scrapeBackoff = 0
+	defer func() { scrapeBackoff = backoff }()
+
+	provider := flakyProvider{calls: map[string]int{}, failures: 1}
+	summary, err := Scrape(s.db, provider)
+
+	assert.NotNil(t, err)
+	assert.Equal(t, len(summary.Failed), 1)
+	assert.Equal(t, summary.Failed[0].Currency, "BRL")
+	assert.Equal(t, len(summary.Succeeded), len(supportedRatesAndSymbols)-1)
+	assert.Equal(t, summary.RatesWritten, len(supportedRatesAndSymbols)-1)
+	assert.Equal(t, provider.calls["USD"], 2)
+	assert.Equal(t, provider.calls["BRL"], scrapeAttempts)
+}
+
+type countingProvider struct {
+	calls *int
+}
+
+func (provider countingProvider) Name() string {
+	return "counting"
+}
+
+func (provider countingProvider) GetExchangeRates(base string) (ExchangeRates, error) {
+	*provider.calls++
+	return ExchangeRates{Base: base, Rates: map[string]float64{"USD": 1.25, "BRL": 5}}, nil
+}
+
+func TestScrapeCrossRates(t *testing.T) {
+	ClearDB(s.db)
+
+	calls := 0
+	summary, err := ScrapeCrossRates(s.db, countingProvider{calls: &calls}, "EUR")
+
+	assert.NotNil(t, err)
+	assert.Equal(t, calls, 1)
+	assert.Equal(t, summary.Succeeded, []string{"BRL", "EUR", "USD"})
+	assert.Equal(t, summary.RatesWritten, 6)
+
+	usd, _ := GetCurrency(s.db, "USD")
+	rate, _ := usd.GetRate(s.db, "BRL")
+	assert.Equal(t, rate.Value.String(), "4")
+
+	brl, _ := GetCurrency(s.db, "BRL")
+	rate, _ = brl.GetRate(s.db, "USD")
+	assert.Equal(t, rate.Value.String(), "0.25")
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
@@ -14,9 +18,14 @@ import (
 )
 
 type Server struct {
-	db      *sql.DB
-	router  *mux.Router
-	migrate *migrate.Migrate
+	db           *sql.DB
+	router       *mux.Router
+	migrate      *migrate.Migrate
+	scheduler    *RateScheduler
+	materializer *Materializer
+	tokenSecret  []byte
+	tokenTTL     time.Duration
+	adminEmails  map[string]bool
 }
 
 func (s *Server) initializeDB(dbStr string) {
@@ -54,10 +63,49 @@ func (s *Server) migrateUp() {
 func (s *Server) Initialize() {
 	dbStr := os.Getenv("DB")
 	s.initializeDB(dbStr)
+	s.initializeAuth()
 	s.initializeRoutes()
 	s.initializeMigrate()
 }
 
+// Run serves until SIGINT or SIGTERM, then stops the scheduler and waits for open requests
 func (s *Server) Run(addr string) {
-	log.Fatal(http.ListenAndServe(addr, s.router))
+	server := &http.Server{Addr: addr, Handler: s.router}
+
+	if s.scheduler != nil {
+		s.scheduler.Start(isCurrenciesEmpty(s.db))
+	}
+
+	if s.materializer != nil {
+		s.materializer.Start()
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		err := server.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	<-stop
+	log.Print("Shutting down server")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	err := server.Shutdown(ctx)
+	if err != nil {
+		log.Print(err)
+	}
+
+	if s.scheduler != nil {
+		s.scheduler.Stop()
+	}
+
+	if s.materializer != nil {
+		s.materializer.Stop()
+	}
 }
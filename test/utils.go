@@ -51,6 +51,129 @@ created_at timestamp not null,
 updated_at timestamp not null
 )`
 
+const transfersTableCreation = `CREATE TABLE IF NOT EXISTS transfers
+(
+id serial primary key,
+from_account_id int references accounts (id),
+to_account_id int references accounts (id),
+description varchar(255),
+value numeric(12,2) not null,
+rate numeric(12,2) not null,
+created_at timestamp not null,
+updated_at timestamp not null
+)`
+
+const transactionsTransferColumnCreation = `ALTER TABLE transactions ADD COLUMN IF NOT EXISTS transfer_id int REFERENCES transfers ON DELETE CASCADE`
+
+const transactionsDateColumnCreation = `ALTER TABLE transactions ADD COLUMN IF NOT EXISTS date date NOT NULL DEFAULT CURRENT_DATE`
+
+const transactionsExternalIDColumnCreation = `ALTER TABLE transactions ADD COLUMN IF NOT EXISTS external_id varchar(255)`
+
+const transactionsExternalIDIndexCreation = `CREATE UNIQUE INDEX IF NOT EXISTS transactions_account_external_id_index ON transactions (account_id, external_id) WHERE external_id IS NOT NULL`
+
+const transfersDateColumnCreation = `ALTER TABLE transfers ADD COLUMN IF NOT EXISTS date date NOT NULL DEFAULT CURRENT_DATE`
+
+const ratesValuePrecisionChange = `ALTER TABLE rates ALTER COLUMN value TYPE numeric(20,10)`
+
+const transfersRatePrecisionChange = `ALTER TABLE transfers ALTER COLUMN rate TYPE numeric(20,10)`
+
+const usersTableCreation = `CREATE TABLE IF NOT EXISTS users
+(
+id serial primary key,
+email varchar(255) not null unique,
+name varchar(255),
+password_hash varchar(255) not null,
+created_at timestamp not null,
+updated_at timestamp not null
+)`
+
+const accountsUserColumnCreation = `ALTER TABLE accounts ADD COLUMN IF NOT EXISTS user_id int REFERENCES users ON DELETE CASCADE`
+
+const categoriesUserColumnCreation = `ALTER TABLE categories ADD COLUMN IF NOT EXISTS user_id int REFERENCES users ON DELETE CASCADE`
+
+const categoriesParentColumnCreation = `ALTER TABLE categories ADD COLUMN IF NOT EXISTS parent_id int REFERENCES categories`
+
+const apiKeysTableCreation = `CREATE TABLE IF NOT EXISTS api_keys
+(
+id serial primary key,
+user_id int not null REFERENCES users ON DELETE CASCADE,
+name varchar(255) not null,
+prefix varchar(255) not null,
+key_hash varchar(64) not null unique,
+read_only boolean not null default false,
+last_used_at timestamp,
+revoked_at timestamp,
+created_at timestamp not null
+)`
+
+const budgetsTableCreation = `CREATE TABLE IF NOT EXISTS budgets
+(
+id serial primary key,
+user_id int not null REFERENCES users ON DELETE CASCADE,
+category_id int not null REFERENCES categories ON DELETE CASCADE,
+period varchar(255) not null,
+amount numeric(12,2) not null,
+currency_name varchar(255) not null REFERENCES currencies (name),
+rollover boolean not null default false,
+start_date date not null,
+created_at timestamp not null,
+updated_at timestamp not null
+)`
+
+const recurringTransactionsTableCreation = `CREATE TABLE IF NOT EXISTS recurring_transactions
+(
+id serial primary key,
+account_id int not null REFERENCES accounts ON DELETE CASCADE,
+description varchar(255),
+value numeric(12,2) not null,
+type varchar(255) not null,
+frequency varchar(255) not null,
+interval int not null default 1,
+start_date date not null,
+end_date date,
+count int,
+created_at timestamp not null,
+updated_at timestamp not null
+)`
+
+const recurringTransactionsCategoriesTableCreation = `CREATE TABLE IF NOT EXISTS recurring_transactions_categories
+(
+recurring_transaction_id int REFERENCES recurring_transactions ON DELETE CASCADE,
+category_id int REFERENCES categories,
+PRIMARY KEY (recurring_transaction_id, category_id)
+)`
+
+const rulesTableCreation = `CREATE TABLE IF NOT EXISTS rules
+(
+id serial primary key,
+user_id int not null REFERENCES users ON DELETE CASCADE,
+name varchar(255) not null,
+priority int not null default 0,
+description varchar(255) not null default '',
+match varchar(255) not null default 'CONTAINS',
+min_value numeric(12,2),
+max_value numeric(12,2),
+account_id int REFERENCES accounts ON DELETE CASCADE,
+type varchar(255) not null default '',
+created_at timestamp not null,
+updated_at timestamp not null
+)`
+
+const rulesCategoriesTableCreation = `CREATE TABLE IF NOT EXISTS rules_categories
+(
+rule_id int REFERENCES rules ON DELETE CASCADE,
+category_id int REFERENCES categories,
+PRIMARY KEY (rule_id, category_id)
+)`
+
+const recurringTransactionsOccurrencesTableCreation = `CREATE TABLE IF NOT EXISTS recurring_transactions_occurrences
+(
+recurring_transaction_id int REFERENCES recurring_transactions ON DELETE CASCADE,
+date date not null,
+transaction_id int REFERENCES transactions ON DELETE SET NULL,
+PRIMARY KEY (recurring_transaction_id, date)
+)`
+
 const categoriesTableCreation = `CREATE TABLE IF NOT EXISTS categories
 (
 id serial primary key,
@@ -67,6 +190,8 @@ PRIMARY KEY (transaction_id, category_id)
 )
 `
 
+const transactionsCategoriesAmountColumnCreation = `ALTER TABLE transactions_categories ADD COLUMN IF NOT EXISTS amount numeric(12,2)`
+
 func EnsureTablesExists(db *sql.DB) {
 	var err error
 
@@ -82,6 +207,30 @@ func EnsureTablesExists(db *sql.DB) {
 		log.Fatal(err)
 	}
 
+	if _, err = db.Exec(transfersTableCreation); err != nil {
+		log.Fatal(err)
+	}
+
+	if _, err = db.Exec(transactionsTransferColumnCreation); err != nil {
+		log.Fatal(err)
+	}
+
+	if _, err = db.Exec(transactionsDateColumnCreation); err != nil {
+		log.Fatal(err)
+	}
+
+	if _, err = db.Exec(transfersDateColumnCreation); err != nil {
+		log.Fatal(err)
+	}
+
+	if _, err = db.Exec(transactionsExternalIDColumnCreation); err != nil {
+		log.Fatal(err)
+	}
+
+	if _, err = db.Exec(transactionsExternalIDIndexCreation); err != nil {
+		log.Fatal(err)
+	}
+
 	if _, err = db.Exec(categoriesTableCreation); err != nil {
 		log.Fatal(err)
 	}
@@ -94,12 +243,76 @@ func EnsureTablesExists(db *sql.DB) {
 		log.Fatal(err)
 	}
 
+	if _, err = db.Exec(transactionsCategoriesAmountColumnCreation); err != nil {
+		log.Fatal(err)
+	}
+
 	if _, err = db.Exec(ratesTableCreation); err != nil {
 		log.Fatal(err)
 	}
+
+	if _, err = db.Exec(ratesValuePrecisionChange); err != nil {
+		log.Fatal(err)
+	}
+
+	if _, err = db.Exec(transfersRatePrecisionChange); err != nil {
+		log.Fatal(err)
+	}
+
+	if _, err = db.Exec(usersTableCreation); err != nil {
+		log.Fatal(err)
+	}
+
+	if _, err = db.Exec(accountsUserColumnCreation); err != nil {
+		log.Fatal(err)
+	}
+
+	if _, err = db.Exec(categoriesUserColumnCreation); err != nil {
+		log.Fatal(err)
+	}
+
+	if _, err = db.Exec(categoriesParentColumnCreation); err != nil {
+		log.Fatal(err)
+	}
+
+	if _, err = db.Exec(apiKeysTableCreation); err != nil {
+		log.Fatal(err)
+	}
+
+	if _, err = db.Exec(budgetsTableCreation); err != nil {
+		log.Fatal(err)
+	}
+
+	if _, err = db.Exec(recurringTransactionsTableCreation); err != nil {
+		log.Fatal(err)
+	}
+
+	if _, err = db.Exec(recurringTransactionsCategoriesTableCreation); err != nil {
+		log.Fatal(err)
+	}
+
+	if _, err = db.Exec(recurringTransactionsOccurrencesTableCreation); err != nil {
+		log.Fatal(err)
+	}
+
+	if _, err = db.Exec(rulesTableCreation); err != nil {
+		log.Fatal(err)
+	}
+
+	if _, err = db.Exec(rulesCategoriesTableCreation); err != nil {
+		log.Fatal(err)
+	}
 }
 
 func ClearDB(db *sql.DB) {
+	db.Exec("DELETE FROM api_keys")
+
+	db.Exec("DELETE FROM budgets")
+
+	db.Exec("DELETE FROM recurring_transactions")
+
+	db.Exec("DELETE FROM rules")
+
 	db.Exec("DELETE FROM transactions_categories")
 
 	db.Exec("DELETE FROM categories")
@@ -108,6 +321,8 @@ func ClearDB(db *sql.DB) {
 	db.Exec("DELETE FROM transactions")
 	// db.Exec("ALTER SEQUENCE transactions_id_seq RESTART WITH 1")
 
+	db.Exec("DELETE FROM transfers")
+
 	db.Exec("DELETE FROM accounts")
 	// db.Exec("ALTER SEQUENCE accounts_id_seq RESTART WITH 1")
 
@@ -118,6 +333,14 @@ func ClearDB(db *sql.DB) {
 	// db.Exec("ALTER SEQUENCE currencies_id_seq RESTART WITH 1")
 }
 
+// ClearUsers deletes the users, ClearDB keeps them so the authenticated test user survives between tests
+func ClearUsers(db *sql.DB) {
+	db.Exec("DELETE FROM users")
+}
+
+// Authorization is sent in the Authorization header by Request, when not empty
+var Authorization string
+
 func Request(router *mux.Router, method string, path string, body io.Reader) (responseRecorder *httptest.ResponseRecorder) {
 	req, err := http.NewRequest(method, path, body)
 
@@ -125,6 +348,10 @@ func Request(router *mux.Router, method string, path string, body io.Reader) (re
 		log.Fatal("Could create the HTTP request")
 	}
 
+	if Authorization != "" {
+		req.Header.Set("Authorization", Authorization)
+	}
+
 	responseRecorder = httptest.NewRecorder()
 	router.ServeHTTP(responseRecorder, req)
 
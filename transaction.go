@@ -13,40 +13,93 @@ import (
 )
 
 type Transaction struct {
-	ID          int             `json:"id"`
-	Account     Account         `json:"account"`
-	Description string          `json:"description"`
-	Value       decimal.Decimal `json:"value"`
-	Type        string          `json:"type"`
-	Categories  []Category      `json:"categories"`
-	CreatedAt   string          `json:"created_at"`
-	UpdatedAt   string          `json:"updated_at"`
+	ID             int              `json:"id"`
+	Account        Account          `json:"account"`
+	Description    string           `json:"description"`
+	Value          decimal.Decimal  `json:"value"`
+	Type           string           `json:"type"`
+	Date           string           `json:"date"`
+	Categories     []Category       `json:"categories"`
+	TransferID     int              `json:"transfer_id,omitempty"`
+	ExternalID     string           `json:"external_id,omitempty"`
+	ConvertedValue *decimal.Decimal `json:"converted_value,omitempty"`
+	RunningBalance *decimal.Decimal `json:"running_balance,omitempty"`
+	CreatedAt      string           `json:"created_at"`
+	UpdatedAt      string           `json:"updated_at"`
 }
 
+// runningBalanceSQL is the balance of the account $1 after each of its transactions,
+// in date and id order, summed like Account.getBalance
+const runningBalanceSQL = `SELECT t.id, a.initial_balance + SUM(
+		CASE WHEN ` + transactionKindSQL + ` IN ('INCOME', 'TRANSFER_IN') THEN t.value ELSE -t.value END
+	) OVER (ORDER BY t.date, t.id) AS running_balance
+	FROM transactions t
+	INNER JOIN accounts a ON (t.account_id = a.id)
+	LEFT JOIN transfers tr ON (t.transfer_id = tr.id)
+	WHERE t.account_id = $1`
+
 func (transaction Transaction) MarshalJSON() ([]byte, error) {
 	var tmp struct {
-		ID          int             `json:"id"`
-		Description string          `json:"description"`
-		Value       decimal.Decimal `json:"value"`
-		Type        string          `json:"type"`
-		Categories  []Category      `json:"categories"`
-		CreatedAt   string          `json:"created_at"`
-		UpdatedAt   string          `json:"updated_at"`
+		ID             int              `json:"id"`
+		Description    string           `json:"description"`
+		Value          decimal.Decimal  `json:"value"`
+		Type           string           `json:"type"`
+		Date           string           `json:"date"`
+		Categories     []Category       `json:"categories"`
+		TransferID     int              `json:"transfer_id,omitempty"`
+		ExternalID     string           `json:"external_id,omitempty"`
+		ConvertedValue *decimal.Decimal `json:"converted_value,omitempty"`
+		RunningBalance *decimal.Decimal `json:"running_balance,omitempty"`
+		CreatedAt      string           `json:"created_at"`
+		UpdatedAt      string           `json:"updated_at"`
 	}
 
 	tmp.ID = transaction.ID
 	tmp.Description = transaction.Description
 	tmp.Value = transaction.Value
 	tmp.Type = transaction.Type
+	tmp.Date = transaction.Date
 	tmp.Categories = transaction.Categories
+	tmp.TransferID = transaction.TransferID
+	tmp.ExternalID = transaction.ExternalID
+	tmp.ConvertedValue = transaction.ConvertedValue
+	tmp.RunningBalance = transaction.RunningBalance
 	tmp.CreatedAt = transaction.CreatedAt
 	tmp.UpdatedAt = transaction.UpdatedAt
 
 	return json.Marshal(&tmp)
 }
 
-func ListTransactions(db *sql.DB, accountId int) ([]Transaction, error) {
-	rows, err := db.Query("SELECT id, account_id, description, value, type, created_at, updated_at FROM transactions WHERE account_id = $1", accountId)
+func ListTransactions(db *sql.DB, accountId int, filter TransactionFilter) ([]Transaction, error) {
+	where, args := filter.where(accountId)
+	limit, offset := filter.limitOffset()
+	args = append(args, limit, offset)
+
+	// the running balance is calculated over every transaction of the account, before filtering
+	runningBalance := "NULL::numeric"
+	runningBalanceJoin := ""
+	if filter.RunningBalance {
+		runningBalance = "rb.running_balance"
+		runningBalanceJoin = "INNER JOIN (" + runningBalanceSQL + ") rb ON (rb.id = t.id)"
+	}
+
+	rows, err := db.Query(
+		fmt.Sprintf(
+			`SELECT t.id, t.account_id, a.user_id, t.description, t.value, t.type, to_char(t.date, 'YYYY-MM-DD'), COALESCE(t.transfer_id, 0), COALESCE(t.external_id, ''), %s, t.created_at, t.updated_at
+			FROM transactions t INNER JOIN accounts a ON (t.account_id = a.id)
+			%s
+			WHERE %s
+			ORDER BY %s
+			LIMIT $%d OFFSET $%d`,
+			runningBalance,
+			runningBalanceJoin,
+			where,
+			filter.orderBy(),
+			len(args)-1,
+			len(args),
+		),
+		args...,
+	)
 
 	if err != nil {
 		return nil, err
@@ -59,15 +112,20 @@ func ListTransactions(db *sql.DB, accountId int) ([]Transaction, error) {
 		errScan := rows.Scan(
 			&transaction.ID,
 			&transaction.Account.ID,
+			&transaction.Account.UserID,
 			&transaction.Description,
 			&transaction.Value,
 			&transaction.Type,
+			&transaction.Date,
+			&transaction.TransferID,
+			&transaction.ExternalID,
+			&transaction.RunningBalance,
 			&transaction.CreatedAt,
 			&transaction.UpdatedAt,
 		)
 
 		if errScan != nil {
-			return nil, err
+			return nil, errScan
 		}
 
 		errCat := transaction.GetRelatedCategories(db)
@@ -82,40 +140,70 @@ func ListTransactions(db *sql.DB, accountId int) ([]Transaction, error) {
 	return transactions, nil
 }
 
+// CountTransactions returns how many transactions match the filter, ignoring the pagination
+func CountTransactions(db *sql.DB, accountId int, filter TransactionFilter) (count int, err error) {
+	where, args := filter.where(accountId)
+
+	err = db.QueryRow(
+		fmt.Sprintf("SELECT COUNT(t.id) FROM transactions t WHERE %s", where),
+		args...,
+	).Scan(&count)
+
+	return
+}
+
 func (transaction *Transaction) Create(db *sql.DB) (err error) {
 	err = transaction.Validate()
 	if err != nil {
 		return
 	}
 
-	createdAt := time.Now()
-
 	tx, err := db.Begin()
 	if err != nil {
 		return
 	}
 
+	err = transaction.insert(db, tx)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// insert writes the transaction and its categories using an already open tx,
+// so it can be part of a bigger operation, like creating both legs of a Transfer
+func (transaction *Transaction) insert(db *sql.DB, tx *sql.Tx) (err error) {
+	createdAt := time.Now()
+
+	// the date defaults to the day the transaction was entered
+	if transaction.Date == "" {
+		transaction.Date = createdAt.Format(dateLayout)
+	}
+
 	err = tx.QueryRow(
-		"INSERT INTO transactions(account_id, description, value, type, created_at, updated_at) VALUES($1, $2, $3, $4, $5, $6) RETURNING id, created_at, updated_at",
+		"INSERT INTO transactions(account_id, description, value, type, date, transfer_id, external_id, created_at, updated_at) VALUES($1, $2, $3, $4, $5, NULLIF($6, 0), NULLIF($7, ''), $8, $9) RETURNING id, created_at, updated_at",
 		transaction.Account.ID,
 		transaction.Description,
 		transaction.Value,
 		transaction.Type,
+		transaction.Date,
+		transaction.TransferID,
+		transaction.ExternalID,
 		createdAt,
 		createdAt,
 	).Scan(&transaction.ID, &transaction.CreatedAt, &transaction.UpdatedAt)
 	if err != nil {
-		tx.Rollback()
 		return
 	}
 
 	err = transaction.CreateRelatedCategories(db, tx)
-	if err != nil {
-		tx.Rollback()
-		return
-	}
-
-	err = tx.Commit()
 	if err != nil {
 		return
 	}
@@ -123,14 +211,21 @@ func (transaction *Transaction) Create(db *sql.DB) (err error) {
 	return
 }
 
-func GetTransaction(db *sql.DB, id int) (transaction Transaction, err error) {
+func GetTransaction(db *sql.DB, userID int, id int) (transaction Transaction, err error) {
 	err = db.QueryRow(
-		"SELECT id, description, value, type, created_at, updated_at FROM transactions WHERE id = $1", id,
+		`SELECT t.id, t.account_id, a.user_id, t.description, t.value, t.type, to_char(t.date, 'YYYY-MM-DD'), COALESCE(t.transfer_id, 0), COALESCE(t.external_id, ''), t.created_at, t.updated_at
+		FROM transactions t INNER JOIN accounts a ON (t.account_id = a.id)
+		WHERE t.id = $1 AND a.user_id = $2`, id, userID,
 	).Scan(
 		&transaction.ID,
+		&transaction.Account.ID,
+		&transaction.Account.UserID,
 		&transaction.Description,
 		&transaction.Value,
 		&transaction.Type,
+		&transaction.Date,
+		&transaction.TransferID,
+		&transaction.ExternalID,
 		&transaction.CreatedAt,
 		&transaction.UpdatedAt,
 	)
@@ -156,19 +251,32 @@ func (transaction *Transaction) Update(db *sql.DB) (err error) {
 
 	updatedAt := time.Now()
 
-	_, err = tx.Exec(
-		"UPDATE transactions SET description = $1, value = $2, type = $3, updated_at = $4 WHERE id = $5",
+	// only transactions in accounts of the User are updated
+	result, err := tx.Exec(
+		`UPDATE transactions SET description = $1, value = $2, type = $3, date = $4, updated_at = $5
+		WHERE id = $6 AND account_id IN (SELECT id FROM accounts WHERE user_id = $7)`,
 		transaction.Description,
 		transaction.Value,
 		transaction.Type,
+		transaction.Date,
 		updatedAt,
 		transaction.ID,
+		transaction.Account.UserID,
 	)
 	if err != nil {
 		tx.Rollback()
 		return
 	}
 
+	updated, err := result.RowsAffected()
+	if err == nil && updated == 0 {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+
 	err = transaction.DeleteRelatedCategories(db, tx)
 	if err != nil {
 		tx.Rollback()
@@ -187,8 +295,9 @@ func (transaction *Transaction) Update(db *sql.DB) (err error) {
 	}
 
 	err = db.QueryRow(
-		"SELECT name FROM accounts WHERE id = $1",
+		"SELECT name FROM accounts WHERE id = $1 AND user_id = $2",
 		transaction.Account.ID,
+		transaction.Account.UserID,
 	).Scan(&transaction.Account.Name)
 
 	if err != nil {
@@ -211,9 +320,27 @@ func (transaction *Transaction) Delete(db *sql.DB) (err error) {
 	return
 }
 
+// convert fills ConvertedValue using the Rate from currencyName to rateName effective at the transaction date
+func (transaction *Transaction) convert(db *sql.DB, currencyName string, rateName string) (err error) {
+	date, err := time.Parse(dateLayout, transaction.Date)
+	if err != nil {
+		return
+	}
+
+	rate, err := GetRateAt(db, currencyName, rateName, date)
+	if err != nil {
+		return
+	}
+
+	converted := roundMoney(transaction.Value.Mul(rate.Value))
+	transaction.ConvertedValue = &converted
+
+	return
+}
+
 func (transaction *Transaction) GetRelatedCategories(db *sql.DB) (err error) {
 	rows, err := db.Query(
-		"SELECT category_id FROM transactions_categories WHERE transaction_id = $1",
+		"SELECT category_id, amount FROM transactions_categories WHERE transaction_id = $1 ORDER BY category_id",
 		transaction.ID,
 	)
 
@@ -223,41 +350,54 @@ func (transaction *Transaction) GetRelatedCategories(db *sql.DB) (err error) {
 
 	for rows.Next() {
 		var categoryId *int
+		var amount decimal.Decimal
 		var category Category
 
 		errScan := rows.Scan(
 			&categoryId,
+			&amount,
 		)
 		if errScan != nil {
 			return
 		}
 
-		category, errCat := GetCategory(db, *categoryId)
+		category, errCat := GetCategory(db, transaction.Account.UserID, *categoryId)
 		if errCat != nil {
 			return
 		}
 
+		category.Amount = &amount
 		transaction.Categories = append(transaction.Categories, category)
 	}
 
 	return
 }
 
+// CreateRelatedCategories saves the categories with their amounts,
+// without amounts the value is divided evenly, see splitEvenly
 func (transaction *Transaction) CreateRelatedCategories(db *sql.DB, tx *sql.Tx) (err error) {
+	amounts := splitEvenly(transaction.Value, len(transaction.Categories))
+
 	for catIndex, structCategory := range transaction.Categories {
-		category, categoryErr := GetCategory(db, structCategory.ID)
+		// categories of other users are reported as not found
+		category, categoryErr := GetCategory(db, transaction.Account.UserID, structCategory.ID)
 
 		if categoryErr != nil {
 			tx.Rollback()
 			return errors.New(fmt.Sprintf("category %d not found", structCategory.ID))
 		}
 
+		category.Amount = structCategory.Amount
+		if category.Amount == nil {
+			category.Amount = &amounts[catIndex]
+		}
 		transaction.Categories[catIndex] = category
 
 		_, insertErr := tx.Exec(
-			"INSERT INTO transactions_categories(transaction_id, category_id) VALUES($1, $2)",
+			"INSERT INTO transactions_categories(transaction_id, category_id, amount) VALUES($1, $2, $3)",
 			transaction.ID,
 			category.ID,
+			category.Amount,
 		)
 		if insertErr != nil {
 			tx.Rollback()
@@ -283,8 +423,11 @@ func (transaction *Transaction) DeleteRelatedCategories(db *sql.DB, tx *sql.Tx)
 }
 
 func (transaction Transaction) Validate() (err error) {
-	typeCheck := regexp.MustCompile(`INCOME|EXPENSE`)
-	if !typeCheck.MatchString(transaction.Type) {
+	// the legs of a Transfer are saved by it, without this validation
+	typeCheck := regexp.MustCompile(`^(INCOME|EXPENSE)$`)
+	if transaction.Type == "TRANSFER" {
+		err = errors.New("transactions of type 'TRANSFER' must be created through '/transfers'")
+	} else if !typeCheck.MatchString(transaction.Type) {
 		err = errors.New("field 'type' must be 'INCOME' or 'EXPENSE'")
 	}
 
@@ -297,9 +440,70 @@ func (transaction Transaction) Validate() (err error) {
 		err = errors.New("field 'initial_balance' must be like 1.99")
 	}
 
-	if len(transaction.Categories) <= 0 {
+	if transaction.Date != "" {
+		if _, errDate := time.Parse(dateLayout, transaction.Date); errDate != nil {
+			err = errors.New("field 'date' must be like 2019-01-31")
+		}
+	}
+
+	if len(transaction.Categories) <= 0 && transaction.Type != "TRANSFER" {
 		err = errors.New("field 'categories' must not be empty")
 	}
 
+	// the amounts of the categories are all given or none
+	withAmount := 0
+	total := decimal.New(0, 0)
+	for _, category := range transaction.Categories {
+		if category.Amount == nil {
+			continue
+		}
+
+		withAmount++
+		total = total.Add(*category.Amount)
+
+		if category.Amount.LessThanOrEqual(decimal.New(0, 0)) || !valueCheck.MatchString(category.Amount.String()) {
+			err = errors.New("field 'amount' of categories must be more than 0 and like 1.99")
+		}
+	}
+
+	if withAmount > 0 && withAmount != len(transaction.Categories) {
+		err = errors.New("field 'amount' must be given for every category or none")
+	} else if withAmount > 0 && !total.Equal(transaction.Value) {
+		err = errors.New("field 'amount' of categories must add up to 'value'")
+	}
+
 	return
 }
+
+// splitEvenlySQL fills the missing amounts of transactions_categories like splitEvenly,
+// in the order of the category ids
+const splitEvenlySQL = `UPDATE transactions_categories tc SET amount = s.amount
+	FROM (
+		SELECT c.transaction_id, c.category_id,
+		(floor(t.value * 100 / count(*) OVER w)
+			+ CASE WHEN row_number() OVER (w ORDER BY c.category_id) <= (t.value * 100)::bigint % count(*) OVER w THEN 1 ELSE 0 END
+		) / 100 AS amount
+		FROM transactions_categories c
+		INNER JOIN transactions t ON (c.transaction_id = t.id)
+		WINDOW w AS (PARTITION BY c.transaction_id)
+	) s
+	WHERE tc.transaction_id = s.transaction_id AND tc.category_id = s.category_id AND tc.amount IS NULL`
+
+// splitEvenly divides value in parts equal to the cent, the cents left go to the first ones
+func splitEvenly(value decimal.Decimal, parts int) []decimal.Decimal {
+	amounts := make([]decimal.Decimal, parts)
+	if parts == 0 {
+		return amounts
+	}
+
+	cents := value.Shift(2).IntPart()
+	for index := range amounts {
+		part := cents / int64(parts)
+		if int64(index) < cents%int64(parts) {
+			part++
+		}
+		amounts[index] = decimal.New(part, -2)
+	}
+
+	return amounts
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	defaultTransactionsPerPage = 50
+	maxTransactionsPerPage     = 500
+)
+
+// transactionSortColumns maps the accepted 'sort' values to their SQL columns
+var transactionSortColumns = map[string]string{
+	"id":          "t.id",
+	"description": "t.description",
+	"value":       "t.value",
+	"type":        "t.type",
+	"date":        "t.date",
+	"created_at":  "t.created_at",
+}
+
+// TransactionFilter holds the filters, sorting and pagination used to list transactions
+// zero values mean the filter is not applied
+type TransactionFilter struct {
+	From        time.Time
+	To          time.Time
+	Type        string
+	CategoryIDs []int
+	MinValue    *decimal.Decimal
+	MaxValue    *decimal.Decimal
+	Search      string
+	Sort        string
+	Order       string
+	Page        int
+	PerPage     int
+	// RunningBalance adds the balance of the account after each transaction
+	RunningBalance bool
+}
+
+// where builds the WHERE clause and its arguments for the given account
+func (filter TransactionFilter) where(accountID int) (string, []interface{}) {
+	conditions := []string{"t.account_id = $1"}
+	args := []interface{}{accountID}
+
+	addCondition := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if !filter.From.IsZero() {
+		addCondition("t.date >= $%d", filter.From.Format(dateLayout))
+	}
+
+	if !filter.To.IsZero() {
+		addCondition("t.date <= $%d", filter.To.Format(dateLayout))
+	}
+
+	if filter.Type != "" {
+		addCondition("t.type = $%d", filter.Type)
+	}
+
+	if len(filter.CategoryIDs) > 0 {
+		addCondition(
+			`EXISTS (
+				SELECT 1 FROM transactions_categories tc
+				WHERE tc.transaction_id = t.id AND tc.category_id = ANY($%d)
+			)`,
+			pq.Array(filter.CategoryIDs),
+		)
+	}
+
+	if filter.MinValue != nil {
+		addCondition("t.value >= $%d", *filter.MinValue)
+	}
+
+	if filter.MaxValue != nil {
+		addCondition("t.value <= $%d", *filter.MaxValue)
+	}
+
+	if filter.Search != "" {
+		escaper := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+		addCondition("t.description ILIKE $%d", "%"+escaper.Replace(filter.Search)+"%")
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// orderBy builds the ORDER BY clause, the id is always used to break ties
+func (filter TransactionFilter) orderBy() string {
+	column, ok := transactionSortColumns[filter.Sort]
+	if !ok {
+		column = transactionSortColumns["date"]
+	}
+
+	order := "ASC"
+	if strings.ToUpper(filter.Order) == "DESC" {
+		order = "DESC"
+	}
+
+	return fmt.Sprintf("%s %s, t.id %s", column, order, order)
+}
+
+// limitOffset returns the LIMIT and OFFSET values for the current page
+func (filter TransactionFilter) limitOffset() (int, int) {
+	perPage := filter.PerPage
+	if perPage == 0 {
+		perPage = defaultTransactionsPerPage
+	}
+
+	page := filter.Page
+	if page == 0 {
+		page = 1
+	}
+
+	return perPage, (page - 1) * perPage
+}
+
+func (filter TransactionFilter) Validate() (err error) {
+	if filter.Type != "" {
+		typeCheck := regexp.MustCompile(`^(INCOME|EXPENSE|TRANSFER)$`)
+		if !typeCheck.MatchString(filter.Type) {
+			err = errors.New("parameter 'type' must be 'INCOME', 'EXPENSE' or 'TRANSFER'")
+		}
+	}
+
+	if !filter.From.IsZero() && !filter.To.IsZero() && filter.To.Before(filter.From) {
+		err = errors.New("parameter 'to' must not be before 'from'")
+	}
+
+	if filter.MinValue != nil && filter.MaxValue != nil && filter.MaxValue.LessThan(*filter.MinValue) {
+		err = errors.New("parameter 'max' must not be less than 'min'")
+	}
+
+	if _, ok := transactionSortColumns[filter.Sort]; filter.Sort != "" && !ok {
+		err = fmt.Errorf("parameter 'sort' must be one of %s", strings.Join(transactionSortNames(), ", "))
+	}
+
+	order := strings.ToUpper(filter.Order)
+	if order != "" && order != "ASC" && order != "DESC" {
+		err = errors.New("parameter 'order' must be 'asc' or 'desc'")
+	}
+
+	if filter.Page < 0 {
+		err = errors.New("parameter 'page' must be more than 0")
+	}
+
+	if filter.PerPage < 0 || filter.PerPage > maxTransactionsPerPage {
+		err = fmt.Errorf("parameter 'per_page' must be between 1 and %d", maxTransactionsPerPage)
+	}
+
+	return
+}
+
+func transactionSortNames() []string {
+	names := []string{}
+	for name := range transactionSortColumns {
+		names = append(names, "'"+name+"'")
+	}
+	sort.Strings(names)
+
+	return names
+}
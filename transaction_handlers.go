@@ -3,41 +3,234 @@ package main
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/shopspring/decimal"
 )
 
 func (s *Server) ListTransactions(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	accountID, _ := strconv.Atoi(vars["account_id"])
+	user := currentUser(r)
 
-	transactions, err := ListTransactions(s.db, accountID)
+	_, err := GetAccount(s.db, user.ID, accountID, "")
+	if err == sql.ErrNoRows {
+		respondWithError(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	filter, err := parseTransactionFilter(r)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = validateRequest(filter)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
+	total, err := CountTransactions(s.db, accountID, filter)
 	if err != nil {
 		respondWithError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	transactions, err := ListTransactions(s.db, accountID, filter)
+
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rateName := strings.ToUpper(r.URL.Query().Get("rate"))
+	if rateName != "" {
+		err = convertTransactions(s.db, user.ID, accountID, rateName, transactions)
+		if err != nil {
+			respondWithError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	setPaginationHeaders(w, r, filter, total)
 	respondWithJSON(w, transactions, http.StatusOK)
 	return
 }
 
+// convertTransactions converts the values of the account transactions to rateName,
+// using the Rate effective at each transaction date
+func convertTransactions(db *sql.DB, userID int, accountID int, rateName string, transactions []Transaction) (err error) {
+	account, err := GetAccount(db, userID, accountID, "")
+	if err != nil {
+		return
+	}
+
+	for index := range transactions {
+		err = transactions[index].convert(db, account.Currency.Name, rateName)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// parseTransactionFilter reads the filters, sorting and pagination from the query string
+func parseTransactionFilter(r *http.Request) (filter TransactionFilter, err error) {
+	query := r.URL.Query()
+
+	if from := query.Get("from"); from != "" {
+		filter.From, err = time.Parse(dateLayout, from)
+		if err != nil {
+			return filter, fmt.Errorf("parameter 'from' must be like %s", dateLayout)
+		}
+	}
+
+	if to := query.Get("to"); to != "" {
+		filter.To, err = time.Parse(dateLayout, to)
+		if err != nil {
+			return filter, fmt.Errorf("parameter 'to' must be like %s", dateLayout)
+		}
+	}
+
+	filter.Type = strings.ToUpper(query.Get("type"))
+
+	// categories can be passed as ?category=1&category=2 or ?category=1,2
+	for _, param := range query["category"] {
+		for _, value := range strings.Split(param, ",") {
+			categoryID, errAtoi := strconv.Atoi(strings.TrimSpace(value))
+			if errAtoi != nil {
+				return filter, errors.New("parameter 'category' must be a list of ids")
+			}
+			filter.CategoryIDs = append(filter.CategoryIDs, categoryID)
+		}
+	}
+
+	if min := query.Get("min"); min != "" {
+		minValue, errDecimal := decimal.NewFromString(min)
+		if errDecimal != nil {
+			return filter, errors.New("parameter 'min' must be like 1.99")
+		}
+		filter.MinValue = &minValue
+	}
+
+	if max := query.Get("max"); max != "" {
+		maxValue, errDecimal := decimal.NewFromString(max)
+		if errDecimal != nil {
+			return filter, errors.New("parameter 'max' must be like 1.99")
+		}
+		filter.MaxValue = &maxValue
+	}
+
+	filter.Search = query.Get("q")
+	filter.Sort = query.Get("sort")
+	filter.Order = query.Get("order")
+
+	if page := query.Get("page"); page != "" {
+		filter.Page, err = strconv.Atoi(page)
+		if err != nil || filter.Page < 1 {
+			return filter, errors.New("parameter 'page' must be more than 0")
+		}
+	}
+
+	if value := query.Get("running_balance"); value != "" {
+		filter.RunningBalance, err = strconv.ParseBool(value)
+		if err != nil {
+			return filter, errors.New("parameter 'running_balance' must be 'true' or 'false'")
+		}
+	}
+
+	if perPage := query.Get("per_page"); perPage != "" {
+		filter.PerPage, err = strconv.Atoi(perPage)
+		if err != nil || filter.PerPage < 1 {
+			return filter, fmt.Errorf("parameter 'per_page' must be between 1 and %d", maxTransactionsPerPage)
+		}
+	}
+
+	return filter, nil
+}
+
+// setPaginationHeaders sets the X-Total-Count and the Link headers, as described in RFC 5988
+func setPaginationHeaders(w http.ResponseWriter, r *http.Request, filter TransactionFilter, total int) {
+	perPage, offset := filter.limitOffset()
+	page := offset/perPage + 1
+	lastPage := (total + perPage - 1) / perPage
+	if lastPage < 1 {
+		lastPage = 1
+	}
+
+	pageURL := func(page int) string {
+		u := *r.URL
+		query := u.Query()
+		query.Set("page", strconv.Itoa(page))
+		query.Set("per_page", strconv.Itoa(perPage))
+		u.RawQuery = query.Encode()
+		return u.RequestURI()
+	}
+
+	links := []string{
+		fmt.Sprintf(`<%s>; rel="first"`, pageURL(1)),
+	}
+
+	if page > 1 {
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, pageURL(page-1)))
+	}
+
+	if page < lastPage {
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, pageURL(page+1)))
+	}
+
+	links = append(links, fmt.Sprintf(`<%s>; rel="last"`, pageURL(lastPage)))
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	w.Header().Set("Link", strings.Join(links, ", "))
+}
+
 func (s *Server) CreateTransaction(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	accountID, _ := strconv.Atoi(vars["account_id"])
+	user := currentUser(r)
 
 	var transaction Transaction
 	json.NewDecoder(r.Body).Decode(&transaction)
+	transaction.TransferID = 0
+	transaction.Account.ID = accountID
+
+	// without categories, the ones of the first matching rule are used
+	err := applyRules(s.db, user.ID, &transaction)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-	err := validateRequest(transaction)
+	err = validateRequest(transaction)
 	if err != nil {
 		respondWithError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	transaction.Account.ID = accountID
+	transaction.Account, err = GetAccount(s.db, user.ID, accountID, "")
+	if err == sql.ErrNoRows {
+		respondWithError(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	err = transaction.Create(s.db)
 
@@ -53,8 +246,9 @@ func (s *Server) CreateTransaction(w http.ResponseWriter, r *http.Request) {
 func (s *Server) GetTransaction(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	transactionID, _ := strconv.Atoi(vars["id"])
+	user := currentUser(r)
 
-	transaction, err := GetTransaction(s.db, transactionID)
+	transaction, err := GetTransaction(s.db, user.ID, transactionID)
 
 	if err == sql.ErrNoRows {
 		respondWithError(w, "not found", http.StatusNotFound)
@@ -66,6 +260,19 @@ func (s *Server) GetTransaction(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	rateName := strings.ToUpper(r.URL.Query().Get("rate"))
+	if rateName != "" {
+		// converted from the currency of its own account, whatever the account in the URL
+		transactions := []Transaction{transaction}
+
+		err = convertTransactions(s.db, user.ID, transaction.Account.ID, rateName, transactions)
+		if err != nil {
+			respondWithError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		transaction = transactions[0]
+	}
+
 	respondWithJSON(w, transaction, http.StatusOK)
 	return
 }
@@ -74,15 +281,60 @@ func (s *Server) UpdateTransaction(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	accountID, _ := strconv.Atoi(vars["account_id"])
 	transactionID, _ := strconv.Atoi(vars["id"])
-	transaction, err := GetTransaction(s.db, transactionID)
-	transaction.Account.ID = accountID
+	user := currentUser(r)
+	transaction, err := GetTransaction(s.db, user.ID, transactionID)
+
+	if err == sql.ErrNoRows {
+		respondWithError(w, "not found", http.StatusNotFound)
+		return
+	}
 
 	if err != nil {
 		respondWithError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	// accounts of other users are reported as not found
+	_, err = GetAccount(s.db, user.ID, accountID, "")
+	if err == sql.ErrNoRows {
+		respondWithError(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if transaction.TransferID != 0 {
+		respondWithError(w, fmt.Sprintf("transaction belongs to transfer %d, update it through '/transfers'", transaction.TransferID), http.StatusBadRequest)
+		return
+	}
+
+	// without categories in the body the saved ones are kept,
+	// a new value drops their amounts and is divided evenly between them
+	categories := transaction.Categories
+	value := transaction.Value
+	date := transaction.Date
+	transaction.Categories = nil
 	json.NewDecoder(r.Body).Decode(&transaction)
+	transaction.ID = transactionID
+	transaction.Account.ID = accountID
+	transaction.TransferID = 0
+
+	// an empty date keeps the saved one, like on create where it defaults to today
+	if transaction.Date == "" {
+		transaction.Date = date
+	}
+
+	if transaction.Categories == nil {
+		transaction.Categories = categories
+		if !transaction.Value.Equal(value) {
+			for index := range transaction.Categories {
+				transaction.Categories[index].Amount = nil
+			}
+		}
+	}
 
 	err = validateRequest(transaction)
 	if err != nil {
@@ -103,14 +355,25 @@ func (s *Server) UpdateTransaction(w http.ResponseWriter, r *http.Request) {
 func (s *Server) DeleteTransaction(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	transactionID, _ := strconv.Atoi(vars["id"])
-	transaction, err := GetTransaction(s.db, transactionID)
+	transaction, err := GetTransaction(s.db, currentUser(r).ID, transactionID)
+
+	if err == sql.ErrNoRows {
+		respondWithError(w, "not found", http.StatusNotFound)
+		return
+	}
 
 	if err != nil {
 		respondWithError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	err = transaction.Delete(s.db)
+	// deleting one leg of a transfer deletes the whole transfer
+	if transaction.TransferID != 0 {
+		transfer := Transfer{ID: transaction.TransferID}
+		err = transfer.Delete(s.db)
+	} else {
+		err = transaction.Delete(s.db)
+	}
 
 	if err != nil {
 		respondWithError(w, err.Error(), http.StatusBadRequest)
@@ -19,6 +19,7 @@ func TestEmptyListTransactions(t *testing.T) {
 	}
 	currency.Create(s.db)
 	account := Account{
+		UserID:         testUser.ID,
 		Currency:       currency,
 		Name:           "My Wallet",
 		InitialBalance: Decimal("100.00"),
@@ -38,13 +39,15 @@ func TestListTransactions(t *testing.T) {
 	}
 	currency.Create(s.db)
 	account := Account{
+		UserID:         testUser.ID,
 		Currency:       currency,
 		Name:           "My Wallet",
 		InitialBalance: Decimal("100.00"),
 	}
 	account.Create(s.db)
 	category := Category{
-		Name: "Category",
+		UserID: testUser.ID,
+		Name:   "Category",
 	}
 	category.Create(s.db)
 	transaction := Transaction{
@@ -77,17 +80,20 @@ func TestCreateTransactionValidCategories(t *testing.T) {
 	}
 	currency.Create(s.db)
 	account := Account{
+		UserID:         testUser.ID,
 		Currency:       currency,
 		Name:           "My Wallet",
 		InitialBalance: Decimal("100.00"),
 	}
 	account.Create(s.db)
 	categoryOne := Category{
-		Name: "Category One",
+		UserID: testUser.ID,
+		Name:   "Category One",
 	}
 	categoryOne.Create(s.db)
 	categoryTwo := Category{
-		Name: "Category Two",
+		UserID: testUser.ID,
+		Name:   "Category Two",
 	}
 	categoryTwo.Create(s.db)
 
@@ -116,13 +122,15 @@ func TestCreateTransactionInvalidCategories(t *testing.T) {
 	}
 	currency.Create(s.db)
 	account := Account{
+		UserID:         testUser.ID,
 		Currency:       currency,
 		Name:           "My Wallet",
 		InitialBalance: Decimal("100.00"),
 	}
 	account.Create(s.db)
 	categoryOne := Category{
-		Name: "Category One",
+		UserID: testUser.ID,
+		Name:   "Category One",
 	}
 	categoryOne.Create(s.db)
 
@@ -137,7 +145,7 @@ func TestCreateTransactionInvalidCategories(t *testing.T) {
 
 	assert.Equal(t, err.Error, "category 3213 not found")
 
-	_, errTransaction := GetTransaction(s.db, 1)
+	_, errTransaction := GetTransaction(s.db, testUser.ID, 1)
 	assert.NotNil(t, errTransaction)
 }
 
@@ -149,6 +157,7 @@ func TestCreateTransactionEmptyCategories(t *testing.T) {
 	}
 	currency.Create(s.db)
 	account := Account{
+		UserID:         testUser.ID,
 		Currency:       currency,
 		Name:           "My Wallet",
 		InitialBalance: Decimal("100.00"),
@@ -166,7 +175,7 @@ func TestCreateTransactionEmptyCategories(t *testing.T) {
 
 	assert.Equal(t, err.Error, "field 'categories' must not be empty")
 
-	_, errTransaction := GetTransaction(s.db, 1)
+	_, errTransaction := GetTransaction(s.db, testUser.ID, 1)
 	assert.NotNil(t, errTransaction)
 }
 
@@ -178,13 +187,15 @@ func TestGetTransaction(t *testing.T) {
 	}
 	currency.Create(s.db)
 	account := Account{
+		UserID:         testUser.ID,
 		Currency:       currency,
 		Name:           "My Wallet",
 		InitialBalance: Decimal("100.00"),
 	}
 	account.Create(s.db)
 	category := Category{
-		Name: "Category",
+		UserID: testUser.ID,
+		Name:   "Category",
 	}
 	category.Create(s.db)
 	transaction := Transaction{
@@ -218,6 +229,7 @@ func TestGetInexistentTransaction(t *testing.T) {
 	}
 	currency.Create(s.db)
 	account := Account{
+		UserID:         testUser.ID,
 		Currency:       currency,
 		Name:           "My Wallet",
 		InitialBalance: Decimal("100.00"),
@@ -241,13 +253,15 @@ func TestUpdateTransactionValidCategories(t *testing.T) {
 	}
 	currency.Create(s.db)
 	account := Account{
+		UserID:         testUser.ID,
 		Currency:       currency,
 		Name:           "My Wallet",
 		InitialBalance: Decimal("100.00"),
 	}
 	account.Create(s.db)
 	categoryOne := Category{
-		Name: "Category One",
+		UserID: testUser.ID,
+		Name:   "Category One",
 	}
 	categoryOne.Create(s.db)
 	transaction := Transaction{
@@ -259,13 +273,15 @@ func TestUpdateTransactionValidCategories(t *testing.T) {
 	}
 	transaction.Create(s.db)
 	accountCash := Account{
+		UserID:         testUser.ID,
 		Currency:       currency,
 		Name:           "Cash",
 		InitialBalance: Decimal("100.00"),
 	}
 	accountCash.Create(s.db)
 	categoryTwo := Category{
-		Name: "Category Two",
+		UserID: testUser.ID,
+		Name:   "Category Two",
 	}
 	categoryTwo.Create(s.db)
 
@@ -291,13 +307,15 @@ func TestUpdateTransactionInvalidCategories(t *testing.T) {
 	}
 	currency.Create(s.db)
 	account := Account{
+		UserID:         testUser.ID,
 		Currency:       currency,
 		Name:           "My Wallet",
 		InitialBalance: Decimal("100.00"),
 	}
 	account.Create(s.db)
 	categoryOne := Category{
-		Name: "Category One",
+		UserID: testUser.ID,
+		Name:   "Category One",
 	}
 	categoryOne.Create(s.db)
 	transaction := Transaction{
@@ -327,13 +345,15 @@ func TestUpdateTransactionEmptyCategories(t *testing.T) {
 	}
 	currency.Create(s.db)
 	account := Account{
+		UserID:         testUser.ID,
 		Currency:       currency,
 		Name:           "My Wallet",
 		InitialBalance: Decimal("100.00"),
 	}
 	account.Create(s.db)
 	categoryOne := Category{
-		Name: "Category One",
+		UserID: testUser.ID,
+		Name:   "Category One",
 	}
 	categoryOne.Create(s.db)
 	transaction := Transaction{
@@ -364,17 +384,20 @@ func TestUpdateTransactionDifferentCategory(t *testing.T) {
 	}
 	currency.Create(s.db)
 	account := Account{
+		UserID:         testUser.ID,
 		Currency:       currency,
 		Name:           "My Wallet",
 		InitialBalance: Decimal("100.00"),
 	}
 	account.Create(s.db)
 	categoryOne := Category{
-		Name: "Category One",
+		UserID: testUser.ID,
+		Name:   "Category One",
 	}
 	categoryOne.Create(s.db)
 	categoryTwo := Category{
-		Name: "Category Two",
+		UserID: testUser.ID,
+		Name:   "Category Two",
 	}
 	categoryTwo.Create(s.db)
 	transaction := Transaction{
@@ -405,13 +428,15 @@ func TestDeleteTransaction(t *testing.T) {
 	}
 	currency.Create(s.db)
 	account := Account{
+		UserID:         testUser.ID,
 		Currency:       currency,
 		Name:           "My Wallet",
 		InitialBalance: Decimal("100.00"),
 	}
 	account.Create(s.db)
 	category := Category{
-		Name: "Category",
+		UserID: testUser.ID,
+		Name:   "Category",
 	}
 	category.Create(s.db)
 	transaction := Transaction{
@@ -435,13 +460,15 @@ func TestValidateTransactionType(t *testing.T) {
 	}
 	currency.Create(s.db)
 	account := Account{
+		UserID:         testUser.ID,
 		Currency:       currency,
 		Name:           "My Wallet",
 		InitialBalance: Decimal("100.00"),
 	}
 	account.Create(s.db)
 	categoryOne := Category{
-		Name: "Category One",
+		UserID: testUser.ID,
+		Name:   "Category One",
 	}
 	categoryOne.Create(s.db)
 
@@ -463,13 +490,15 @@ func TestValidateTransactionValue(t *testing.T) {
 	}
 	currency.Create(s.db)
 	account := Account{
+		UserID:         testUser.ID,
 		Currency:       currency,
 		Name:           "My Wallet",
 		InitialBalance: Decimal("100.00"),
 	}
 	account.Create(s.db)
 	categoryOne := Category{
-		Name: "Category One",
+		UserID: testUser.ID,
+		Name:   "Category One",
 	}
 	categoryOne.Create(s.db)
 
@@ -482,3 +511,548 @@ func TestValidateTransactionValue(t *testing.T) {
 
 	assert.Equal(t, err.Error, "field 'value' must be more than 0")
 }
+
+func TestListTransactionsFilterAndSort(t *testing.T) {
+	ClearDB(s.db)
+
+	currency := Currency{
+		Name: "USD",
+	}
+	currency.Create(s.db)
+	account := Account{
+		UserID:         testUser.ID,
+		Currency:       currency,
+		Name:           "My Wallet",
+		InitialBalance: Decimal("100.00"),
+	}
+	account.Create(s.db)
+	category := Category{
+		UserID: testUser.ID,
+		Name:   "Category",
+	}
+	category.Create(s.db)
+
+	for _, transaction := range []Transaction{
+		{Description: "Salary", Value: Decimal("1000.00"), Type: "INCOME"},
+		{Description: "Groceries", Value: Decimal("50.00"), Type: "EXPENSE"},
+		{Description: "Restaurant", Value: Decimal("80.00"), Type: "EXPENSE"},
+	} {
+		transaction.Account = account
+		transaction.Categories = []Category{category}
+		transaction.Create(s.db)
+	}
+
+	response := Request(s.router, "GET", fmt.Sprintf("/accounts/%d/transactions?type=expense&sort=value&order=desc", account.ID), nil)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, response.Header().Get("X-Total-Count"), "2")
+
+	var respTransactions []Transaction
+	json.Unmarshal(response.Body.Bytes(), &respTransactions)
+
+	assert.Equal(t, len(respTransactions), 2)
+	assert.Equal(t, respTransactions[0].Description, "Restaurant")
+	assert.Equal(t, respTransactions[1].Description, "Groceries")
+
+	response = Request(s.router, "GET", fmt.Sprintf("/accounts/%d/transactions?q=sal&min=100", account.ID), nil)
+	respTransactions = []Transaction{}
+	json.Unmarshal(response.Body.Bytes(), &respTransactions)
+
+	assert.Equal(t, len(respTransactions), 1)
+	assert.Equal(t, respTransactions[0].Description, "Salary")
+}
+
+func TestListTransactionsPagination(t *testing.T) {
+	ClearDB(s.db)
+
+	currency := Currency{
+		Name: "USD",
+	}
+	currency.Create(s.db)
+	account := Account{
+		UserID:         testUser.ID,
+		Currency:       currency,
+		Name:           "My Wallet",
+		InitialBalance: Decimal("100.00"),
+	}
+	account.Create(s.db)
+	category := Category{
+		UserID: testUser.ID,
+		Name:   "Category",
+	}
+	category.Create(s.db)
+
+	for i := 0; i < 3; i++ {
+		transaction := Transaction{
+			Account:     account,
+			Description: fmt.Sprintf("Transaction %d", i),
+			Value:       Decimal("1.00"),
+			Type:        "INCOME",
+			Categories:  []Category{category},
+		}
+		transaction.Create(s.db)
+	}
+
+	response := Request(s.router, "GET", fmt.Sprintf("/accounts/%d/transactions?sort=id&page=2&per_page=2", account.ID), nil)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, response.Header().Get("X-Total-Count"), "3")
+	assert.Contains(t, response.Header().Get("Link"), `rel="prev"`)
+	assert.NotContains(t, response.Header().Get("Link"), `rel="next"`)
+
+	var respTransactions []Transaction
+	json.Unmarshal(response.Body.Bytes(), &respTransactions)
+
+	assert.Equal(t, len(respTransactions), 1)
+	assert.Equal(t, respTransactions[0].Description, "Transaction 2")
+}
+
+func TestValidateListTransactionsSort(t *testing.T) {
+	ClearDB(s.db)
+
+	response := Request(s.router, "GET", "/accounts/1/transactions?sort=what", nil)
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+
+	var err CustomError
+	json.Unmarshal(response.Body.Bytes(), &err)
+
+	assert.Equal(t, err.Error, "parameter 'sort' must be one of 'created_at', 'date', 'description', 'id', 'type', 'value'")
+}
+
+func TestCreateTransactionWithDate(t *testing.T) {
+	ClearDB(s.db)
+
+	currency := Currency{
+		Name: "USD",
+	}
+	currency.Create(s.db)
+	account := Account{
+		UserID:         testUser.ID,
+		Currency:       currency,
+		Name:           "My Wallet",
+		InitialBalance: Decimal("100.00"),
+	}
+	account.Create(s.db)
+	category := Category{
+		UserID: testUser.ID,
+		Name:   "Category",
+	}
+	category.Create(s.db)
+	today := Transaction{
+		Account:     account,
+		Description: "Today",
+		Value:       Decimal("1.00"),
+		Type:        "EXPENSE",
+		Categories:  []Category{category},
+	}
+	today.Create(s.db)
+
+	body := []byte(
+		fmt.Sprintf(`{"description": "Last Month", "value": 0.99, "type": "EXPENSE", "date": "2019-01-15", "categories": [{"id": %d}]}`, category.ID),
+	)
+	response := Request(s.router, "POST", fmt.Sprintf("/accounts/%d/transactions", account.ID), bytes.NewBuffer(body))
+	assert.Equal(t, http.StatusCreated, response.Code)
+
+	var respTransaction Transaction
+	json.Unmarshal(response.Body.Bytes(), &respTransaction)
+
+	assert.Equal(t, respTransaction.Date, "2019-01-15")
+
+	response = Request(s.router, "GET", fmt.Sprintf("/accounts/%d/transactions?from=2019-01-01&to=2019-01-31", account.ID), nil)
+
+	var respTransactions []Transaction
+	json.Unmarshal(response.Body.Bytes(), &respTransactions)
+
+	assert.Equal(t, len(respTransactions), 1)
+	assert.Equal(t, respTransactions[0].Description, "Last Month")
+	assert.Equal(t, respTransactions[0].Date, "2019-01-15")
+}
+
+func TestValidateTransactionDate(t *testing.T) {
+	ClearDB(s.db)
+
+	body := []byte(`{"description": "My Transaction", "value": 0.99, "type": "EXPENSE", "date": "15/01/2019", "categories": [{"id": 1}]}`)
+	response := Request(s.router, "POST", "/accounts/1/transactions", bytes.NewBuffer(body))
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+
+	var err CustomError
+	json.Unmarshal(response.Body.Bytes(), &err)
+
+	assert.Equal(t, err.Error, "field 'date' must be like 2019-01-31")
+}
+
+func TestListTransactionsConvertedAtDate(t *testing.T) {
+	ClearDB(s.db)
+
+	currency := Currency{
+		Name: "USD",
+	}
+	currency.Create(s.db)
+	s.db.Exec(
+		`INSERT INTO rates(currency_name, name, symbol, value, created_at, updated_at)
+		VALUES ('USD', 'BRL', 'R$', 3.00, '2019-01-01', '2019-01-01'), ('USD', 'BRL', 'R$', 4.00, '2019-02-01', '2019-02-01')`,
+	)
+	account := Account{
+		UserID:         testUser.ID,
+		Currency:       currency,
+		Name:           "My Wallet",
+		InitialBalance: Decimal("100.00"),
+	}
+	account.Create(s.db)
+	category := Category{
+		UserID: testUser.ID,
+		Name:   "Category",
+	}
+	category.Create(s.db)
+	transaction := Transaction{
+		Account:     account,
+		Description: "January",
+		Value:       Decimal("10.00"),
+		Type:        "EXPENSE",
+		Date:        "2019-01-15",
+		Categories:  []Category{category},
+	}
+	transaction.Create(s.db)
+
+	response := Request(s.router, "GET", fmt.Sprintf("/accounts/%d/transactions?rate=brl", account.ID), nil)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	var respTransactions []Transaction
+	json.Unmarshal(response.Body.Bytes(), &respTransactions)
+
+	assert.Equal(t, respTransactions[0].ConvertedValue.String(), "30")
+
+	// under the URL of an account in another currency it's still converted from USD
+	brl := Currency{
+		Name: "BRL",
+	}
+	brl.Create(s.db)
+	carteira := Account{
+		UserID:         testUser.ID,
+		Currency:       brl,
+		Name:           "Carteira",
+		InitialBalance: Decimal("0.00"),
+	}
+	carteira.Create(s.db)
+
+	response = Request(s.router, "GET", fmt.Sprintf("/accounts/%d/transactions/%d?rate=brl", carteira.ID, transaction.ID), nil)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	var respTransaction Transaction
+	json.Unmarshal(response.Body.Bytes(), &respTransaction)
+
+	assert.Equal(t, respTransaction.ConvertedValue.String(), "30")
+}
+
+func TestListTransactionsConvertedWithSmallRate(t *testing.T) {
+	ClearDB(s.db)
+
+	currency := Currency{
+		Name:  "JPY",
+		Rates: []Rate{{Name: "USD", Symbol: "$", Value: Decimal("0.0067123456")}},
+	}
+	currency.Create(s.db)
+	account := Account{
+		UserID:         testUser.ID,
+		Currency:       currency,
+		Name:           "Saifu",
+		InitialBalance: Decimal("0.00"),
+	}
+	account.Create(s.db)
+	category := Category{
+		UserID: testUser.ID,
+		Name:   "Category",
+	}
+	category.Create(s.db)
+	transaction := Transaction{
+		Account:     account,
+		Description: "Ramen",
+		Value:       Decimal("10000.00"),
+		Type:        "EXPENSE",
+		Categories:  []Category{category},
+	}
+	transaction.Create(s.db)
+
+	response := Request(s.router, "GET", fmt.Sprintf("/accounts/%d/transactions?rate=usd", account.ID), nil)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	var respTransactions []Transaction
+	json.Unmarshal(response.Body.Bytes(), &respTransactions)
+
+	assert.Equal(t, respTransactions[0].ConvertedValue.String(), "67.12")
+}
+
+func TestListTransactionsRunningBalance(t *testing.T) {
+	ClearDB(s.db)
+
+	currency := Currency{
+		Name: "USD",
+	}
+	currency.Create(s.db)
+	account := Account{
+		UserID:         testUser.ID,
+		Currency:       currency,
+		Name:           "My Wallet",
+		InitialBalance: Decimal("100.00"),
+	}
+	account.Create(s.db)
+	category := Category{
+		UserID: testUser.ID,
+		Name:   "Category",
+	}
+	category.Create(s.db)
+
+	for _, transaction := range []Transaction{
+		{Description: "Restaurant", Value: Decimal("80.00"), Type: "EXPENSE", Date: "2019-01-10"},
+		{Description: "Salary", Value: Decimal("1000.00"), Type: "INCOME", Date: "2019-01-05"},
+		{Description: "Groceries", Value: Decimal("50.00"), Type: "EXPENSE", Date: "2019-01-10"},
+	} {
+		transaction.Account = account
+		transaction.Categories = []Category{category}
+		transaction.Create(s.db)
+	}
+
+	// the balance counts every transaction before, even the ones filtered out
+	response := Request(s.router, "GET", fmt.Sprintf("/accounts/%d/transactions?type=expense&running_balance=true", account.ID), nil)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	var respTransactions []Transaction
+	json.Unmarshal(response.Body.Bytes(), &respTransactions)
+
+	assert.Equal(t, len(respTransactions), 2)
+	assert.Equal(t, respTransactions[0].Description, "Restaurant")
+	assert.Equal(t, respTransactions[0].RunningBalance.String(), "1020")
+	assert.Equal(t, respTransactions[1].Description, "Groceries")
+	assert.Equal(t, respTransactions[1].RunningBalance.String(), "970")
+
+	fetched, _ := GetAccount(s.db, testUser.ID, account.ID, "")
+	assert.Equal(t, respTransactions[1].RunningBalance.String(), fetched.Balance.String())
+
+	response = Request(s.router, "GET", fmt.Sprintf("/accounts/%d/transactions", account.ID), nil)
+	assert.NotContains(t, response.Body.String(), "running_balance")
+}
+
+func TestSplitEvenly(t *testing.T) {
+	amounts := splitEvenly(Decimal("10.00"), 3)
+
+	assert.Equal(t, "3.34", amounts[0].StringFixed(2))
+	assert.Equal(t, "3.33", amounts[1].StringFixed(2))
+	assert.Equal(t, "3.33", amounts[2].StringFixed(2))
+	assert.Equal(t, 0, len(splitEvenly(Decimal("10.00"), 0)))
+}
+
+func TestCreateTransactionSplitCategories(t *testing.T) {
+	ClearDB(s.db)
+
+	currency := Currency{
+		Name: "USD",
+	}
+	currency.Create(s.db)
+	account := Account{
+		UserID:         testUser.ID,
+		Currency:       currency,
+		Name:           "My Wallet",
+		InitialBalance: Decimal("100.00"),
+	}
+	account.Create(s.db)
+	groceries := Category{
+		UserID: testUser.ID,
+		Name:   "Groceries",
+	}
+	groceries.Create(s.db)
+	household := Category{
+		UserID: testUser.ID,
+		Name:   "Household",
+	}
+	household.Create(s.db)
+
+	requests := map[string]string{
+		`{"amount": 35.00}, {"id": %d}`:                    "field 'amount' must be given for every category or none",
+		`{"amount": 35.00}, {"id": %d, "amount": 10}`:      "field 'amount' of categories must add up to 'value'",
+		`{"amount": 50.00}, {"id": %d, "amount": 0}`:       "field 'amount' of categories must be more than 0 and like 1.99",
+		`{"amount": 34.999}, {"id": %d, "amount": 15.001}`: "field 'amount' of categories must be more than 0 and like 1.99",
+	}
+
+	for categories, message := range requests {
+		body := []byte(fmt.Sprintf(`{"description": "Supermarket", "value": 50.00, "type": "EXPENSE", "categories": [{"id": %d, `+categories+`]}`, groceries.ID, household.ID))
+		response := Request(s.router, "POST", fmt.Sprintf("/accounts/%d/transactions", account.ID), bytes.NewBuffer(body))
+		assert.Equal(t, http.StatusBadRequest, response.Code, categories)
+
+		var err CustomError
+		json.Unmarshal(response.Body.Bytes(), &err)
+		assert.Equal(t, err.Error, message, categories)
+	}
+
+	body := []byte(fmt.Sprintf(`{"description": "Supermarket", "value": 50.00, "type": "EXPENSE", "categories": [{"id": %d, "amount": 35.00}, {"id": %d, "amount": 15.00}]}`, groceries.ID, household.ID))
+	response := Request(s.router, "POST", fmt.Sprintf("/accounts/%d/transactions", account.ID), bytes.NewBuffer(body))
+	assert.Equal(t, http.StatusCreated, response.Code)
+
+	var respTransaction Transaction
+	json.Unmarshal(response.Body.Bytes(), &respTransaction)
+	assert.Equal(t, "35", respTransaction.Categories[0].Amount.String())
+	assert.Equal(t, "15", respTransaction.Categories[1].Amount.String())
+
+	transaction, _ := GetTransaction(s.db, testUser.ID, respTransaction.ID)
+	assert.Equal(t, "35", transaction.Categories[0].Amount.String())
+	assert.Equal(t, "15", transaction.Categories[1].Amount.String())
+
+	// the amounts are kept while the value is the same
+	body = []byte(`{"description": "Supermarket and pharmacy"}`)
+	response = Request(s.router, "PATCH", fmt.Sprintf("/accounts/%d/transactions/%d", account.ID, transaction.ID), bytes.NewBuffer(body))
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	transaction, _ = GetTransaction(s.db, testUser.ID, transaction.ID)
+	assert.Equal(t, "35", transaction.Categories[0].Amount.String())
+	assert.Equal(t, "15", transaction.Categories[1].Amount.String())
+
+	// a new value without categories drops the amounts and is divided evenly
+	body = []byte(`{"value": 60.00}`)
+	response = Request(s.router, "PATCH", fmt.Sprintf("/accounts/%d/transactions/%d", account.ID, transaction.ID), bytes.NewBuffer(body))
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	transaction, _ = GetTransaction(s.db, testUser.ID, transaction.ID)
+	assert.Equal(t, "30", transaction.Categories[0].Amount.String())
+	assert.Equal(t, "30", transaction.Categories[1].Amount.String())
+
+	// without amounts the value is divided evenly
+	body = []byte(fmt.Sprintf(`{"value": 60.01, "categories": [{"id": %d}, {"id": %d}]}`, groceries.ID, household.ID))
+	response = Request(s.router, "PATCH", fmt.Sprintf("/accounts/%d/transactions/%d", account.ID, transaction.ID), bytes.NewBuffer(body))
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	transaction, _ = GetTransaction(s.db, testUser.ID, transaction.ID)
+	assert.Equal(t, "30.01", transaction.Categories[0].Amount.String())
+	assert.Equal(t, "30", transaction.Categories[1].Amount.String())
+}
+
+func TestUpdateTransactionValueSingleCategory(t *testing.T) {
+	ClearDB(s.db)
+
+	currency := Currency{
+		Name: "USD",
+	}
+	currency.Create(s.db)
+	account := Account{
+		UserID:         testUser.ID,
+		Currency:       currency,
+		Name:           "My Wallet",
+		InitialBalance: Decimal("100.00"),
+	}
+	account.Create(s.db)
+	categoryOne := Category{
+		UserID: testUser.ID,
+		Name:   "Category One",
+	}
+	categoryOne.Create(s.db)
+	transaction := Transaction{
+		Account:     account,
+		Description: "My Transaction",
+		Value:       Decimal("0.99"),
+		Type:        "INCOME",
+		Categories:  []Category{categoryOne},
+	}
+	transaction.Create(s.db)
+
+	// the amount of the only category follows the value
+	body := []byte(`{"value": 1.99}`)
+	response := Request(s.router, "PATCH", fmt.Sprintf("/accounts/%d/transactions/%d", account.ID, transaction.ID), bytes.NewBuffer(body))
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	var respTransaction Transaction
+	json.Unmarshal(response.Body.Bytes(), &respTransaction)
+	assert.Equal(t, categoryOne.ID, respTransaction.Categories[0].ID)
+	assert.Equal(t, "1.99", respTransaction.Categories[0].Amount.String())
+}
+
+func TestUpdateTransactionEmptyDate(t *testing.T) {
+	ClearDB(s.db)
+
+	currency := Currency{
+		Name: "USD",
+	}
+	currency.Create(s.db)
+	account := Account{
+		UserID:         testUser.ID,
+		Currency:       currency,
+		Name:           "My Wallet",
+		InitialBalance: Decimal("100.00"),
+	}
+	account.Create(s.db)
+	category := Category{
+		UserID: testUser.ID,
+		Name:   "Category",
+	}
+	category.Create(s.db)
+	transaction := Transaction{
+		Account:     account,
+		Description: "My Transaction",
+		Value:       Decimal("0.99"),
+		Type:        "EXPENSE",
+		Date:        "2019-01-15",
+		Categories:  []Category{category},
+	}
+	transaction.Create(s.db)
+
+	// an empty date keeps the saved one
+	body := []byte(`{"description": "Renamed", "date": ""}`)
+	response := Request(s.router, "PATCH", fmt.Sprintf("/accounts/%d/transactions/%d", account.ID, transaction.ID), bytes.NewBuffer(body))
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	transaction, _ = GetTransaction(s.db, testUser.ID, transaction.ID)
+	assert.Equal(t, "Renamed", transaction.Description)
+	assert.Equal(t, "2019-01-15", transaction.Date)
+}
+
+func TestUpdateTransactionOfOtherUser(t *testing.T) {
+	ClearDB(s.db)
+	s.db.Exec("DELETE FROM users WHERE id <> $1", testUser.ID)
+
+	other := User{Email: "other@fin.com", Password: "other-password"}
+	other.Create(s.db)
+
+	currency := Currency{
+		Name: "USD",
+	}
+	currency.Create(s.db)
+
+	transactions := []Transaction{}
+	for _, userID := range []int{testUser.ID, other.ID} {
+		account := Account{
+			UserID:         userID,
+			Currency:       currency,
+			Name:           "Not Mine",
+			InitialBalance: Decimal("100.00"),
+		}
+		account.Create(s.db)
+		category := Category{
+			UserID: userID,
+			Name:   "Category One",
+		}
+		category.Create(s.db)
+		transaction := Transaction{
+			Account:     account,
+			Description: "My Transaction",
+			Value:       Decimal("0.99"),
+			Type:        "INCOME",
+			Categories:  []Category{category},
+		}
+		transaction.Create(s.db)
+		transactions = append(transactions, transaction)
+	}
+	mine, theirs := transactions[0], transactions[1]
+
+	// the id in the body is ignored
+	body := []byte(fmt.Sprintf(`{"id": %d, "description": "Edited", "account": {"id": %d}}`, theirs.ID, theirs.Account.ID))
+	response := Request(s.router, "PATCH", fmt.Sprintf("/accounts/%d/transactions/%d", mine.Account.ID, mine.ID), bytes.NewBuffer(body))
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	var respTransaction Transaction
+	json.Unmarshal(response.Body.Bytes(), &respTransaction)
+	assert.Equal(t, respTransaction.ID, mine.ID)
+
+	saved, _ := GetTransaction(s.db, other.ID, theirs.ID)
+	assert.Equal(t, saved.Description, "My Transaction")
+	assert.Equal(t, len(saved.Categories), 1)
+
+	// and so is an account in the URL of someone else
+	response = Request(s.router, "PATCH", fmt.Sprintf("/accounts/%d/transactions/%d", theirs.Account.ID, mine.ID), bytes.NewBuffer(body))
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	assert.NotContains(t, response.Body.String(), "Not Mine")
+}
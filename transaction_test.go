@@ -15,13 +15,15 @@ func TestIncomeTransaction(t *testing.T) {
 	}
 	currency.Create(s.db)
 	account := Account{
+		UserID:         testUser.ID,
 		Currency:       currency,
 		Name:           "My Wallet",
 		InitialBalance: Decimal("100.00"),
 	}
 	account.Create(s.db)
 	category := Category{
-		Name: "Category",
+		UserID: testUser.ID,
+		Name:   "Category",
 	}
 	category.Create(s.db)
 	transaction := Transaction{
@@ -33,7 +35,7 @@ func TestIncomeTransaction(t *testing.T) {
 	}
 	transaction.Create(s.db)
 
-	account, _ = GetAccount(s.db, account.ID, "")
+	account, _ = GetAccount(s.db, testUser.ID, account.ID, "")
 	assert.Equal(t, account.Balance, Decimal("100.99"))
 }
 
@@ -45,13 +47,15 @@ func TestExpenseTransaction(t *testing.T) {
 	}
 	currency.Create(s.db)
 	account := Account{
+		UserID:         testUser.ID,
 		Currency:       currency,
 		Name:           "My Wallet",
 		InitialBalance: Decimal("100.00"),
 	}
 	account.Create(s.db)
 	category := Category{
-		Name: "Category",
+		UserID: testUser.ID,
+		Name:   "Category",
 	}
 	category.Create(s.db)
 	transaction := Transaction{
@@ -71,6 +75,55 @@ func TestExpenseTransaction(t *testing.T) {
 	}
 	expense.Create(s.db)
 
-	account, _ = GetAccount(s.db, account.ID, "")
+	account, _ = GetAccount(s.db, testUser.ID, account.ID, "")
 	assert.Equal(t, account.Balance, Decimal("99.99"))
 }
+
+func TestMultipleTransactionsBalance(t *testing.T) {
+	ClearDB(s.db)
+
+	currency := Currency{
+		Name: "USD",
+	}
+	currency.Create(s.db)
+	account := Account{
+		UserID:         testUser.ID,
+		Currency:       currency,
+		Name:           "My Wallet",
+		InitialBalance: Decimal("100.00"),
+	}
+	account.Create(s.db)
+	category := Category{
+		UserID: testUser.ID,
+		Name:   "Category",
+	}
+	category.Create(s.db)
+
+	for _, value := range []string{"10.00", "5.50"} {
+		income := Transaction{
+			Account:     account,
+			Description: "My Income",
+			Value:       Decimal(value),
+			Type:        "INCOME",
+			Categories:  []Category{category},
+		}
+		income.Create(s.db)
+	}
+
+	for _, value := range []string{"1.00", "2.25"} {
+		expense := Transaction{
+			Account:     account,
+			Description: "My Expense",
+			Value:       Decimal(value),
+			Type:        "EXPENSE",
+			Categories:  []Category{category},
+		}
+		expense.Create(s.db)
+	}
+
+	account, _ = GetAccount(s.db, testUser.ID, account.ID, "")
+	assert.Equal(t, account.Balance.String(), "112.25")
+	assert.Equal(t, account.TotalIncome.String(), "15.5")
+	assert.Equal(t, account.TotalExpense.String(), "3.25")
+	assert.Equal(t, account.TransactionCount, 4)
+}
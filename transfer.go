@@ -0,0 +1,376 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/shopspring/decimal"
+)
+
+// Transfer moves money between two accounts
+// it is stored as two linked TRANSFER transactions: a debit on the source account
+// and a credit on the destination, converted to the destination currency
+// both accounts must belong to the same User
+type Transfer struct {
+	ID          int             `json:"id"`
+	UserID      int             `json:"-"`
+	FromAccount Account         `json:"from_account"`
+	ToAccount   Account         `json:"to_account"`
+	Description string          `json:"description"`
+	Value       decimal.Decimal `json:"value"`
+	Rate        decimal.Decimal `json:"rate"`
+	Date        string          `json:"date"`
+	Debit       Transaction     `json:"debit"`
+	Credit      Transaction     `json:"credit"`
+	CreatedAt   string          `json:"created_at"`
+	UpdatedAt   string          `json:"updated_at"`
+}
+
+func ListTransfers(db *sql.DB, userID int) ([]Transfer, error) {
+	rows, err := db.Query(
+		`SELECT tr.id FROM transfers tr
+		INNER JOIN accounts a ON (tr.from_account_id = a.id)
+		WHERE a.user_id = $1
+		ORDER BY tr.id`, userID,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []int{}
+
+	for rows.Next() {
+		var id int
+		errScan := rows.Scan(&id)
+		if errScan != nil {
+			return nil, errScan
+		}
+
+		ids = append(ids, id)
+	}
+
+	transfers := []Transfer{}
+
+	for _, id := range ids {
+		transfer, errTransfer := GetTransfer(db, userID, id)
+		if errTransfer != nil {
+			return nil, errTransfer
+		}
+
+		transfers = append(transfers, transfer)
+	}
+
+	return transfers, nil
+}
+
+func GetTransfer(db *sql.DB, userID int, id int) (transfer Transfer, err error) {
+	err = db.QueryRow(
+		`SELECT tr.id, a.user_id, tr.from_account_id, tr.to_account_id, tr.description, tr.value, tr.rate, to_char(tr.date, 'YYYY-MM-DD'), tr.created_at, tr.updated_at
+		FROM transfers tr INNER JOIN accounts a ON (tr.from_account_id = a.id)
+		WHERE tr.id = $1 AND a.user_id = $2`, id, userID,
+	).Scan(
+		&transfer.ID,
+		&transfer.UserID,
+		&transfer.FromAccount.ID,
+		&transfer.ToAccount.ID,
+		&transfer.Description,
+		&transfer.Value,
+		&transfer.Rate,
+		&transfer.Date,
+		&transfer.CreatedAt,
+		&transfer.UpdatedAt,
+	)
+
+	if err != nil {
+		return
+	}
+
+	transfer.FromAccount, err = GetAccount(db, transfer.UserID, transfer.FromAccount.ID, "")
+	if err != nil {
+		return
+	}
+
+	transfer.ToAccount, err = GetAccount(db, transfer.UserID, transfer.ToAccount.ID, "")
+	if err != nil {
+		return
+	}
+
+	err = transfer.getLegs(db)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (transfer *Transfer) getLegs(db *sql.DB) (err error) {
+	rows, err := db.Query(
+		"SELECT id, account_id FROM transactions WHERE transfer_id = $1",
+		transfer.ID,
+	)
+
+	if err != nil {
+		return
+	}
+
+	for rows.Next() {
+		var transactionID int
+		var accountID int
+
+		err = rows.Scan(&transactionID, &accountID)
+		if err != nil {
+			return
+		}
+
+		leg, errLeg := GetTransaction(db, transfer.UserID, transactionID)
+		if errLeg != nil {
+			return errLeg
+		}
+		leg.Account.ID = accountID
+
+		if accountID == transfer.FromAccount.ID {
+			transfer.Debit = leg
+		} else {
+			transfer.Credit = leg
+		}
+	}
+
+	return
+}
+
+// loadAccounts fetches both accounts and the rate used to convert the value
+// from the source currency to the destination currency, accounts of other users are reported as not found
+func (transfer *Transfer) loadAccounts(db *sql.DB) (err error) {
+	transfer.FromAccount, err = GetAccount(db, transfer.UserID, transfer.FromAccount.ID, "")
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("account %d not found", transfer.FromAccount.ID)
+	}
+	if err != nil {
+		return
+	}
+
+	transfer.ToAccount, err = GetAccount(db, transfer.UserID, transfer.ToAccount.ID, "")
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("account %d not found", transfer.ToAccount.ID)
+	}
+	if err != nil {
+		return
+	}
+
+	if transfer.FromAccount.Currency.Name == transfer.ToAccount.Currency.Name {
+		transfer.Rate = decimal.New(1, 0)
+		return
+	}
+
+	rate, err := transfer.FromAccount.Currency.GetRate(db, transfer.ToAccount.Currency.Name)
+	if err != nil {
+		return
+	}
+
+	if rate.Name == "" {
+		return fmt.Errorf(
+			"rate from '%s' to '%s' not found",
+			transfer.FromAccount.Currency.Name,
+			transfer.ToAccount.Currency.Name,
+		)
+	}
+
+	transfer.Rate = rate.Value
+
+	return
+}
+
+// buildLegs fills the debit and credit transactions from the transfer fields
+func (transfer *Transfer) buildLegs() {
+	transfer.Debit.Account = transfer.FromAccount
+	transfer.Debit.Description = transfer.Description
+	transfer.Debit.Value = transfer.Value
+	transfer.Debit.Type = "TRANSFER"
+	transfer.Debit.Date = transfer.Date
+	transfer.Debit.TransferID = transfer.ID
+
+	transfer.Credit.Account = transfer.ToAccount
+	transfer.Credit.Description = transfer.Description
+	transfer.Credit.Value = roundMoney(transfer.Value.Mul(transfer.Rate))
+	transfer.Credit.Type = "TRANSFER"
+	transfer.Credit.Date = transfer.Date
+	transfer.Credit.TransferID = transfer.ID
+}
+
+func (transfer *Transfer) Create(db *sql.DB) (err error) {
+	err = transfer.loadAccounts(db)
+	if err != nil {
+		return
+	}
+
+	createdAt := time.Now()
+
+	if transfer.Date == "" {
+		transfer.Date = createdAt.Format(dateLayout)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+
+	err = tx.QueryRow(
+		`INSERT INTO transfers(from_account_id, to_account_id, description, value, rate, date, created_at, updated_at)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at, updated_at`,
+		transfer.FromAccount.ID,
+		transfer.ToAccount.ID,
+		transfer.Description,
+		transfer.Value,
+		transfer.Rate,
+		transfer.Date,
+		createdAt,
+		createdAt,
+	).Scan(&transfer.ID, &transfer.CreatedAt, &transfer.UpdatedAt)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+
+	transfer.buildLegs()
+
+	err = transfer.Debit.insert(db, tx)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+
+	err = transfer.Credit.insert(db, tx)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// Update saves the transfer and its legs, which are loaded again from the database
+// so only the transactions of the transfer of the User are changed
+func (transfer *Transfer) Update(db *sql.DB) (err error) {
+	saved, err := GetTransfer(db, transfer.UserID, transfer.ID)
+	if err != nil {
+		return
+	}
+	transfer.Debit = saved.Debit
+	transfer.Credit = saved.Credit
+
+	err = transfer.loadAccounts(db)
+	if err != nil {
+		return
+	}
+
+	updatedAt := time.Now()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+
+	err = tx.QueryRow(
+		`UPDATE transfers
+		SET from_account_id = $1, to_account_id = $2, description = $3, value = $4, rate = $5, date = $6, updated_at = $7
+		WHERE id = $8
+		RETURNING updated_at`,
+		transfer.FromAccount.ID,
+		transfer.ToAccount.ID,
+		transfer.Description,
+		transfer.Value,
+		transfer.Rate,
+		transfer.Date,
+		updatedAt,
+		transfer.ID,
+	).Scan(&transfer.UpdatedAt)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+
+	transfer.buildLegs()
+
+	for _, leg := range []*Transaction{&transfer.Debit, &transfer.Credit} {
+		err = tx.QueryRow(
+			`UPDATE transactions
+			SET account_id = $1, description = $2, value = $3, date = $4, updated_at = $5
+			WHERE id = $6 AND transfer_id = $7
+			RETURNING updated_at`,
+			leg.Account.ID,
+			leg.Description,
+			leg.Value,
+			leg.Date,
+			updatedAt,
+			leg.ID,
+			transfer.ID,
+		).Scan(&leg.UpdatedAt)
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// Delete removes the transfer, both legs are deleted with it by ON DELETE CASCADE
+func (transfer *Transfer) Delete(db *sql.DB) (err error) {
+	_, err = db.Exec(
+		"DELETE FROM transfers WHERE id = $1",
+		transfer.ID,
+	)
+
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (transfer Transfer) Validate() (err error) {
+	if transfer.FromAccount.ID == 0 {
+		err = errors.New("field 'from_account.id' must not be empty")
+	}
+
+	if transfer.ToAccount.ID == 0 {
+		err = errors.New("field 'to_account.id' must not be empty")
+	}
+
+	if transfer.FromAccount.ID != 0 && transfer.FromAccount.ID == transfer.ToAccount.ID {
+		err = errors.New("fields 'from_account.id' and 'to_account.id' must be different")
+	}
+
+	if transfer.Value.LessThanOrEqual(decimal.NewFromFloat(0)) != false {
+		err = errors.New("field 'value' must be more than 0")
+	}
+
+	valueCheck := regexp.MustCompile(`^\d*(\.\d{1,2}|\d)$`)
+	if !valueCheck.MatchString(transfer.Value.String()) {
+		err = errors.New("field 'value' must be like 1.99")
+	}
+
+	if transfer.Date != "" {
+		if _, errDate := time.Parse(dateLayout, transfer.Date); errDate != nil {
+			err = errors.New("field 'date' must be like 2019-01-31")
+		}
+	}
+
+	return
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+func (s *Server) ListTransfers(w http.ResponseWriter, r *http.Request) {
+	transfers, err := ListTransfers(s.db, currentUser(r).ID)
+
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, transfers, http.StatusOK)
+	return
+}
+
+func (s *Server) CreateTransfer(w http.ResponseWriter, r *http.Request) {
+	var transfer Transfer
+	json.NewDecoder(r.Body).Decode(&transfer)
+
+	err := validateRequest(transfer)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	transfer.UserID = currentUser(r).ID
+	err = transfer.Create(s.db)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	respondWithJSON(w, transfer, http.StatusCreated)
+	return
+}
+
+func (s *Server) GetTransfer(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	transferID, _ := strconv.Atoi(vars["id"])
+	transfer, err := GetTransfer(s.db, currentUser(r).ID, transferID)
+
+	if err == sql.ErrNoRows {
+		respondWithError(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, transfer, http.StatusOK)
+	return
+}
+
+func (s *Server) UpdateTransfer(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	transferID, _ := strconv.Atoi(vars["id"])
+	transfer, err := GetTransfer(s.db, currentUser(r).ID, transferID)
+
+	if err == sql.ErrNoRows {
+		respondWithError(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// the ids come from the URL and the database, never from the body
+	json.NewDecoder(r.Body).Decode(&transfer)
+	transfer.ID = transferID
+
+	err = validateRequest(transfer)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = transfer.Update(s.db)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	respondWithJSON(w, transfer, http.StatusOK)
+	return
+}
+
+func (s *Server) DeleteTransfer(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	transferID, _ := strconv.Atoi(vars["id"])
+	transfer, err := GetTransfer(s.db, currentUser(r).ID, transferID)
+
+	if err == sql.ErrNoRows {
+		respondWithError(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = transfer.Delete(s.db)
+
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, nil, http.StatusNoContent)
+	return
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/jonatasbaldin/fin/test"
+)
+
+func TestCreateTransfer(t *testing.T) {
+	ClearDB(s.db)
+
+	currency := Currency{
+		Name: "USD",
+	}
+	currency.Create(s.db)
+	checking := Account{
+		UserID:         testUser.ID,
+		Currency:       currency,
+		Name:           "Checking",
+		InitialBalance: Decimal("100.00"),
+	}
+	checking.Create(s.db)
+	savings := Account{
+		UserID:         testUser.ID,
+		Currency:       currency,
+		Name:           "Savings",
+		InitialBalance: Decimal("10.00"),
+	}
+	savings.Create(s.db)
+
+	body := []byte(
+		fmt.Sprintf(`{"from_account": {"id": %d}, "to_account": {"id": %d}, "description": "Savings", "value": 25.50}`, checking.ID, savings.ID),
+	)
+	response := Request(s.router, "POST", "/transfers", bytes.NewBuffer(body))
+	assert.Equal(t, http.StatusCreated, response.Code)
+
+	var respTransfer Transfer
+	json.Unmarshal(response.Body.Bytes(), &respTransfer)
+
+	assert.Equal(t, respTransfer.Value.String(), "25.5")
+	assert.Equal(t, respTransfer.Debit.Type, "TRANSFER")
+	assert.Equal(t, respTransfer.Credit.Value.String(), "25.5")
+	assert.Equal(t, respTransfer.Credit.TransferID, respTransfer.ID)
+
+	checking, _ = GetAccount(s.db, testUser.ID, checking.ID, "")
+	savings, _ = GetAccount(s.db, testUser.ID, savings.ID, "")
+	assert.Equal(t, checking.Balance.String(), "74.5")
+	assert.Equal(t, savings.Balance.String(), "35.5")
+}
+
+func TestCreateTransferDifferentCurrencies(t *testing.T) {
+	ClearDB(s.db)
+
+	currencyBrl := Currency{
+		Name: "BRL",
+	}
+	currencyBrl.Create(s.db)
+	currency := Currency{
+		Name:  "USD",
+		Rates: []Rate{{Name: "BRL", Symbol: "R$", Value: Decimal("3.80")}},
+	}
+	currency.Create(s.db)
+	wallet := Account{
+		UserID:         testUser.ID,
+		Currency:       currency,
+		Name:           "Wallet",
+		InitialBalance: Decimal("100.00"),
+	}
+	wallet.Create(s.db)
+	carteira := Account{
+		UserID:         testUser.ID,
+		Currency:       currencyBrl,
+		Name:           "Carteira",
+		InitialBalance: Decimal("10.00"),
+	}
+	carteira.Create(s.db)
+
+	transfer := Transfer{
+		UserID:      testUser.ID,
+		FromAccount: wallet,
+		ToAccount:   carteira,
+		Value:       Decimal("10.00"),
+	}
+	err := transfer.Create(s.db)
+	assert.Nil(t, err)
+
+	assert.Equal(t, transfer.Rate.String(), "3.8")
+	assert.Equal(t, transfer.Credit.Value.String(), "38")
+
+	carteira, _ = GetAccount(s.db, testUser.ID, carteira.ID, "")
+	assert.Equal(t, carteira.Balance.String(), "48")
+}
+
+func TestUpdateTransfer(t *testing.T) {
+	ClearDB(s.db)
+
+	currency := Currency{
+		Name: "USD",
+	}
+	currency.Create(s.db)
+	checking := Account{
+		UserID:         testUser.ID,
+		Currency:       currency,
+		Name:           "Checking",
+		InitialBalance: Decimal("100.00"),
+	}
+	checking.Create(s.db)
+	savings := Account{
+		UserID:         testUser.ID,
+		Currency:       currency,
+		Name:           "Savings",
+		InitialBalance: Decimal("10.00"),
+	}
+	savings.Create(s.db)
+	transfer := Transfer{
+		UserID:      testUser.ID,
+		FromAccount: checking,
+		ToAccount:   savings,
+		Value:       Decimal("10.00"),
+	}
+	transfer.Create(s.db)
+
+	body := []byte(`{"value": 20}`)
+	response := Request(s.router, "PATCH", fmt.Sprintf("/transfers/%d", transfer.ID), bytes.NewBuffer(body))
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	debit, _ := GetTransaction(s.db, testUser.ID, transfer.Debit.ID)
+	credit, _ := GetTransaction(s.db, testUser.ID, transfer.Credit.ID)
+	assert.Equal(t, debit.Value.String(), "20")
+	assert.Equal(t, credit.Value.String(), "20")
+}
+
+func TestUpdateTransferIgnoresBodyIDs(t *testing.T) {
+	ClearDB(s.db)
+	s.db.Exec("DELETE FROM users WHERE id <> $1", testUser.ID)
+
+	other := User{Email: "other@fin.com", Password: "other-password"}
+	other.Create(s.db)
+
+	currency := Currency{
+		Name: "USD",
+	}
+	currency.Create(s.db)
+
+	transfers := []Transfer{}
+	for _, userID := range []int{testUser.ID, other.ID} {
+		checking := Account{
+			UserID:         userID,
+			Currency:       currency,
+			Name:           "Checking",
+			InitialBalance: Decimal("100.00"),
+		}
+		checking.Create(s.db)
+		savings := Account{
+			UserID:         userID,
+			Currency:       currency,
+			Name:           "Savings",
+			InitialBalance: Decimal("10.00"),
+		}
+		savings.Create(s.db)
+		transfer := Transfer{
+			UserID:      userID,
+			FromAccount: checking,
+			ToAccount:   savings,
+			Value:       Decimal("10.00"),
+		}
+		transfer.Create(s.db)
+		transfers = append(transfers, transfer)
+	}
+	mine, theirs := transfers[0], transfers[1]
+
+	body := []byte(fmt.Sprintf(
+		`{"id": %d, "value": 20, "debit": {"id": %d}, "credit": {"id": %d}}`,
+		theirs.ID, theirs.Debit.ID, theirs.Credit.ID,
+	))
+	response := Request(s.router, "PATCH", fmt.Sprintf("/transfers/%d", mine.ID), bytes.NewBuffer(body))
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	var respTransfer Transfer
+	json.Unmarshal(response.Body.Bytes(), &respTransfer)
+	assert.Equal(t, respTransfer.ID, mine.ID)
+	assert.Equal(t, respTransfer.Debit.ID, mine.Debit.ID)
+
+	debit, _ := GetTransaction(s.db, testUser.ID, mine.Debit.ID)
+	assert.Equal(t, debit.Value.String(), "20")
+
+	theirDebit, _ := GetTransaction(s.db, other.ID, theirs.Debit.ID)
+	theirCredit, _ := GetTransaction(s.db, other.ID, theirs.Credit.ID)
+	assert.Equal(t, theirDebit.Value.String(), "10")
+	assert.Equal(t, theirDebit.Account.ID, theirs.FromAccount.ID)
+	assert.Equal(t, theirCredit.Value.String(), "10")
+}
+
+func TestDeleteTransfer(t *testing.T) {
+	ClearDB(s.db)
+
+	currency := Currency{
+		Name: "USD",
+	}
+	currency.Create(s.db)
+	checking := Account{
+		UserID:         testUser.ID,
+		Currency:       currency,
+		Name:           "Checking",
+		InitialBalance: Decimal("100.00"),
+	}
+	checking.Create(s.db)
+	savings := Account{
+		UserID:         testUser.ID,
+		Currency:       currency,
+		Name:           "Savings",
+		InitialBalance: Decimal("10.00"),
+	}
+	savings.Create(s.db)
+	transfer := Transfer{
+		UserID:      testUser.ID,
+		FromAccount: checking,
+		ToAccount:   savings,
+		Value:       Decimal("10.00"),
+	}
+	transfer.Create(s.db)
+
+	response := Request(s.router, "DELETE", fmt.Sprintf("/accounts/%d/transactions/%d", checking.ID, transfer.Debit.ID), nil)
+	assert.Equal(t, http.StatusNoContent, response.Code)
+
+	_, err := GetTransfer(s.db, testUser.ID, transfer.ID)
+	assert.NotNil(t, err)
+	_, err = GetTransaction(s.db, testUser.ID, transfer.Credit.ID)
+	assert.NotNil(t, err)
+}
+
+func TestValidateTransferSameAccount(t *testing.T) {
+	ClearDB(s.db)
+
+	currency := Currency{
+		Name: "USD",
+	}
+	currency.Create(s.db)
+	account := Account{
+		UserID:         testUser.ID,
+		Currency:       currency,
+		Name:           "My Wallet",
+		InitialBalance: Decimal("100.00"),
+	}
+	account.Create(s.db)
+
+	body := []byte(fmt.Sprintf(`{"from_account": {"id": %d}, "to_account": {"id": %d}, "value": 1}`, account.ID, account.ID))
+	response := Request(s.router, "POST", "/transfers", bytes.NewBuffer(body))
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+
+	var err CustomError
+	json.Unmarshal(response.Body.Bytes(), &err)
+
+	assert.Equal(t, err.Error, "fields 'from_account.id' and 'to_account.id' must be different")
+}
+
+func TestValidateTransactionTypeTransfer(t *testing.T) {
+	ClearDB(s.db)
+
+	currency := Currency{
+		Name: "USD",
+	}
+	currency.Create(s.db)
+	account := Account{
+		UserID:         testUser.ID,
+		Currency:       currency,
+		Name:           "My Wallet",
+		InitialBalance: Decimal("100.00"),
+	}
+	account.Create(s.db)
+
+	body := []byte(`{"description": "My Transfer", "value": 0.99, "type": "TRANSFER", "transfer_id": 1}`)
+	response := Request(s.router, "POST", fmt.Sprintf("/accounts/%d/transactions", account.ID), bytes.NewBuffer(body))
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+
+	var err CustomError
+	json.Unmarshal(response.Body.Bytes(), &err)
+
+	assert.Equal(t, err.Error, "transactions of type 'TRANSFER' must be created through '/transfers'")
+}
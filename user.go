@@ -0,0 +1,186 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// errInvalidCredentials is returned when the email or the password don't match,
+// it doesn't tell which one, so it can't be used to find out registered emails
+var errInvalidCredentials = errors.New("invalid email or password")
+
+// User owns accounts and categories, every query over them is scoped to a User
+type User struct {
+	ID        int    `json:"id"`
+	Email     string `json:"email"`
+	Name      string `json:"name"`
+	Password  string `json:"password,omitempty"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+func (user *User) Create(db *sql.DB) (err error) {
+	createdAt := time.Now()
+	user.Email = strings.ToLower(strings.TrimSpace(user.Email))
+
+	passwordHash, err := hashPassword(user.Password)
+	if err != nil {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+
+	err = tx.QueryRow(
+		`INSERT INTO users(email, name, password_hash, created_at, updated_at)
+		VALUES($1, $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at`,
+		user.Email,
+		user.Name,
+		passwordHash,
+		createdAt,
+		createdAt,
+	).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+
+	if errPq, ok := err.(*pq.Error); ok && errPq.Code == "23505" {
+		tx.Rollback()
+		return fmt.Errorf("email '%s' is already registered", user.Email)
+	}
+
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+
+	err = claimOrphanedRows(tx, user.ID)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return
+	}
+
+	// the password is never sent back
+	user.Password = ""
+
+	return
+}
+
+// claimOrphanedRows gives the accounts and categories created before users existed to userID,
+// so only the first registered User finds any. Once they have an owner it becomes required.
+func claimOrphanedRows(tx *sql.Tx, userID int) error {
+	for _, table := range []string{"accounts", "categories"} {
+		result, err := tx.Exec(fmt.Sprintf("UPDATE %s SET user_id = $1 WHERE user_id IS NULL", table), userID)
+		if err != nil {
+			return err
+		}
+
+		claimed, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if claimed == 0 {
+			continue
+		}
+
+		_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ALTER COLUMN user_id SET NOT NULL", table))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func GetUser(db *sql.DB, id int) (user User, err error) {
+	err = db.QueryRow(
+		"SELECT id, email, COALESCE(name, ''), created_at, updated_at FROM users WHERE id = $1", id,
+	).Scan(
+		&user.ID,
+		&user.Email,
+		&user.Name,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func GetUserByEmail(db *sql.DB, email string) (user User, err error) {
+	err = db.QueryRow(
+		"SELECT id, email, COALESCE(name, ''), created_at, updated_at FROM users WHERE email = $1",
+		strings.ToLower(strings.TrimSpace(email)),
+	).Scan(
+		&user.ID,
+		&user.Email,
+		&user.Name,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// Authenticate returns the User with the email, if the password matches
+func Authenticate(db *sql.DB, email string, password string) (user User, err error) {
+	var passwordHash string
+
+	err = db.QueryRow(
+		"SELECT id, email, COALESCE(name, ''), password_hash, created_at, updated_at FROM users WHERE email = $1",
+		strings.ToLower(strings.TrimSpace(email)),
+	).Scan(
+		&user.ID,
+		&user.Email,
+		&user.Name,
+		&passwordHash,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return user, errInvalidCredentials
+	}
+
+	if err != nil {
+		return
+	}
+
+	if !checkPassword(password, passwordHash) {
+		return User{}, errInvalidCredentials
+	}
+
+	return
+}
+
+func (user User) Validate() (err error) {
+	emailCheck := regexp.MustCompile(`^[^@\s]+@[^@\s]+$`)
+	if !emailCheck.MatchString(user.Email) {
+		err = errors.New("field 'email' must be a valid email")
+	}
+
+	if len(user.Password) < 8 {
+		err = errors.New("field 'password' must have at least 8 characters")
+	}
+
+	return
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// Session is the response of '/login', Token is sent as "Authorization: Bearer <token>"
+type Session struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	User      User      `json:"user"`
+}
+
+func (s *Server) RegisterUser(w http.ResponseWriter, r *http.Request) {
+	var user User
+	json.NewDecoder(r.Body).Decode(&user)
+
+	err := validateRequest(user)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = user.Create(s.db)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	respondWithJSON(w, user, http.StatusCreated)
+	return
+}
+
+// Login checks the email and password and creates a signed session token
+func (s *Server) Login(w http.ResponseWriter, r *http.Request) {
+	var credentials User
+	json.NewDecoder(r.Body).Decode(&credentials)
+
+	user, err := Authenticate(s.db, credentials.Email, credentials.Password)
+	if err == errInvalidCredentials {
+		respondWithError(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	token, expiresAt, err := signToken(s.tokenSecret, user.ID, time.Now(), s.tokenTTL)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, Session{Token: token, ExpiresAt: expiresAt, User: user}, http.StatusOK)
+	return
+}
+
+func (s *Server) GetCurrentUser(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, currentUser(r), http.StatusOK)
+	return
+}